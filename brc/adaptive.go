@@ -0,0 +1,38 @@
+package brc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// typicalLineLength is the average line length in bytes of the 1BRC
+	// data, the line length Config.ChunkSize is meant for with
+	// Config.AdaptiveChunks
+	typicalLineLength = 14
+	// adaptiveSampleSize bounds how much of the first chunk is read to
+	// estimate the average line length
+	adaptiveSampleSize = 1 << 20
+)
+
+// adaptiveChunkSize estimates the average line length from the start of the
+// first chunk, [start, end), and returns the chunk size holding as many lines
+// of that length as chunkSize holds lines of typicalLineLength. A sample
+// without a newline keeps chunkSize.
+func adaptiveChunkSize(file io.ReaderAt, start, end, chunkSize int64) (int64, error) {
+	sample := make([]byte, min(end-start, adaptiveSampleSize))
+	n, err := readFullAt(file, sample, start)
+	if err != nil {
+		return 0, fmt.Errorf("sampling the chunk at offset %d: %w", start, err)
+	}
+	lines := int64(bytes.Count(sample[:n], []byte{'\n'}))
+	if lines == 0 {
+		return chunkSize, nil
+	}
+
+	// chunkSize * average line length / typicalLineLength, multiplied first
+	// to keep the precision, can't overflow as both factors are below 2^31
+	size := chunkSize * int64(n) / (lines * typicalLineLength)
+	return min(max(size, 1), maxChunkSize), nil
+}
@@ -0,0 +1,124 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdaptiveChunkSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		chunkSize int64
+		expSize   int64
+	}{
+		// 28 byte lines are twice the typical length
+		{name: "long lines", data: strings.Repeat("Twenty-eight bytes st;-12.3\n", 10), chunkSize: 1000, expSize: 2000},
+		{name: "typical lines", data: strings.Repeat("Halifax;-12.3\n", 10), chunkSize: 1000, expSize: 1000},
+		{name: "short lines", data: strings.Repeat("a;1.0\n", 10), chunkSize: 1400, expSize: 600},
+		{name: "no newline", data: "Halifax;12.3", chunkSize: 1000, expSize: 1000},
+		{name: "at least a byte", data: "\n\n\n\n", chunkSize: 1, expSize: 1},
+		{name: "at most maxChunkSize", data: strings.Repeat("x", 139) + "\n", chunkSize: maxChunkSize, expSize: maxChunkSize},
+	}
+	for _, tc := range tests {
+		file := bytes.NewReader([]byte(tc.data))
+		size, err := adaptiveChunkSize(file, 0, int64(len(tc.data)), tc.chunkSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != tc.expSize {
+			t.Errorf("(%s) expected chunk size %d but got %d", tc.name, tc.expSize, size)
+		}
+	}
+}
+
+func TestRunAdaptiveChunks(t *testing.T) {
+	ctx := context.Background()
+
+	for _, filePath := range []string{generateMeasurementsFile(t, 50_000, 1), generateLongNameMeasurementsFile(t, 50_000, 1)} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = 4096
+		setConcurrency(&cfg, true)
+		expOutput, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg.AdaptiveChunks = true
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(%s) expected the adaptive chunks to produce the fixed chunk output", filepath.Base(filePath))
+		}
+	}
+}
+
+// BenchmarkAdaptiveChunks reports the lines per chunk of inputs with typical
+// and with long lines, which adaptive chunks keep close to each other.
+func BenchmarkAdaptiveChunks(b *testing.B) {
+	inputs := []struct {
+		name     string
+		filePath string
+	}{
+		{name: "typical", filePath: generateMeasurementsFile(b, 1_000_000, 1)},
+		{name: "long", filePath: generateLongNameMeasurementsFile(b, 1_000_000, 1)},
+	}
+
+	for _, input := range inputs {
+		for _, adaptive := range []bool{false, true} {
+			name := input.name + "/fixed"
+			if adaptive {
+				name = input.name + "/adaptive"
+			}
+			filePath := input.filePath
+			cfg := DefaultConfig()
+			cfg.AdaptiveChunks = adaptive
+			setConcurrency(&cfg, true)
+
+			b.Run(name, func(b *testing.B) {
+				before := metricsSnapshot()
+				for i := 0; i < b.N; i++ {
+					if _, err := runString(context.Background(), filePath, cfg); err != nil {
+						b.Fatal(err)
+					}
+				}
+				after := metricsSnapshot()
+				b.ReportMetric(float64(after[1]-before[1])/float64(after[0]-before[0]), "lines/chunk")
+			})
+		}
+	}
+}
+
+// generateLongNameMeasurementsFile is generateMeasurementsFile with the
+// station names padded to several times the typical line length.
+func generateLongNameMeasurementsFile(tb testing.TB, rows int, seed int64) string {
+	tb.Helper()
+
+	filePath := filepath.Join(tb.TempDir(), "measurements_long_names.txt")
+	f, err := os.Create(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	rng := rand.New(rand.NewSource(seed))
+	w := bufio.NewWriter(f)
+	for i := 0; i < rows; i++ {
+		station := generatorStations[rng.Intn(len(generatorStations))]
+		w.WriteString(station + " Meteorological Observatory;")
+		w.WriteString(formatTemperature(int64(rng.Intn(1999)-999), 1))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	return filePath
+}
@@ -0,0 +1,149 @@
+package brc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// input formats
+const (
+	inputFormatText   = "text"
+	inputFormatBinary = "binary"
+)
+
+// binaryRecord is a fixed width measurement of the binary input format: a
+// station id, resolved to a name through the dictionary, and the temperature
+// in tenths, or hundredths with -precision=2.
+type binaryRecord struct {
+	StationID   uint32
+	Temperature int16
+}
+
+// byteOrder returns the binary.ByteOrder named by order.
+func byteOrder(order string) (binary.ByteOrder, error) {
+	switch order {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("unknown byte order '%s', expected little or big", order)
+}
+
+// loadDictionary reads a sidecar dictionary of "id;name" lines mapping the
+// station ids of binary input to station names.
+func loadDictionary(filePath string) (map[uint32]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dictionary := map[uint32]string{}
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		id, name, ok := strings.Cut(line, ";")
+		if !ok {
+			return nil, fmt.Errorf("dictionary line %d does not have ; present", lineNumber)
+		}
+		stationID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("dictionary line %d: %w", lineNumber, err)
+		}
+		if _, exists := dictionary[uint32(stationID)]; exists {
+			return nil, fmt.Errorf("dictionary line %d: duplicate station id %d", lineNumber, stationID)
+		}
+		dictionary[uint32(stationID)] = name
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dictionary, nil
+}
+
+// parseBinaryInput loads the dictionary and byte order configured in cfg and
+// aggregates the binary records of file.
+func parseBinaryInput(ctx context.Context, file *os.File, cfg Config, hasher *inputHasher) ([]string, map[string]Location, error) {
+	dictionary, err := loadDictionary(cfg.Dictionary)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, err := byteOrder(cfg.ByteOrder)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseBinaryFile(ctx, file, dictionary, order, hasher)
+}
+
+// parseBinaryFile aggregates fixed width binaryRecords read from file, naming
+// stations through dictionary.
+func parseBinaryFile(ctx context.Context, file *os.File, dictionary map[uint32]string, order binary.ByteOrder, hasher *inputHasher) ([]string, map[string]Location, error) {
+	locations := []string{}
+	locationMap := map[string]*Location{}
+
+	var input io.Reader = file
+	stream := hasher.newHashStream(0)
+	if stream != nil {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		hasher.expect(0, fileInfo.Size())
+		input = io.TeeReader(file, stream)
+	}
+
+	reader := bufio.NewReader(input)
+
+	for offset, recordNumber := int64(0), 0; ; offset, recordNumber = offset+int64(binary.Size(binaryRecord{})), recordNumber+1 {
+		// checked every few records like parseFile checks its lines
+		if recordNumber%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("cancelled due to context: %w", ctx.Err())
+		}
+
+		var record binaryRecord
+		err := binary.Read(reader, order, &record)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, fmt.Errorf("truncated record at offset %d", offset)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		locationName, ok := dictionary[record.StationID]
+		if !ok {
+			return nil, nil, fmt.Errorf("station id %d at offset %d not found in dictionary", record.StationID, offset)
+		}
+		temperature := int64(record.Temperature)
+
+		loc, ok := locationMap[locationName]
+		if !ok {
+			// add to locations slice for ordered location printing at end
+			locations = append(locations, locationName)
+			loc = &Location{}
+			locationMap[locationName] = loc
+		}
+		if err := mergeLocation(loc, newLocation(temperature)); err != nil {
+			return nil, nil, fmt.Errorf("location '%s': %w", locationName, err)
+		}
+	}
+
+	return locations, locationValues(locationMap), nil
+}
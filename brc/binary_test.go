@@ -0,0 +1,165 @@
+package brc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	measurements10BinaryIn     string = "measurements_ten.bin"
+	measurements10DictionaryIn string = "measurements_ten_dictionary.txt"
+)
+
+func binaryConfig() Config {
+	cfg := DefaultConfig()
+	cfg.InputFormat = inputFormatBinary
+	cfg.Dictionary = measurements10DictionaryIn
+	return cfg
+}
+
+func TestRunBinary(t *testing.T) {
+	ctx := context.Background()
+
+	expOutput, err := runString(ctx, measurements10In, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runString(ctx, measurements10BinaryIn, binaryConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != expOutput {
+		t.Errorf("expected %+v but got %+v", expOutput, output)
+	}
+}
+
+func TestRunBinaryBigEndian(t *testing.T) {
+	ctx := context.Background()
+
+	records := []binaryRecord{
+		{StationID: 1, Temperature: -123},
+		{StationID: 2, Temperature: 456},
+		{StationID: 1, Temperature: 99},
+	}
+	filePath := writeBinaryRecords(t, binary.BigEndian, records)
+
+	cfg := binaryConfig()
+	cfg.ByteOrder = "big"
+
+	output, err := runString(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expOutput := "{Halifax=-12.3/-1.2/9.9, Zagreb=45.6/45.6/45.6}"
+	if output != expOutput {
+		t.Errorf("expected %+v but got %+v", expOutput, output)
+	}
+}
+
+func TestRunBinaryErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		data   func(t *testing.T) string
+		expErr string
+	}{
+		{
+			name: "truncated record",
+			data: func(t *testing.T) string {
+				filePath := writeBinaryRecords(t, binary.LittleEndian, []binaryRecord{{StationID: 1, Temperature: 10}})
+				f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.Write([]byte{1, 0, 0}); err != nil {
+					t.Fatal(err)
+				}
+				return filePath
+			},
+			expErr: "truncated record at offset 6",
+		},
+		{
+			name: "unknown station id",
+			data: func(t *testing.T) string {
+				return writeBinaryRecords(t, binary.LittleEndian, []binaryRecord{{StationID: 42, Temperature: 10}})
+			},
+			expErr: "station id 42 at offset 0 not found in dictionary",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := runString(ctx, tc.data(t), binaryConfig())
+			if err == nil || !strings.Contains(err.Error(), tc.expErr) {
+				t.Errorf("expected error containing %q but got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigBinary(t *testing.T) {
+	cfg := binaryConfig()
+	cfg.Dictionary = ""
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected binary input without a dictionary to be rejected")
+	}
+
+	cfg = binaryConfig()
+	cfg.ByteOrder = "middle"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected an unknown byte order to be rejected")
+	}
+}
+
+func TestRunBinaryTimeout(t *testing.T) {
+	// cycling through the station ids 1 to 10 of the dictionary
+	records := make([]binaryRecord, 500_000)
+	for i := range records {
+		records[i] = binaryRecord{StationID: uint32(i%10 + 1), Temperature: int16(i%1999 - 999)}
+	}
+	cfg := binaryConfig()
+	filePath := writeBinaryRecords(t, binary.LittleEndian, records)
+
+	if _, err := runString(context.Background(), filePath, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Timeout = time.Millisecond
+	_, err := runString(context.Background(), filePath, cfg)
+	if expErr := "timed out after 1ms"; err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg.Timeout = 0
+	if _, err := runString(ctx, filePath, cfg); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func writeBinaryRecords(t *testing.T, order binary.ByteOrder, records []binaryRecord) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "measurements.bin")
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := binary.Write(f, order, records); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
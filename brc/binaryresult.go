@@ -0,0 +1,195 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// binaryResultMagic starts every binary result.
+var binaryResultMagic = [4]byte{'1', 'B', 'R', 'C'}
+
+// binaryResultVersion is the version of the binary result layout written,
+// decoders reject other versions.
+const binaryResultVersion = 1
+
+// binaryResultHeader starts the little-endian binary result format. It is
+// followed by Stations entries, each a uint16 name length, the name bytes and
+// a binaryResultStation.
+type binaryResultHeader struct {
+	Magic     [4]byte
+	Version   uint16
+	Precision uint8
+	Stations  uint32
+}
+
+// binaryResultStation holds the exact aggregates of a station in tenths, or
+// hundredths with a precision of 2.
+type binaryResultStation struct {
+	Min   int64
+	Max   int64
+	Total int64
+	Count int64
+}
+
+// BinaryResult is a decoded binary result.
+type BinaryResult struct {
+	// Precision is the number of decimals of the values, 1 for tenths or 2
+	// for hundredths
+	Precision int
+	Stations  []BinaryStation
+}
+
+// BinaryStation is a station of a BinaryResult. Its values are exact integers
+// in the unit of the result's precision.
+type BinaryStation struct {
+	Name  string
+	Min   int64
+	Max   int64
+	Total int64
+	Count int64
+}
+
+// WriteBinaryResult encodes result to w in the binary result format, with
+// the stations in the order given.
+func WriteBinaryResult(w io.Writer, result BinaryResult) error {
+	if int64(len(result.Stations)) > math.MaxUint32 {
+		return fmt.Errorf("%d stations exceed the binary format limit", len(result.Stations))
+	}
+	if result.Precision != 1 && result.Precision != 2 {
+		return fmt.Errorf("invalid binary result precision %d", result.Precision)
+	}
+
+	buffered := bufio.NewWriter(w)
+	header := binaryResultHeader{
+		Magic:     binaryResultMagic,
+		Version:   binaryResultVersion,
+		Precision: uint8(result.Precision),
+		Stations:  uint32(len(result.Stations)),
+	}
+	// a bufio.Writer keeps its first error, returned by Flush
+	binary.Write(buffered, binary.LittleEndian, header)
+
+	for _, station := range result.Stations {
+		if len(station.Name) > math.MaxUint16 {
+			return fmt.Errorf("location '%s' exceeds the binary format name length limit", station.Name)
+		}
+
+		binary.Write(buffered, binary.LittleEndian, uint16(len(station.Name)))
+		buffered.WriteString(station.Name)
+		binary.Write(buffered, binary.LittleEndian, binaryResultStation{
+			Min:   station.Min,
+			Max:   station.Max,
+			Total: station.Total,
+			Count: station.Count,
+		})
+	}
+	return buffered.Flush()
+}
+
+// createBinaryResult encodes the locations in the binary result format of
+// WriteBinaryResult, in alphabetical order unless cfg.Unordered is set.
+func createBinaryResult(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	if !cfg.Unordered {
+		sortStations(locations)
+	}
+
+	result := BinaryResult{
+		Precision: cfg.Precision,
+		Stations:  make([]BinaryStation, 0, len(locations)),
+	}
+	for _, location := range locations {
+		details, ok := locationMap[location]
+		if !ok {
+			return "", fmt.Errorf("location '%s' found in locations but not in map", location)
+		}
+		result.Stations = append(result.Stations, BinaryStation{
+			Name:  location,
+			Min:   details.Min,
+			Max:   details.Max,
+			Total: details.Total,
+			Count: details.Count,
+		})
+	}
+
+	buffer := bytes.Buffer{}
+	if err := WriteBinaryResult(&buffer, result); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// ReadBinaryResult decodes a result written with -format=binary. Truncated
+// or corrupt input returns an error.
+func ReadBinaryResult(r io.Reader) (BinaryResult, error) {
+	var header binaryResultHeader
+	if err := readBinaryResult(r, &header); err != nil {
+		return BinaryResult{}, err
+	}
+	if header.Magic != binaryResultMagic {
+		return BinaryResult{}, errors.New("not a binary result")
+	}
+	if header.Version != binaryResultVersion {
+		return BinaryResult{}, fmt.Errorf("unsupported binary result version %d", header.Version)
+	}
+	if header.Precision != 1 && header.Precision != 2 {
+		return BinaryResult{}, fmt.Errorf("invalid binary result precision %d", header.Precision)
+	}
+
+	result := BinaryResult{
+		Precision: int(header.Precision),
+		// the count is untrusted until the stations are actually read
+		Stations: make([]BinaryStation, 0, min(header.Stations, 1024)),
+	}
+	seen := make(map[string]bool, cap(result.Stations))
+	for i := uint32(0); i < header.Stations; i++ {
+		var nameLength uint16
+		if err := readBinaryResult(r, &nameLength); err != nil {
+			return BinaryResult{}, err
+		}
+		name := make([]byte, nameLength)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return BinaryResult{}, truncatedBinaryResult(err)
+		}
+		var station binaryResultStation
+		if err := readBinaryResult(r, &station); err != nil {
+			return BinaryResult{}, err
+		}
+
+		if seen[string(name)] {
+			return BinaryResult{}, fmt.Errorf("duplicate station '%s' in binary result", name)
+		}
+		if station.Count < 1 || station.Min > station.Max {
+			return BinaryResult{}, fmt.Errorf("invalid aggregates for station '%s' in binary result", name)
+		}
+		seen[string(name)] = true
+
+		result.Stations = append(result.Stations, BinaryStation{
+			Name:  string(name),
+			Min:   station.Min,
+			Max:   station.Max,
+			Total: station.Total,
+			Count: station.Count,
+		})
+	}
+	return result, nil
+}
+
+func readBinaryResult(r io.Reader, data any) error {
+	if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+		return truncatedBinaryResult(err)
+	}
+	return nil
+}
+
+// truncatedBinaryResult reports an EOF within a binary result as truncation.
+func truncatedBinaryResult(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("truncated binary result: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunBinaryOutput(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Format = formatBinary
+
+		output, err := runString(ctx, measurementsRoundingIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ReadBinaryResult(strings.NewReader(output))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Precision != 1 || len(result.Stations) != 2 {
+			t.Fatalf("(concurrency=%v) expected 2 stations at precision 1 but got %+v", concurrency, result)
+		}
+		// the exact aggregates must give the same output as the text format
+		locations := []string{}
+		locationMap := map[string]Location{}
+		for _, station := range result.Stations {
+			locations = append(locations, station.Name)
+			locationMap[station.Name] = Location{Min: station.Min, Max: station.Max, Total: station.Total, Count: station.Count}
+		}
+		if !reflect.DeepEqual(locations, []string{"ham", "jel"}) {
+			t.Errorf("(concurrency=%v) expected stations in alphabetical order but got %v", concurrency, locations)
+		}
+		if locationMap["ham"].Count != 4 || locationMap["jel"].Count != 20124 {
+			t.Errorf("(concurrency=%v) expected counts 4 and 20124 but got %+v", concurrency, locationMap)
+		}
+		text, err := createResult(locations, locationMap, DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != measurementsRoundingOut {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurementsRoundingOut, text)
+		}
+	}
+}
+
+func TestRealMainBinaryOutput(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	if err := realMain(context.Background(), []string{"1brc", "-quiet", "-format=binary", filePath}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	// stdout holds exactly the encoded result, without a trailing newline
+	cfg := DefaultConfig()
+	cfg.Format = formatBinary
+	expOutput, err := runString(context.Background(), filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != expOutput {
+		t.Errorf("expected %q but got %q", expOutput, stdout.String())
+	}
+}
+
+func TestCreateBinaryResult(t *testing.T) {
+	locations, locationMap := syntheticLocations(1000)
+	locationMap["Zürich"] = Location{Min: -9999, Max: 9999, Total: -1 << 62, Count: 1 << 40}
+	locations = append(locations, "Zürich")
+
+	cfg := DefaultConfig()
+	cfg.Precision = 2
+	encoded, err := createBinaryResult(locations, locationMap, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ReadBinaryResult(strings.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Precision != 2 || len(result.Stations) != len(locations) {
+		t.Fatalf("expected %d stations at precision 2 but got %d at %d", len(locations), len(result.Stations), result.Precision)
+	}
+	for i, station := range result.Stations {
+		if station.Name != locations[i] {
+			t.Fatalf("expected station %d to be %s but got %s", i, locations[i], station.Name)
+		}
+		loc := locationMap[station.Name]
+		if station.Min != loc.Min || station.Max != loc.Max || station.Total != loc.Total || station.Count != loc.Count {
+			t.Errorf("station %s expected %+v but got %+v", station.Name, loc, station)
+		}
+	}
+}
+
+// encodeBinaryResult encodes result with WriteBinaryResult.
+func encodeBinaryResult(tb testing.TB, result BinaryResult) string {
+	tb.Helper()
+
+	buffer := bytes.Buffer{}
+	if err := WriteBinaryResult(&buffer, result); err != nil {
+		tb.Fatal(err)
+	}
+	return buffer.String()
+}
+
+// syntheticResult returns a result of n stations.
+func syntheticResult(n int) BinaryResult {
+	result := BinaryResult{Precision: 1}
+	for i := 0; i < n; i++ {
+		low := int64(i*7%1999 - 999)
+		result.Stations = append(result.Stations, BinaryStation{
+			Name:  fmt.Sprintf("station-%07d", i),
+			Min:   low,
+			Max:   low + 10,
+			Total: (low + 5) * int64(i+1),
+			Count: int64(i + 1),
+		})
+	}
+	return result
+}
+
+func TestBinaryResultRoundTrip(t *testing.T) {
+	result := syntheticResult(1000)
+	result.Precision = 2
+	result.Stations = append(result.Stations, BinaryStation{Name: "Zürich", Min: -9999, Max: 9999, Total: -1 << 62, Count: 1 << 40})
+
+	decoded, err := ReadBinaryResult(strings.NewReader(encodeBinaryResult(t, result)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, result) {
+		t.Errorf("expected the result to survive a round trip but got %d stations at precision %d", len(decoded.Stations), decoded.Precision)
+	}
+}
+
+func TestWriteBinaryResultInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		result BinaryResult
+		expErr string
+	}{
+		{name: "precision", result: BinaryResult{Precision: 3}, expErr: "invalid binary result precision 3"},
+		{
+			name:   "name length",
+			result: BinaryResult{Precision: 1, Stations: []BinaryStation{{Name: strings.Repeat("a", 1<<16), Count: 1}}},
+			expErr: "exceeds the binary format name length limit",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := WriteBinaryResult(io.Discard, tc.result)
+			if err == nil || !strings.Contains(err.Error(), tc.expErr) {
+				t.Errorf("expected error containing %q but got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestReadBinaryResultTruncated(t *testing.T) {
+	encoded := encodeBinaryResult(t, syntheticResult(3))
+
+	for i := 0; i < len(encoded); i++ {
+		if _, err := ReadBinaryResult(strings.NewReader(encoded[:i])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected truncation at %d bytes to return %v but got %v", i, io.ErrUnexpectedEOF, err)
+		}
+	}
+}
+
+func TestReadBinaryResultCorrupt(t *testing.T) {
+	encoded := encodeBinaryResult(t, BinaryResult{Precision: 1, Stations: []BinaryStation{{Name: "a", Min: 1, Max: 2, Total: 3, Count: 2}}})
+	// header: magic 0-3, version 4-5, precision 6, stations 7-10
+	// station: name length 11-12, name 13, min 14-21, max 22-29, total 30-37, count 38-45
+	corrupt := func(offset int, b byte) string {
+		data := []byte(encoded)
+		data[offset] = b
+		return string(data)
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		expErr string
+	}{
+		{name: "magic", input: corrupt(0, 'X'), expErr: "not a binary result"},
+		{name: "version", input: corrupt(4, 2), expErr: "unsupported binary result version 2"},
+		{name: "precision", input: corrupt(6, 3), expErr: "invalid binary result precision 3"},
+		{name: "count", input: corrupt(38, 0), expErr: "invalid aggregates for station 'a' in binary result"},
+		{name: "min above max", input: corrupt(14, 3), expErr: "invalid aggregates for station 'a' in binary result"},
+		{name: "duplicate", input: corrupt(7, 2) + encoded[11:], expErr: "duplicate station 'a' in binary result"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadBinaryResult(strings.NewReader(tc.input))
+			if err == nil || err.Error() != tc.expErr {
+				t.Errorf("expected error %q but got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func FuzzReadBinaryResult(f *testing.F) {
+	encoded := encodeBinaryResult(f, syntheticResult(3))
+	f.Add([]byte(encoded))
+	f.Add([]byte(encoded[:20]))
+	f.Add([]byte("1BRC"))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		result, err := ReadBinaryResult(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// anything accepted must survive a round trip
+		again, err := ReadBinaryResult(strings.NewReader(encodeBinaryResult(t, result)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, again) {
+			t.Fatalf("expected %+v after a round trip but got %+v", result, again)
+		}
+	})
+}
@@ -0,0 +1,2416 @@
+// Package brc aggregates the weather station measurements of the One Billion
+// Row Challenge. Aggregate returns a Result with the min, mean and max of
+// every station, ReadBinaryResult decodes the -format=binary output and Main
+// runs the 1brc-go command line.
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/bits"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// minAutoChunkSize and maxAutoChunkSize bound the chunk size chosen from
+	// the file size when Config.ChunkSize is 0, a smaller file is one chunk
+	minAutoChunkSize = 1 << 20
+	maxAutoChunkSize = 64 << 20
+	// autoChunksPerWorker is how many chunks per worker the automatic chunk
+	// size aims for, so workers finishing early pick up more
+	autoChunksPerWorker = 8
+	// maxChunkSize bounds Config.ChunkSize so a chunk buffer can be allocated
+	// on 32-bit platforms, where int is 32 bits
+	maxChunkSize = math.MaxInt32
+	// parallelFormatThreshold is the station count from which createResult
+	// formats the output across goroutines
+	parallelFormatThreshold = 10_000
+	// ctxCheckInterval is how many lines parseFile, or records
+	// parseBinaryFile, reads between checks for cancellation
+	ctxCheckInterval = 1 << 16
+	// maxNameLength is the default Config.MaxNameLength, the station name
+	// limit of the 1BRC spec
+	maxNameLength = 100
+	// malformedPrefixLength is how much of a malformed line a -strict error
+	// quotes
+	malformedPrefixLength = 64
+	// defaultCheckpointInterval is the default Config.CheckpointInterval, a
+	// checkpoint every GiB of input costs little next to reading it
+	defaultCheckpointInterval = 1 << 30
+	// defaultConcurrencyThreshold is the default Config.ConcurrencyThreshold
+	defaultConcurrencyThreshold = 4 << 20
+	// defaultStationsHint is the default Config.StationsHint, the most
+	// distinct stations the 1BRC rules allow
+	defaultStationsHint = 10_000
+)
+
+// output formats
+const (
+	formatText   = "text"
+	formatCSV    = "csv"
+	formatBinary = "binary"
+	// formatHistogram draws the temperature distribution of each station
+	formatHistogram = "histogram"
+)
+
+// run modes, the parser a run uses as logged in its summary
+const (
+	modeSequential = "sequential"
+	modeConcurrent = "concurrent"
+	modeSharded    = "sharded"
+	modeBinary     = "binary"
+)
+
+// modeValue is the -mode flag, choosing between the sequential and the
+// concurrent parser by setting Config.Concurrency.
+type modeValue struct {
+	cfg *Config
+}
+
+func (m modeValue) String() string {
+	if m.cfg == nil {
+		return ""
+	}
+	return runMode(Config{Concurrency: m.cfg.Concurrency})
+}
+
+func (m modeValue) Set(s string) error {
+	switch s {
+	case modeConcurrent:
+		m.cfg.Concurrency = true
+	case modeSequential:
+		m.cfg.Concurrency = false
+	default:
+		return fmt.Errorf("expected %s or %s", modeConcurrent, modeSequential)
+	}
+	return nil
+}
+
+// Location holds the aggregated readings of a station in tenths of a degree,
+// or hundredths with a Precision of 2.
+//
+// Readings are bounded to ±999.9, which is ±99990 in hundredths, so Total
+// can hold at least math.MaxInt64/99990 (~9.2e13) readings before it could
+// overflow, far beyond the billion rows of the challenge. Merging partial
+// results checks for overflow regardless so a pathological input errors
+// instead of printing a wrapped mean.
+//
+// SumSquares, used for the standard deviation, grows with the square of the
+// readings, up to ~1e10 in hundredths, which would overflow an int64 before
+// a billion readings. It is a 128-bit sum instead, which can't overflow
+// before Count does.
+type Location struct {
+	Min        int64
+	Max        int64
+	Total      int64
+	Count      int64
+	SumSquares sumSquares
+	// Histogram is only tracked when percentiles or a histogram export are
+	// requested
+	Histogram *histogram
+}
+
+// Config holds the options of a run.
+type Config struct {
+	// Concurrency selects parseFileWithConcurrency over parseFile
+	Concurrency bool
+	// ConcurrencyThreshold is the input size in bytes below which text input
+	// is parsed with parseFile even with Concurrency, the goroutines costing
+	// more than they save on a small file. 0 never falls back.
+	ConcurrencyThreshold int64
+	// ChunkSize is the number of bytes parseFileWithConcurrency hands each
+	// worker, chunks are shortened to end on a line boundary. It is chosen
+	// from the file size and GOMAXPROCS when 0
+	ChunkSize int64
+	// Format is the output format, text or csv
+	Format string
+	// Delimiter separates the station name from the temperature
+	Delimiter byte
+	// Precision is the number of decimals temperatures are aggregated and
+	// printed with, 1 for tenths or 2 for hundredths
+	Precision int
+	// InputFormat is the input format, text or binary
+	InputFormat string
+	// Dictionary is the path of the station id to name sidecar file used by
+	// the binary input format
+	Dictionary string
+	// ByteOrder is the byte order of binary input, little or big
+	ByteOrder string
+	// Timeout aborts the run when it takes longer, 0 disables it
+	Timeout time.Duration
+	// InputHash is the algorithm used to hash the consumed input, sha256 or
+	// xxh3, empty disables hashing
+	InputHash string
+	// Round is the rounding mode of the mean: half-up, half-even, floor or
+	// ceil
+	Round string
+	// StdDev appends the population standard deviation of each station to
+	// the output
+	StdDev bool
+	// Count appends the reading count of each station to the text output as
+	// " (count=N)", CSV always has a count column
+	Count bool
+	// Percentiles are appended to the output of each station, tracking them
+	// costs a histogram per station
+	Percentiles []float64
+	// MinCount excludes stations with fewer readings from the output
+	MinCount int64
+	// HistogramOut is the path the per-station histograms are written to as
+	// CSV, none when empty
+	HistogramOut string
+	// HistogramBucket is the bucket width of the exported histograms and the
+	// histogram format in tenths
+	HistogramBucket int
+	// Station limits the histogram format to the station of this name, every
+	// station when empty
+	Station string
+	// Checkpoint is the path the aggregation state is saved to after the run,
+	// none when empty. The concurrent engine also saves it every
+	// CheckpointInterval bytes, along with the offset of the input aggregated
+	// so far.
+	Checkpoint string
+	// CheckpointInterval is the number of input bytes between the periodic
+	// checkpoints of a concurrent run, 0 only saves it after the run
+	CheckpointInterval int64
+	// Resume is the path of a checkpoint merged into the run, none when empty.
+	// A periodic checkpoint of an interrupted run continues the same input
+	// from its offset instead.
+	Resume string
+	// AllowIntegerTemps accepts temperatures without a fractional part, 12 is
+	// read as 12.0
+	AllowIntegerTemps bool
+	// Quoted allows station names in double quotes to contain the delimiter
+	Quoted bool
+	// Unit is the output temperature unit, c or f, aggregation is always in
+	// Celsius
+	Unit string
+	// Unordered skips tracking and sorting the stations, they are output in
+	// map order
+	Unordered bool
+	// Top replaces the output with the Top stations with the highest and the
+	// lowest mean when positive
+	Top int
+	// Sharded has the concurrent workers add their lines to a map sharded by
+	// station name under a lock per shard, with no per-chunk maps to merge
+	Sharded bool
+	// FastMap has the concurrent workers accumulate their chunks in a
+	// stationTable, a flat hash table with linear probing, instead of a Go map
+	FastMap bool
+	// AdaptiveChunks sizes the chunks after the first to hold as many lines
+	// as ChunkSize holds lines of the typical 1BRC length, estimating the
+	// line length from the first chunk
+	AdaptiveChunks bool
+	// NoPrescan skips estimating the station count to pre-size the maps
+	NoPrescan bool
+	// StationsHint is the station count the aggregation maps are pre-sized
+	// for, replaced by the prescan estimate for the top-level map of large
+	// inputs. 0 starts the maps empty.
+	StationsHint int
+	// MaxStations is the most distinct stations a run may aggregate, checked
+	// with the other invariants before the output. 0 doesn't limit them.
+	MaxStations int
+	// DecimalComma reads temperatures with ',' as the decimal separator, the
+	// output always uses '.'
+	DecimalComma bool
+	// NearDuplicateReport finds the station names that only differ in
+	// normalization, case or surrounding whitespace, without changing the
+	// output
+	NearDuplicateReport bool
+	// MaxNameLength is the longest station name in bytes, a line with a
+	// longer one is malformed. Such names usually come from lines glued
+	// together by a missing newline.
+	MaxNameLength int
+	// Strict fails the run on the first malformed line instead of skipping
+	// it. A temperature with a single decimal at a Precision of 2 is
+	// malformed rather than normalized to hundredths
+	Strict bool
+	// Readers is the number of goroutines reading the chunks of a concurrent
+	// run in order for GOMAXPROCS parsing goroutines. At 0 every chunk is read
+	// by the goroutine parsing it, which interleaves the reads.
+	Readers int
+	// Range limits the input to the bytes start:length of the file, its
+	// bounds moved back to line boundaries, none when empty
+	Range string
+	// Fadvise hints the kernel that the input is read sequentially and, in
+	// the chunked engines, drops the parsed input from the page cache
+	Fadvise bool
+	// SampleRate is the fraction of lines aggregated, in (0, 1]. Below 1 the
+	// result is an estimate from a deterministic sample of the lines, with
+	// the counts scaled down accordingly. Lines left out of the sample
+	// aren't parsed, so they are neither skipped nor fail a -strict run.
+	SampleRate float64
+}
+
+// RunStats describes what a run processed.
+type RunStats struct {
+	// InputHash is the hex encoded hash of the bytes the run consumed, set
+	// when Config.InputHash is
+	InputHash string
+	// ExcludedStations is the number of stations left out of the output for
+	// having fewer than Config.MinCount readings
+	ExcludedStations int
+	// Mode is the parser the run used, see runMode
+	Mode string
+	// Lines is the number of lines of text input aggregated
+	Lines int64
+	// Stations is the number of distinct stations aggregated, including
+	// those ExcludedStations counts
+	Stations int
+	// Bytes and Rows are the input bytes and the readings parsed in
+	// ParseDuration, excluding those of the checkpoint resumed from
+	Bytes         int64
+	Rows          int64
+	ParseDuration time.Duration
+	// SkippedLines is the number of non-empty lines dropped as invalid, such
+	// as lines without a delimiter or with a malformed temperature
+	SkippedLines int64
+	// IntegerTemps is the number of temperatures without a fractional part
+	// accepted with Config.AllowIntegerTemps
+	IntegerTemps int64
+	// NearDuplicates are the groups of near duplicate station names, set
+	// when Config.NearDuplicateReport is
+	NearDuplicates []nearDuplicate
+	// Partial is set when the input shrank during a lenient run, the result
+	// then only covers the Bytes read before
+	Partial bool
+}
+
+// chunkSizeFor returns ChunkSize, or when it's 0 the chunk size for a file
+// of fileSize bytes: fileSize split into autoChunksPerWorker chunks per
+// GOMAXPROCS, within minAutoChunkSize and maxAutoChunkSize.
+func (cfg Config) chunkSizeFor(fileSize int64) int64 {
+	if cfg.ChunkSize > 0 {
+		return cfg.ChunkSize
+	}
+	return autoChunkSize(fileSize, runtime.GOMAXPROCS(0))
+}
+
+// autoChunkSize returns the chunk size of a file of fileSize bytes read by
+// workers.
+func autoChunkSize(fileSize int64, workers int) int64 {
+	size := fileSize / (int64(workers) * autoChunksPerWorker)
+	return min(max(size, minAutoChunkSize), maxAutoChunkSize)
+}
+
+// decimalSeparator returns the decimal separator of the temperatures.
+func (cfg Config) decimalSeparator() byte {
+	if cfg.DecimalComma {
+		return ','
+	}
+	return '.'
+}
+
+// DefaultConfig returns the options of a command line run without flags, the
+// Config to start from when calling Aggregate.
+func DefaultConfig() Config {
+	return Config{
+		Concurrency:          true,
+		Format:               formatText,
+		Delimiter:            ';',
+		Precision:            1,
+		InputFormat:          inputFormatText,
+		ByteOrder:            "little",
+		Round:                roundHalfUp,
+		Unit:                 unitCelsius,
+		HistogramBucket:      10,
+		MaxNameLength:        maxNameLength,
+		SampleRate:           1,
+		CheckpointInterval:   defaultCheckpointInterval,
+		StationsHint:         defaultStationsHint,
+		ConcurrencyThreshold: defaultConcurrencyThreshold,
+	}
+}
+
+func validateConfig(cfg Config) error {
+	switch cfg.Format {
+	case formatText, formatCSV:
+	case formatBinary:
+		// the binary format carries the exact Celsius aggregates only
+		if cfg.Unit != unitCelsius || cfg.Top > 0 {
+			return fmt.Errorf("%s format doesn't support -unit or -top", formatBinary)
+		}
+	case formatHistogram:
+		// the buckets are cut from the Celsius histogram in tenths
+		if cfg.Unit != unitCelsius || cfg.Top > 0 {
+			return fmt.Errorf("%s format doesn't support -unit or -top", formatHistogram)
+		}
+		if cfg.Precision != 1 || cfg.InputFormat != inputFormatText {
+			return fmt.Errorf("%s format is only supported for text input with a precision of 1", formatHistogram)
+		}
+	default:
+		return fmt.Errorf("unknown format '%s', expected %s, %s, %s or %s", cfg.Format, formatText, formatCSV, formatBinary, formatHistogram)
+	}
+	if cfg.Station != "" && cfg.Format != formatHistogram {
+		return fmt.Errorf("-station is only supported with the %s format", formatHistogram)
+	}
+	switch cfg.InputFormat {
+	case inputFormatText:
+	case inputFormatBinary:
+		if cfg.Dictionary == "" {
+			return fmt.Errorf("%s input format requires a dictionary", inputFormatBinary)
+		}
+		if _, err := byteOrder(cfg.ByteOrder); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown input format '%s', expected %s or %s", cfg.InputFormat, inputFormatText, inputFormatBinary)
+	}
+	switch cfg.Round {
+	case roundHalfUp, roundHalfEven, roundFloor, roundCeil:
+	default:
+		return fmt.Errorf("unknown rounding mode '%s', expected %s, %s, %s or %s", cfg.Round, roundHalfUp, roundHalfEven, roundFloor, roundCeil)
+	}
+	if _, err := newInputHasher(cfg.InputHash); err != nil {
+		return err
+	}
+	for _, p := range cfg.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentile %v, expected a value in (0, 100]", p)
+		}
+	}
+	if len(cfg.Percentiles) > 0 && (cfg.Precision != 1 || cfg.InputFormat != inputFormatText) {
+		return errors.New("percentiles are only supported for text input with a precision of 1")
+	}
+	if cfg.HistogramOut != "" && (cfg.Precision != 1 || cfg.InputFormat != inputFormatText) {
+		return errors.New("histogram export is only supported for text input with a precision of 1")
+	}
+	if cfg.HistogramBucket < 1 {
+		return fmt.Errorf("invalid histogram bucket width %d", cfg.HistogramBucket)
+	}
+	switch cfg.Unit {
+	case unitCelsius, unitFahrenheit:
+	default:
+		return fmt.Errorf("invalid unit %q, expected %s or %s", cfg.Unit, unitCelsius, unitFahrenheit)
+	}
+	if cfg.ChunkSize < 0 || cfg.ChunkSize > maxChunkSize {
+		return fmt.Errorf("invalid chunk size %d, expected 0 to choose it from the file size or 1 to %d bytes", cfg.ChunkSize, int64(maxChunkSize))
+	}
+	if cfg.Top < 0 {
+		return fmt.Errorf("invalid top %d", cfg.Top)
+	}
+	if cfg.MaxNameLength < 1 {
+		return fmt.Errorf("invalid max name length %d", cfg.MaxNameLength)
+	}
+	if !(cfg.SampleRate > 0 && cfg.SampleRate <= 1) {
+		return fmt.Errorf("invalid sample rate %v, expected a value in (0, 1]", cfg.SampleRate)
+	}
+	if cfg.SampleRate < 1 && cfg.InputFormat != inputFormatText {
+		return errors.New("sampling is only supported for text input")
+	}
+	if cfg.Range != "" {
+		if _, _, err := parseRange(cfg.Range); err != nil {
+			return err
+		}
+		if !cfg.Concurrency || cfg.InputFormat != inputFormatText {
+			return errors.New("-range is only supported for text input in the concurrent mode")
+		}
+	}
+	if cfg.ConcurrencyThreshold < 0 {
+		return fmt.Errorf("invalid concurrency threshold %d", cfg.ConcurrencyThreshold)
+	}
+	if cfg.StationsHint < 0 {
+		return fmt.Errorf("invalid stations hint %d", cfg.StationsHint)
+	}
+	if cfg.MaxStations < 0 {
+		return fmt.Errorf("invalid max stations %d", cfg.MaxStations)
+	}
+	if cfg.Readers < 0 {
+		return fmt.Errorf("invalid readers %d", cfg.Readers)
+	}
+	if cfg.CheckpointInterval < 0 {
+		return fmt.Errorf("invalid checkpoint interval %d", cfg.CheckpointInterval)
+	}
+	if cfg.MinCount < 0 {
+		return fmt.Errorf("invalid min count %d", cfg.MinCount)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s", cfg.Timeout)
+	}
+	if cfg.Precision != 1 && cfg.Precision != 2 {
+		return fmt.Errorf("invalid precision %d, expected 1 or 2", cfg.Precision)
+	}
+	// the delimiter can't be a byte that may appear in a temperature or end a line
+	switch d := cfg.Delimiter; {
+	case d == '\n', d == '\r', d == '.', d == '-', isDigit(d), d == '"' && cfg.Quoted:
+		return fmt.Errorf("invalid delimiter %q", d)
+	case d == ',' && cfg.DecimalComma:
+		return errors.New("a ',' delimiter can't be combined with -decimal-comma")
+	}
+	return nil
+}
+
+// Main runs the 1brc-go command line with args, the first being the command
+// name, and returns the exit code of the process. See realMain.
+func Main(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	err := realMain(ctx, args, stdout, stderr)
+	// the flag set already printed the usage for -help
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error(err.Error(), failureAttrs(err)...)
+	}
+	return exitCode(err)
+}
+
+// delimiterFlag returns the setter of a -delimiter flag updating cfg.
+func delimiterFlag(cfg *Config) func(string) error {
+	return func(s string) error {
+		if len(s) != 1 {
+			return fmt.Errorf("delimiter must be a single byte, got %q", s)
+		}
+		cfg.Delimiter = s[0]
+		return nil
+	}
+}
+
+// realMain runs the command line with args, writing the result to stdout and
+// logs to stderr so the result can be piped on its own. A first argument of
+// determinism runs the determinism check instead, and one of compare diffs
+// two results. The returned error carries the exit code of the failure, see
+// exitCode.
+func realMain(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) > 1 && args[1] == "determinism" {
+		return determinismMain(ctx, args[1:], stdout, stderr)
+	}
+	if len(args) > 1 && args[1] == "compare" {
+		return compareMain(args[1:], stdout, stderr)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timeStart := time.Now()
+
+	cfg := DefaultConfig()
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = usage(flags)
+	flags.StringVar(&cfg.Format, "format", cfg.Format, "output format: text, csv, binary or histogram")
+	flags.Int64Var(&cfg.ChunkSize, "chunk-size", cfg.ChunkSize, "bytes per chunk of the concurrent engine, 0 chooses it from the file size and GOMAXPROCS")
+	flags.Func("delimiter", "single byte separating station and temperature (default \";\")", delimiterFlag(&cfg))
+	flags.IntVar(&cfg.Precision, "precision", cfg.Precision, "decimals of the temperatures: 1 for tenths or 2 for hundredths")
+	decimals := flags.Int("decimals", cfg.Precision, "alias for -precision, the two may only both be given with the same value")
+	flags.StringVar(&cfg.InputFormat, "input-format", cfg.InputFormat, "input format: text or binary")
+	flags.StringVar(&cfg.Dictionary, "dictionary", cfg.Dictionary, "station id to name file for binary input")
+	flags.StringVar(&cfg.ByteOrder, "byte-order", cfg.ByteOrder, "byte order of binary input: little or big")
+	flags.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "abort the run after this duration, e.g. 30s (0 disables)")
+	flags.StringVar(&cfg.Round, "round", cfg.Round, "rounding mode of the mean: half-up, half-even, floor or ceil")
+	flags.BoolVar(&cfg.StdDev, "stddev", cfg.StdDev, "append the population standard deviation of each station")
+	flags.BoolVar(&cfg.Count, "count", cfg.Count, "append the reading count of each station as (count=N)")
+	flags.Func("percentiles", "comma separated percentiles to append to each station, e.g. 50,90,99", func(s string) error {
+		percentiles, err := parsePercentiles(s)
+		cfg.Percentiles = percentiles
+		return err
+	})
+	flags.Int64Var(&cfg.MinCount, "min-count", cfg.MinCount, "exclude stations with fewer readings from the output")
+	flags.StringVar(&cfg.Checkpoint, "checkpoint", cfg.Checkpoint, "save the aggregation state to this path after the run, and periodically during a concurrent run")
+	flags.Int64Var(&cfg.CheckpointInterval, "checkpoint-interval", cfg.CheckpointInterval, "input bytes between the periodic checkpoints of a concurrent run, 0 only saves after the run")
+	flags.StringVar(&cfg.Resume, "resume", cfg.Resume, "merge the aggregation state of a checkpoint into the run, or continue the input of an interrupted run from its periodic checkpoint")
+	flags.BoolVar(&cfg.AllowIntegerTemps, "allow-integer-temps", cfg.AllowIntegerTemps, "accept temperatures without a fractional part such as 12 as 12.0")
+	flags.BoolVar(&cfg.Quoted, "quoted", cfg.Quoted, "allow double quoted station names containing the delimiter")
+	flags.StringVar(&cfg.Unit, "unit", cfg.Unit, "output temperature unit: c for Celsius or f for Fahrenheit")
+	flags.BoolVar(&cfg.Unordered, "unordered", cfg.Unordered, "output stations in no particular order, skipping the sort")
+	flags.IntVar(&cfg.Top, "top", cfg.Top, "only output the N stations with the highest and the N with the lowest mean")
+	flags.StringVar(&cfg.HistogramOut, "histogram-out", cfg.HistogramOut, "write the per-station histograms as station,bucket,count CSV to this path")
+	flags.IntVar(&cfg.HistogramBucket, "histogram-bucket", cfg.HistogramBucket, "bucket width of the exported histograms and the histogram format in tenths of a degree")
+	flags.StringVar(&cfg.Station, "station", cfg.Station, "only draw the histogram of this station with -format histogram")
+	flags.BoolVar(&cfg.DecimalComma, "decimal-comma", cfg.DecimalComma, "read temperatures with a decimal comma such as 12,3, the output keeps the decimal point")
+	flags.BoolVar(&cfg.NearDuplicateReport, "near-duplicate-report", cfg.NearDuplicateReport, "log station names equal after NFC normalization, case folding and trimming")
+	flags.IntVar(&cfg.MaxNameLength, "max-name-length", cfg.MaxNameLength, "treat lines with longer station names in bytes as malformed")
+	flags.Float64Var(&cfg.SampleRate, "sample-rate", cfg.SampleRate, "aggregate only this fraction of the lines, picked by a hash of each line, for an approximate result")
+	flags.BoolVar(&cfg.Strict, "strict", cfg.Strict, "fail on the first malformed line instead of skipping it")
+	flags.Var(modeValue{&cfg}, "mode", "`parser` to use: concurrent or sequential, an explicit concurrent mode also parses small inputs concurrently unless -concurrency-threshold is set")
+	flags.Int64Var(&cfg.ConcurrencyThreshold, "concurrency-threshold", cfg.ConcurrencyThreshold, "parse text input smaller than this many bytes sequentially, 0 always parses concurrently")
+	flags.BoolVar(&cfg.Sharded, "sharded", cfg.Sharded, "have the concurrent workers update a map sharded by station instead of merging per-chunk maps")
+	flags.BoolVar(&cfg.FastMap, "fast-map", cfg.FastMap, "have the concurrent workers accumulate chunks in a linear probing hash table instead of a Go map")
+	flags.StringVar(&cfg.Range, "range", cfg.Range, "only aggregate the `start:length` bytes of the file, snapped back to line boundaries, to split it across runs")
+	flags.BoolVar(&cfg.Fadvise, "fadvise", cfg.Fadvise, "advise the kernel of the sequential read and drop the parsed input from the page cache, where supported")
+	flags.IntVar(&cfg.Readers, "readers", cfg.Readers, "read the chunks of a concurrent run in order with this many goroutines, handing them to GOMAXPROCS parsers (0 reads in every parser)")
+	flags.BoolVar(&cfg.AdaptiveChunks, "adaptive-chunks", cfg.AdaptiveChunks, "scale the chunk size by the average line length sampled from the first chunk")
+	flags.BoolVar(&cfg.NoPrescan, "no-prescan", cfg.NoPrescan, "skip sampling the input to estimate the station count")
+	flags.IntVar(&cfg.StationsHint, "stations-hint", cfg.StationsHint, "pre-size the aggregation maps for this many stations, the prescan of large inputs estimates it instead (0 starts them empty)")
+	flags.IntVar(&cfg.MaxStations, "max-stations", cfg.MaxStations, "fail the run as an internal error when it aggregates more distinct stations than this (0 for no limit)")
+	flags.StringVar(&cfg.InputHash, "input-hash", cfg.InputHash, "hash the consumed input with this algorithm: sha256, or the faster non-cryptographic xxh3 (default off)")
+	expvarAddr := flags.String("expvar-addr", "", "serve the processing metrics at /debug/vars on this address, e.g. localhost:6060")
+	repeat := flags.Int("repeat", 1, "run the aggregation this many times and log min, median and max wall time")
+	warmup := flags.Int("warmup", 0, "untimed warmup iterations of -repeat")
+	verify := flags.Bool("verify", false, "compare the sequential and concurrent results station by station instead of printing the result")
+	fallbackOnMismatch := flags.Bool("fallback-on-mismatch", false, "with -verify, print the result instead of the comparison, falling back to the sequential result with a warning and exit code 8 when the results differ")
+	dryRunInput := flags.Bool("dry-run", false, "only validate the lines of the file, reporting the first invalid line numbers")
+	validateInput := flags.Bool("validate", false, "only check every line is a station name within -max-name-length and a temperature in [-99.9, 99.9], reporting the malformed lines by defect")
+	profileDir := flags.String("profile-dir", "", "directory the CPU profile is written to (default the working directory)")
+	profileOverwrite := flags.Bool("profile-overwrite", false, "overwrite an existing CPU profile rather than adding a -N suffix to the name")
+	configPath := flags.String("config", "", "read options from this JSON config file, flags override it")
+	printCfg := flags.Bool("print-config", false, "print the effective options as a JSON config file and exit")
+	version := flags.Bool("version", false, "print the build version and exit")
+	logFormat := flags.String("log-format", "text", "format of the stderr logs: text or json")
+	logLevel := flags.String("log-level", "info", "minimum level logged to stderr: debug, info, warn or error")
+	verbose := flags.Bool("v", false, "log at debug level, same as -log-level=debug")
+	quiet := flags.Bool("quiet", false, "only log errors, same as -log-level=error")
+	flags.BoolVar(quiet, "q", false, "shorthand for -quiet")
+	if err := flags.Parse(args[1:]); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *configPath != "" {
+		fileCfg, err := loadConfig(*configPath)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		// parsing the flags again over the config file lets the flags set on
+		// the command line override it
+		cfg = fileCfg
+		if err := flags.Parse(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if explicit["decimals"] {
+		if explicit["precision"] && *decimals != cfg.Precision {
+			return withExitCode(exitUsage, fmt.Errorf("-precision=%d conflicts with -decimals=%d", cfg.Precision, *decimals))
+		}
+		cfg.Precision = *decimals
+	}
+	// an explicit concurrent mode forces the concurrent parser
+	if explicit["mode"] && cfg.Concurrency && !explicit["concurrency-threshold"] {
+		cfg.ConcurrencyThreshold = 0
+	}
+	if *printCfg {
+		if err := validateConfig(cfg); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		return printConfig(stdout, cfg)
+	}
+	if *version {
+		fmt.Fprintln(stdout, readBuildVersion())
+		return nil
+	}
+
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	// quiet wins over verbose so scripts can always silence the logs
+	if *quiet {
+		level = slog.LevelError
+	}
+	var handler slog.Handler
+	switch *logFormat {
+	case "text":
+		handler = slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level})
+	case "json":
+		handler = slog.NewJSONHandler(stderr, &slog.HandlerOptions{Level: level})
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("invalid log format %q, expected text or json", *logFormat))
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	if flags.NArg() < 1 {
+		return withExitCode(exitUsage, errors.New("need to supply file"))
+	}
+	filePath := flags.Arg(0)
+
+	if err := validateConfig(cfg); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *repeat < 1 || *warmup < 0 || *warmup >= *repeat {
+		return withExitCode(exitUsage, fmt.Errorf("invalid -repeat %d with -warmup %d, expected at least one timed iteration", *repeat, *warmup))
+	}
+
+	if *expvarAddr != "" {
+		listener, err := serveMetrics(*expvarAddr)
+		if err != nil {
+			return fmt.Errorf("serving metrics: %w", err)
+		}
+		defer listener.Close()
+	}
+
+	if *dryRunInput {
+		return runDryRun(ctx, filePath, cfg, stdout)
+	}
+	if *validateInput {
+		return runValidate(ctx, filePath, cfg, stdout)
+	}
+	if *fallbackOnMismatch && !*verify {
+		return withExitCode(exitUsage, errors.New("-fallback-on-mismatch requires -verify"))
+	}
+	if *verify {
+		return runVerify(ctx, filePath, cfg, stdout, *fallbackOnMismatch)
+	}
+
+	// create file for profile
+	mode := runMode(cfg)
+	if fileInfo, err := os.Stat(filePath); err == nil && cfg.Resume == "" && cfg.fallsBackToSequential(fileInfo.Size()) {
+		mode = modeSequential
+	}
+	f, err := createProfile(*profileDir, filePath, mode, *profileOverwrite)
+	if err != nil {
+		return fmt.Errorf("unable to create file for cpu pprof: %w", err)
+	}
+	defer f.Close()
+	slog.Info("cpu profile", slog.String("path", f.Name()))
+
+	// start CPU profiling
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+	defer pprof.StopCPUProfile()
+
+	output := &errRecorder{w: stdout}
+	buffered := bufio.NewWriter(output)
+	var stats RunStats
+	if *repeat > 1 {
+		var result string
+		var durations []time.Duration
+		result, stats, durations, err = repeatRuns(ctx, filePath, cfg, *repeat, *warmup)
+		if err != nil {
+			return err
+		}
+		if err := logDurations(ctx, filePath, durations, *warmup); err != nil {
+			return err
+		}
+		_, err = buffered.WriteString(result)
+	} else {
+		stats, err = run(ctx, buffered, filePath, cfg)
+	}
+	// a partial result is written before failing with its exit code
+	partialErr := err
+	if stats.Partial {
+		err = nil
+	}
+	// csv output already ends in a newline
+	if err == nil && cfg.Format == formatText {
+		err = buffered.WriteByte('\n')
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if output.err != nil {
+		return withExitCode(exitOutput, fmt.Errorf("writing result: %w", output.err))
+	}
+	if err != nil {
+		return err
+	}
+	if stats.Partial {
+		return partialErr
+	}
+
+	mode = stats.Mode
+	workers := 1
+	if mode == modeConcurrent || mode == modeSharded {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunkSize := cfg.ChunkSize
+	if fileInfo, err := os.Stat(filePath); err == nil {
+		chunkSize = cfg.chunkSizeFor(fileInfo.Size())
+	}
+	attrs := []any{
+		slog.Float64("durationSeconds", time.Since(timeStart).Seconds()),
+		slog.String("inputPath", filePath),
+		slog.String("mode", mode),
+		slog.Int("workers", workers),
+		slog.Int64("chunkSize", chunkSize),
+		readBuildVersion().attr(),
+	}
+	if stats.InputHash != "" {
+		attrs = append(attrs, slog.String("inputHash", cfg.InputHash+":"+stats.InputHash))
+	}
+	if cfg.MinCount > 0 {
+		attrs = append(attrs, slog.Int("excludedStations", stats.ExcludedStations))
+	}
+	if cfg.InputFormat == inputFormatText {
+		attrs = append(attrs, slog.Int64("lines", stats.Lines))
+	}
+	attrs = append(attrs, slog.Int64("skippedLines", stats.SkippedLines), slog.Int("stations", stats.Stations))
+	attrs = append(attrs, slog.Int64("bytes", stats.Bytes), slog.Int64("rows", stats.Rows))
+	if seconds := stats.ParseDuration.Seconds(); seconds > 0 {
+		attrs = append(attrs,
+			slog.Float64("mbPerSecond", float64(stats.Bytes)/1e6/seconds),
+			slog.Float64("rowsPerSecond", float64(stats.Rows)/seconds))
+	}
+	if cfg.AllowIntegerTemps {
+		attrs = append(attrs, slog.Int64("integerTemps", stats.IntegerTemps))
+	}
+	if stats.SkippedLines > 0 {
+		slog.WarnContext(ctx, "skipped invalid lines", slog.Int64("count", stats.SkippedLines))
+	}
+	if cfg.NearDuplicateReport {
+		for _, duplicate := range stats.NearDuplicates {
+			slog.WarnContext(ctx, "near-duplicate stations",
+				slog.String("folded", duplicate.Folded),
+				slog.Any("stations", duplicate.Names),
+				slog.Any("counts", duplicate.Counts))
+		}
+		attrs = append(attrs, slog.Int("nearDuplicates", len(stats.NearDuplicates)))
+	}
+	slog.InfoContext(ctx, "success", attrs...)
+	return nil
+}
+
+// fallsBackToSequential reports whether text input of fileSize bytes is
+// parsed with parseFile despite Concurrency, see ConcurrencyThreshold.
+func (cfg Config) fallsBackToSequential(fileSize int64) bool {
+	return cfg.Concurrency && cfg.InputFormat == inputFormatText && fileSize < cfg.ConcurrencyThreshold
+}
+
+// runMode describes which parser a run with cfg uses.
+func runMode(cfg Config) string {
+	switch {
+	case cfg.InputFormat == inputFormatBinary:
+		return modeBinary
+	case cfg.Concurrency && cfg.Sharded:
+		return modeSharded
+	case cfg.Concurrency:
+		return modeConcurrent
+	}
+	return modeSequential
+}
+
+// parseLogLevel parses a -log-level value.
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", s)
+}
+
+// run aggregates the file at filePath and writes the result to w, the text
+// format is written station by station rather than built in memory first.
+func run(ctx context.Context, w io.Writer, filePath string, cfg Config) (RunStats, error) {
+	locations, locationMap, stats, err := aggregate(ctx, filePath, cfg)
+	if err != nil && !stats.Partial {
+		return stats, err
+	}
+	// a partial result is still written, returning the error it comes with
+	partialErr := err
+
+	if err := writeFormatted(w, locations, locationMap, cfg); err != nil {
+		return stats, err
+	}
+	if stats.Partial && cfg.Top == 0 && cfg.Format == formatText {
+		if _, err := io.WriteString(w, partialMarker); err != nil {
+			return stats, err
+		}
+	}
+	return stats, partialErr
+}
+
+// writeFormatted writes the result of the locations to w in the format of
+// cfg.
+func writeFormatted(w io.Writer, locations []string, locationMap map[string]Location, cfg Config) error {
+	var result string
+	var err error
+	if cfg.Top > 0 {
+		result, err = createTopResult(locations, locationMap, cfg)
+	} else if cfg.Format == formatCSV {
+		result, err = createCSVResult(locations, locationMap, cfg)
+	} else if cfg.Format == formatBinary {
+		result, err = createBinaryResult(locations, locationMap, cfg)
+	} else if cfg.Format == formatHistogram {
+		result, err = createHistogramResult(locations, locationMap, cfg)
+	} else {
+		return writeResult(w, locations, locationMap, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, result)
+	return err
+}
+
+// partialMarker follows the text result of a partial run.
+const partialMarker = " (partial)"
+
+// runWithStats is run returning the result as a string, along with the
+// error of a partial result.
+func runWithStats(ctx context.Context, filePath string, cfg Config) (string, RunStats, error) {
+	buffer := bytes.Buffer{}
+	stats, err := run(ctx, &buffer, filePath, cfg)
+	if err != nil && !stats.Partial {
+		return "", stats, err
+	}
+	return buffer.String(), stats, err
+}
+
+// runString is runWithStats without the statistics.
+func runString(ctx context.Context, filePath string, cfg Config) (string, error) {
+	result, _, err := runWithStats(ctx, filePath, cfg)
+	return result, err
+}
+
+// errRecorder keeps the first error writing to w, telling a failed write of
+// the result apart from a failed run.
+type errRecorder struct {
+	w   io.Writer
+	err error
+}
+
+func (r *errRecorder) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.w.Write(p)
+	r.err = err
+	return n, err
+}
+
+// aggregate parses the file at filePath into its stations, merging a resumed
+// checkpoint and applying the filters of cfg, but leaves formatting the
+// result to the caller.
+func aggregate(ctx context.Context, filePath string, cfg Config) ([]string, map[string]Location, RunStats, error) {
+	stats := RunStats{}
+	if err := validateConfig(cfg); err != nil {
+		return nil, nil, stats, err
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	hasher, err := newInputHasher(cfg.InputHash)
+	if err != nil {
+		return nil, nil, stats, err
+	}
+
+	// load the checkpoint first so a bad one fails before processing
+	var resume checkpoint
+	if cfg.Resume != "" {
+		if resume, err = loadCheckpoint(cfg.Resume, cfg); err != nil {
+			return nil, nil, stats, fmt.Errorf("resuming: %w", err)
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, stats, withExitCode(exitInput, err)
+	}
+	defer f.Close()
+	if cfg.Fadvise {
+		adviseInput(f)
+	}
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, nil, stats, withExitCode(exitInput, err)
+	}
+
+	var input source = f
+	inputSize := fileInfo.Size() - resume.Offset
+	if cfg.Range != "" {
+		if resume.Offset > 0 {
+			return nil, nil, stats, withExitCode(exitUsage, errors.New("resuming an interrupted run doesn't support -range"))
+		}
+		start, length, _ := parseRange(cfg.Range)
+		r, err := newRangeSource(f, start, length)
+		if err != nil {
+			return nil, nil, stats, withExitCode(exitInput, err)
+		}
+		slog.Debug("range", slog.Int64("start", r.start), slog.Int64("end", r.end))
+		input, inputSize = r, r.end-r.start
+	}
+
+	// a small input is faster to parse sequentially, unless resuming from
+	// an offset or reading a range which need the concurrent engine
+	if resume.Offset == 0 && cfg.Range == "" && cfg.fallsBackToSequential(fileInfo.Size()) {
+		slog.Debug("parsing a small input sequentially", slog.Int64("fileSize", fileInfo.Size()), slog.Int64("concurrencyThreshold", cfg.ConcurrencyThreshold))
+		cfg.Concurrency = false
+	}
+	stats.Mode = runMode(cfg)
+
+	// only the concurrent engine checkpoints periodically and resumes from
+	// an offset, the offsets being those of the whole file
+	chunked := cfg.InputFormat == inputFormatText && cfg.Concurrency && !cfg.Sharded && cfg.Range == ""
+	var cp *checkpointer
+	if resume.Offset > 0 {
+		if !chunked {
+			return nil, nil, stats, withExitCode(exitUsage, errors.New("resuming an interrupted run requires the concurrent engine"))
+		}
+		if cp, err = resumeCheckpointer(f, resume, cfg); err != nil {
+			return nil, nil, stats, fmt.Errorf("resuming: %w", err)
+		}
+	} else if chunked && cfg.Checkpoint != "" && cfg.CheckpointInterval > 0 {
+		if cp, err = newCheckpointer(f, cfg); err != nil {
+			return nil, nil, stats, withExitCode(exitInput, err)
+		}
+	}
+
+	var locations []string
+	var locationMap map[string]Location
+	var scan scanStats
+	parseStart := time.Now()
+	if cfg.InputFormat == inputFormatBinary {
+		locations, locationMap, err = parseBinaryInput(ctx, f, cfg, hasher)
+	} else if cfg.Concurrency && cfg.Sharded {
+		locations, locationMap, scan, err = parseFileSharded(ctx, input, cfg, hasher)
+	} else if cp != nil {
+		locations, locationMap, scan, err = parseChunks(ctx, cp.input, cfg, hasher, cp)
+	} else if cfg.Concurrency {
+		locations, locationMap, scan, err = parseFileWithConcurrency(ctx, input, cfg, hasher)
+	} else {
+		locations, locationMap, scan, err = parseFile(ctx, f, cfg, hasher)
+	}
+	if errors.Is(err, context.DeadlineExceeded) && cfg.Timeout > 0 {
+		return nil, nil, stats, fmt.Errorf("timed out after %s", cfg.Timeout)
+	}
+	// a lenient run whose input shrank carries on with the chunks it read
+	var partial *partialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, nil, stats, inputOrParseError(err)
+	}
+	if cfg.InputFormat == inputFormatText {
+		if err := checkInvariants(locationMap, scan, cfg); err != nil {
+			return nil, nil, stats, invariantError(err, locations, locationMap, cfg)
+		}
+	}
+	// the chunks of a partial run leave gaps in the hashed input
+	if partial == nil {
+		if stats.InputHash, err = hasher.Sum(); err != nil {
+			return nil, nil, stats, withExitCode(exitInternal, fmt.Errorf("input hash: %w", err))
+		}
+	}
+	stats.Lines = scan.lines
+	stats.SkippedLines = scan.skipped
+	stats.IntegerTemps = scan.integerTemps
+	stats.ParseDuration = time.Since(parseStart)
+	// the run parsed its range, or the input from the offset it resumed
+	// from to its end
+	stats.Bytes = inputSize
+	if partial != nil {
+		stats.Bytes = partial.err.processed
+		stats.Partial = true
+	}
+	stats.Rows = scan.lines - resume.Lines
+	if cfg.InputFormat == inputFormatBinary {
+		// a binary record is a reading, counted only in the locations
+		for _, loc := range locationMap {
+			stats.Rows += loc.Count
+		}
+	}
+
+	// a resumed offset seeded the run with the checkpoint instead
+	if cfg.Resume != "" && resume.Offset == 0 {
+		merged := locationPointers(locationMap)
+		if err := mergeChunk(merged, locationPointers(resume.LocationMap)); err != nil {
+			return nil, nil, stats, fmt.Errorf("resuming: %w", err)
+		}
+		locationMap = locationValues(merged)
+		locations = mapLocations(locationMap)
+	}
+	// the final checkpoint records a complete run, a partial one keeps the
+	// periodic checkpoints of the prefix it merged
+	if cfg.Checkpoint != "" && partial == nil {
+		if err := saveCheckpoint(cfg.Checkpoint, locations, locationMap, cfg); err != nil {
+			return nil, nil, stats, fmt.Errorf("saving checkpoint: %w", err)
+		}
+	}
+
+	if cfg.Unordered {
+		// no discovery order was tracked, take the stations in map order
+		locations = mapLocations(locationMap)
+	}
+
+	stats.Stations = len(locationMap)
+	if cfg.NearDuplicateReport {
+		stats.NearDuplicates = findNearDuplicates(locationMap)
+	}
+
+	if cfg.MinCount > 0 {
+		locations, stats.ExcludedStations = filterMinCount(locations, locationMap, cfg.MinCount)
+	}
+
+	if cfg.HistogramOut != "" {
+		if err := writeHistogramFile(cfg.HistogramOut, locations, locationMap, cfg.HistogramBucket); err != nil {
+			return nil, nil, stats, withExitCode(exitOutput, fmt.Errorf("writing histograms: %w", err))
+		}
+	}
+
+	if partial != nil {
+		return locations, locationMap, stats, withExitCode(exitPartial, partial)
+	}
+	return locations, locationMap, stats, nil
+}
+
+func parseFile(ctx context.Context, file *os.File, cfg Config, hasher *inputHasher) ([]string, map[string]Location, scanStats, error) {
+	hint := stationsHint(file, cfg)
+	locations := make([]string, 0, hint)
+	locationMap := make(map[string]*Location, hint)
+	var scan scanStats
+
+	bom, err := bomLength(file)
+	if err != nil {
+		return nil, nil, scanStats{}, err
+	}
+	if _, err := file.Seek(bom, io.SeekStart); err != nil {
+		return nil, nil, scanStats{}, err
+	}
+
+	var reader io.Reader = metricsReader{file}
+	stream := hasher.newHashStream(bom)
+	if stream != nil {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return nil, nil, scanStats{}, err
+		}
+		hasher.expect(bom, fileInfo.Size())
+		reader = io.TeeReader(reader, stream)
+	}
+
+	scanner := bufio.NewScanner(reader)
+	decimal := cfg.decimalSeparator()
+
+	// published publishes the counts of scan not yet added to the metrics
+	var published scanStats
+	defer func() { metrics.addLines(&published, scan) }()
+
+	// bufio.ScanLines already strips the CR of CRLF line endings
+	for lineNumber := 0; scanner.Scan(); lineNumber++ {
+		// checking the context on every line shows up in the CPU profile
+		if lineNumber%ctxCheckInterval == 0 {
+			if ctx.Err() != nil {
+				return nil, nil, scanStats{}, fmt.Errorf("cancelled due to context: %w", ctx.Err())
+			}
+			metrics.addLines(&published, scan)
+		}
+
+		line := scanner.Text()
+		// blank lines aren't counted as skipped
+		if strings.TrimSpace(line) == "" || !sampled(line, cfg.SampleRate) {
+			continue
+		}
+
+		locationName, val, ok := splitLine(line, cfg.Delimiter, cfg.Quoted)
+		if !ok {
+			slog.DebugContext(ctx, "line does not have a delimiter", slog.String("line", line))
+			if cfg.Strict {
+				return nil, nil, scanStats{}, malformedLineError(line, cfg)
+			}
+			scan.skipped++
+			continue
+		}
+		if len(locationName) > cfg.MaxNameLength {
+			slog.DebugContext(ctx, "line has a station name that is too long", slog.String("line", line))
+			if cfg.Strict {
+				return nil, nil, scanStats{}, malformedLineError(line, cfg)
+			}
+			scan.skipped++
+			continue
+		}
+
+		temperature, integer, ok := parseTemp(val, cfg.Precision, cfg.AllowIntegerTemps, decimal)
+		if ok && cfg.Strict && mixesPrecision(val, cfg) {
+			ok = false
+		}
+		if !ok {
+			slog.DebugContext(ctx, "line has invalid temperature", slog.String("line", line))
+			if cfg.Strict {
+				return nil, nil, scanStats{}, malformedLineError(line, cfg)
+			}
+			scan.skipped++
+			continue
+		}
+		if integer {
+			scan.integerTemps++
+		}
+		scan.lines++
+
+		loc, ok := locationMap[locationName]
+		if !ok {
+			if !cfg.Unordered {
+				// add to locations slice for ordered location printing at end
+				locations = append(locations, locationName)
+			}
+			loc = &Location{}
+			locationMap[locationName] = loc
+		}
+
+		if err := mergeLocation(loc, newLocation(temperature)); err != nil {
+			return nil, nil, scanStats{}, fmt.Errorf("location '%s': %w", locationName, err)
+		}
+		if tracksHistogram(cfg) {
+			if loc.Histogram == nil {
+				loc.Histogram = &histogram{}
+			}
+			if err := loc.Histogram.add(temperature); err != nil {
+				return nil, nil, scanStats{}, fmt.Errorf("location '%s': %w", locationName, err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, scanStats{}, err
+	}
+	return locations, locationValues(locationMap), scan, nil
+}
+
+// createResult is writeResult returning the result as a string.
+func createResult(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	buffer := bytes.Buffer{}
+	if err := writeResult(&buffer, locations, locationMap, cfg); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// writeResult writes the locations to w in the 1BRC format.
+func writeResult(w io.Writer, locations []string, locationMap map[string]Location, cfg Config) error {
+	// ensure alpha order
+	if !cfg.Unordered {
+		sortStations(locations)
+	}
+
+	workers := 1
+	if len(locations) >= parallelFormatThreshold {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return formatLocations(w, locations, locationMap, cfg, workers)
+}
+
+// formatLocations writes the already sorted locations to w in the 1BRC
+// format. A single worker writes each location to w as it's formatted, with
+// more each formats a disjoint run of locations into its own buffer and the
+// buffers are written in order.
+func formatLocations(w io.Writer, locations []string, locationMap map[string]Location, cfg Config, workers int) error {
+	if workers > len(locations) {
+		workers = len(locations)
+	}
+	if workers <= 1 {
+		if _, err := io.WriteString(w, "{"); err != nil {
+			return err
+		}
+		if err := writeLocations(w, locations, locationMap, cfg, false); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "}")
+		return err
+	}
+
+	buffers := make([]bytes.Buffer, workers)
+	errs := make([]error, workers)
+	partSize := (len(locations) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		start := i * partSize
+		if start >= len(locations) {
+			break
+		}
+		end := min(start+partSize, len(locations))
+
+		wg.Add(1)
+		go func(i int, part []string) {
+			defer wg.Done()
+			errs[i] = writeLocations(&buffers[i], part, locationMap, cfg, i > 0)
+		}(i, locations[start:end])
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			return errs[i]
+		}
+	}
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+	for i := range buffers {
+		if _, err := w.Write(buffers[i].Bytes()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "}")
+	return err
+}
+
+// writeLocations writes name=min/mean/max entries for locations separated by
+// ", ", leading with a separator when the entries continue an earlier part.
+// Each entry is formatted into a reused scratch buffer and written to w whole.
+func writeLocations(w io.Writer, locations []string, locationMap map[string]Location, cfg Config, leadingSeparator bool) error {
+	memo := newTemperatureMemo(cfg.Precision)
+	var scratch []byte
+	for i := range locations {
+		details, ok := locationMap[locations[i]]
+		if !ok {
+			return fmt.Errorf("location '%s' found in locations but not in map", locations[i])
+		}
+
+		scratch = scratch[:0]
+		if i > 0 || leadingSeparator {
+			scratch = append(scratch, ", "...)
+		}
+
+		scratch = append(scratch, locations[i]...)
+		scratch = append(scratch, '=')
+		scratch = memo.append(scratch, convertReading(details.Min, cfg))
+		scratch = append(scratch, '/')
+		scratch = memo.append(scratch, convertMean(details, cfg))
+		scratch = append(scratch, '/')
+		scratch = memo.append(scratch, convertReading(details.Max, cfg))
+		if cfg.StdDev {
+			scratch = append(scratch, '/')
+			scratch = memo.append(scratch, convertStdDev(details, cfg))
+		}
+		for _, p := range cfg.Percentiles {
+			scratch = append(scratch, '/')
+			scratch = memo.append(scratch, convertReading(details.Histogram.percentile(p, details.Count), cfg))
+		}
+		if cfg.Count {
+			scratch = append(scratch, " (count="...)
+			scratch = strconv.AppendInt(scratch, details.Count, 10)
+			scratch = append(scratch, ')')
+		}
+		if _, err := w.Write(scratch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rounding modes for the mean
+const (
+	roundHalfUp   = "half-up"
+	roundHalfEven = "half-even"
+	roundFloor    = "floor"
+	roundCeil     = "ceil"
+)
+
+// mean returns Total/Count rounded with the given rounding mode, half-up
+// rounding ties towards positive infinity like the reference implementation.
+// It is computed in integer arithmetic so it stays exact for negative values
+// and for totals beyond float64 precision.
+func mean(loc Location, rounding string) int64 {
+	return divRound(loc.Total, loc.Count, rounding)
+}
+
+// divRound returns n/d for a positive d rounded with the given rounding mode.
+func divRound(n, d int64, rounding string) int64 {
+	q, r := floorDivMod(n, d)
+	if r == 0 {
+		return q
+	}
+
+	// compare r with d-r rather than 2*r with d to avoid overflowing for very
+	// large counts
+	switch rounding {
+	case roundFloor:
+		return q
+	case roundCeil:
+		return q + 1
+	case roundHalfEven:
+		if r > d-r || (r == d-r && q%2 != 0) {
+			return q + 1
+		}
+		return q
+	default:
+		if r >= d-r {
+			return q + 1
+		}
+		return q
+	}
+}
+
+// floorDivMod returns the floor of n/d for a positive d and the remainder,
+// which is always in [0, d).
+func floorDivMod(n, d int64) (int64, int64) {
+	q := n / d
+	r := n % d
+	if r < 0 {
+		q--
+		r += d
+	}
+	return q, r
+}
+
+var errTotalOverflow = errors.New("total overflows int64")
+
+// sumSquares is the unsigned 128-bit sum of the squared readings of a
+// Location.
+type sumSquares struct {
+	Hi uint64
+	Lo uint64
+}
+
+// add adds other to s.
+func (s *sumSquares) add(other sumSquares) {
+	var carry uint64
+	s.Lo, carry = bits.Add64(s.Lo, other.Lo, 0)
+	s.Hi, _ = bits.Add64(s.Hi, other.Hi, carry)
+}
+
+// float64 returns s as the nearest float64.
+func (s sumSquares) float64() float64 {
+	return float64(s.Hi)*(1<<64) + float64(s.Lo)
+}
+
+// newLocation returns a Location holding a single reading.
+func newLocation(temperature int64) Location {
+	return Location{
+		Min:        temperature,
+		Max:        temperature,
+		Total:      temperature,
+		Count:      1,
+		SumSquares: sumSquares{Lo: uint64(temperature * temperature)},
+	}
+}
+
+// mergeLocation folds src into dst. A dst without readings takes the Min and
+// Max of src, so the same merge serves inserting a new station and
+// accumulating into an existing one. src's histogram is adopted by a dst
+// without one, so src must not be used afterwards.
+func mergeLocation(dst *Location, src Location) error {
+	if dst.Count == 0 || src.Min < dst.Min {
+		dst.Min = src.Min
+	}
+	if dst.Count == 0 || src.Max > dst.Max {
+		dst.Max = src.Max
+	}
+
+	var ok bool
+	if dst.Total, ok = addTotal(dst.Total, src.Total); !ok {
+		return errTotalOverflow
+	}
+	dst.SumSquares.add(src.SumSquares)
+	dst.Count += src.Count
+
+	if dst.Histogram == nil {
+		dst.Histogram = src.Histogram
+	} else if src.Histogram != nil {
+		dst.Histogram.merge(src.Histogram)
+	}
+	return nil
+}
+
+// stdDev returns the population standard deviation of the readings multiplied
+// by factor, rounded to the nearest unit of the scale they are stored in.
+func stdDev(loc Location, factor float64) int64 {
+	mean := float64(loc.Total) / float64(loc.Count)
+	variance := loc.SumSquares.float64()/float64(loc.Count) - mean*mean
+	// float error can make the variance of identical readings slightly negative
+	if variance < 0 {
+		variance = 0
+	}
+	return int64(math.Round(math.Sqrt(variance) * factor))
+}
+
+// addTotal returns a+b and false if the sum overflows int64.
+func addTotal(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+// mapLocations returns the locations of locationMap in map iteration order.
+func mapLocations(locationMap map[string]Location) []string {
+	locations := make([]string, 0, len(locationMap))
+	for location := range locationMap {
+		locations = append(locations, location)
+	}
+	return locations
+}
+
+// filterMinCount returns the locations with at least minCount readings and
+// the number of locations left out.
+func filterMinCount(locations []string, locationMap map[string]Location, minCount int64) ([]string, int) {
+	filtered := make([]string, 0, len(locations))
+	for _, location := range locations {
+		if locationMap[location].Count >= minCount {
+			filtered = append(filtered, location)
+		}
+	}
+	return filtered, len(locations) - len(filtered)
+}
+
+// createCSVResult formats the locations as station,min,mean,max,count rows
+// after a header row, in alphabetical order unless cfg.Unordered is set.
+func createCSVResult(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	buffer := bytes.Buffer{}
+	w := csv.NewWriter(&buffer)
+
+	// ensure alpha order
+	if !cfg.Unordered {
+		sortStations(locations)
+	}
+
+	if err := w.Write(csvHeader(cfg)); err != nil {
+		return "", err
+	}
+	memo := newTemperatureMemo(cfg.Precision)
+	for i := range locations {
+		details, ok := locationMap[locations[i]]
+		if !ok {
+			return "", fmt.Errorf("location '%s' found in locations but not in map", locations[i])
+		}
+		if err := w.Write(csvRecord(locations[i], details, cfg, memo)); err != nil {
+			return "", err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// csvHeader returns the CSV columns written for a location with cfg.
+func csvHeader(cfg Config) []string {
+	header := []string{"station", "min", "mean", "max", "count"}
+	if cfg.StdDev {
+		header = append(header, "stddev")
+	}
+	for _, p := range cfg.Percentiles {
+		header = append(header, formatPercentile(p))
+	}
+	return header
+}
+
+// csvRecord returns the CSV row of a location, matching csvHeader.
+func csvRecord(name string, details Location, cfg Config, memo *temperatureMemo) []string {
+	record := []string{
+		name,
+		memo.format(convertReading(details.Min, cfg)),
+		memo.format(convertMean(details, cfg)),
+		memo.format(convertReading(details.Max, cfg)),
+		strconv.FormatInt(details.Count, 10),
+	}
+	if cfg.StdDev {
+		record = append(record, memo.format(convertStdDev(details, cfg)))
+	}
+	for _, p := range cfg.Percentiles {
+		record = append(record, memo.format(convertReading(details.Histogram.percentile(p, details.Count), cfg)))
+	}
+	return record
+}
+
+// parseTemp parses a temperature into tenths, or hundredths when precision
+// is 2. With allowInteger a temperature without a fractional part such as 12
+// is accepted as 12.0 and reported as integer.
+func parseTemp(temperature string, precision int, allowInteger bool, decimal byte) (val int64, integer, ok bool) {
+	if allowInteger && strings.IndexByte(temperature, decimal) == -1 {
+		val, ok = parseInteger(temperature)
+		return val * unitScale(precision), true, ok
+	}
+	if precision == 2 {
+		val, ok = parseNumberHundredths(temperature, decimal)
+		return val, false, ok
+	}
+	val, ok = parseNumber(temperature, decimal)
+	return val, false, ok
+}
+
+// mixesPrecision reports whether temperature has a single decimal while
+// cfg.Precision is 2. parseTemp normalizes such a temperature to hundredths,
+// -strict rejects it instead.
+func mixesPrecision(temperature string, cfg Config) bool {
+	return cfg.Precision == 2 && len(temperature) >= 2 && temperature[len(temperature)-2] == cfg.decimalSeparator()
+}
+
+// cutSign strips a leading '-' or '+' from temperature, reporting whether it
+// was negative.
+func cutSign(temperature string) (string, bool) {
+	if len(temperature) > 0 && (temperature[0] == '-' || temperature[0] == '+') {
+		return temperature[1:], temperature[0] == '-'
+	}
+	return temperature, false
+}
+
+// parseInteger parses a temperature in the form [-]d, [-]dd or [-]ddd into
+// degrees.
+func parseInteger(temperature string) (int64, bool) {
+	temperature, negative := cutSign(temperature)
+	if len(temperature) < 1 || len(temperature) > 3 {
+		return 0, false
+	}
+
+	var val int64
+	for i := 0; i < len(temperature); i++ {
+		if !isDigit(temperature[i]) {
+			return 0, false
+		}
+		val = val*10 + int64(temperature[i]-'0')
+	}
+	if negative {
+		val = -val
+	}
+	return val, true
+}
+
+// parseNumber parses a temperature in the form [-]d.d, [-]dd.d or [-]ddd.d
+// into tenths, with decimal as the decimal separator. ok is false when the
+// value does not match any of the shapes.
+func parseNumber(temperature string, decimal byte) (int64, bool) {
+	// avoid split string due to CPU profile
+	temperature, negative := cutSign(temperature)
+
+	var val int64
+	if len(temperature) == 4 && temperature[2] == decimal && isDigit(temperature[0]) && isDigit(temperature[1]) && isDigit(temperature[3]) {
+		// fast path for the most common shape 12.3
+		val = int64(temperature[3]) + int64(temperature[1])*10 + int64(temperature[0])*100 - '0'*(111)
+	} else {
+		// 1 to 3 integer digits and a single decimal
+		dot := len(temperature) - 2
+		if dot < 1 || dot > 3 || temperature[dot] != decimal {
+			return 0, false
+		}
+		for i := 0; i < len(temperature); i++ {
+			if i == dot {
+				continue
+			}
+			if !isDigit(temperature[i]) {
+				return 0, false
+			}
+			val = val*10 + int64(temperature[i]-'0')
+		}
+	}
+
+	if negative {
+		val = -val
+	}
+
+	return val, true
+}
+
+// parseNumberHundredths parses a temperature in the form [-]d.dd or [-]dd.dd
+// into hundredths, with decimal as the decimal separator. Values with a single
+// decimal are normalized to hundredths so files mixing both precisions
+// aggregate consistently.
+func parseNumberHundredths(temperature string, decimal byte) (int64, bool) {
+	if len(temperature) >= 2 && temperature[len(temperature)-2] == decimal {
+		val, ok := parseNumber(temperature, decimal)
+		return val * 10, ok
+	}
+
+	temperature, negative := cutSign(temperature)
+
+	var val int64
+	switch {
+	case len(temperature) == 4 && temperature[1] == decimal:
+		// 1.23
+		if !isDigit(temperature[0]) || !isDigit(temperature[2]) || !isDigit(temperature[3]) {
+			return 0, false
+		}
+		val = int64(temperature[3]) + int64(temperature[2])*10 + int64(temperature[0])*100 - '0'*(111)
+	case len(temperature) == 5 && temperature[2] == decimal:
+		// 12.34
+		if !isDigit(temperature[0]) || !isDigit(temperature[1]) || !isDigit(temperature[3]) || !isDigit(temperature[4]) {
+			return 0, false
+		}
+		val = int64(temperature[4]) + int64(temperature[3])*10 + int64(temperature[1])*100 + int64(temperature[0])*1000 - '0'*(1111)
+	default:
+		return 0, false
+	}
+
+	if negative {
+		val = -val
+	}
+
+	return val, true
+}
+
+// formatTemperature formats a value in tenths, or hundredths when precision
+// is 2, with that many decimals.
+func formatTemperature(val int64, precision int) string {
+	return string(appendTemperature(nil, val, precision))
+}
+
+// appendTemperature appends val formatted like formatTemperature to dst.
+func appendTemperature(dst []byte, val int64, precision int) []byte {
+	if precision == 2 {
+		return appendScaled(dst, val, 100)
+	}
+	return appendTenths(dst, val)
+}
+
+// appendTenths appends v tenths to dst with a single decimal, formatting the
+// digits from the integer rather than going through float64.
+func appendTenths(dst []byte, v int64) []byte {
+	return appendScaled(dst, v, 10)
+}
+
+// appendScaled appends v/scale to dst with a decimal per power of ten in
+// scale. Values in (-1, 0) keep their sign, as in "-0.5".
+func appendScaled(dst []byte, v, scale int64) []byte {
+	// the magnitude as unsigned so math.MinInt64 doesn't overflow
+	u := uint64(v)
+	if v < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	dst = strconv.AppendUint(dst, u/uint64(scale), 10)
+	dst = append(dst, '.')
+	frac := u % uint64(scale)
+	for digit := uint64(scale) / 10; digit > 0; digit /= 10 {
+		dst = append(dst, byte('0'+frac/digit%10))
+	}
+	return dst
+}
+
+// temperatureMemo formats values like formatTemperature, formatting each
+// tenth in [-99.9, 99.9] once as station values repeat heavily. Units are
+// converted before formatting so the strings only depend on the precision,
+// hundredths aren't memoized.
+type temperatureMemo struct {
+	precision int
+	tenths    [2*memoOffset + 1]string
+}
+
+// memoOffset shifts tenths in [-999, 999] to a temperatureMemo index
+const memoOffset = 999
+
+func newTemperatureMemo(precision int) *temperatureMemo {
+	return &temperatureMemo{precision: precision}
+}
+
+func (m *temperatureMemo) format(val int64) string {
+	if m.precision != 1 || val < -memoOffset || val > memoOffset {
+		return formatTemperature(val, m.precision)
+	}
+	s := &m.tenths[val+memoOffset]
+	if *s == "" {
+		*s = formatTemperature(val, m.precision)
+	}
+	return *s
+}
+
+// append appends val formatted like format to dst.
+func (m *temperatureMemo) append(dst []byte, val int64) []byte {
+	if m.precision != 1 || val < -memoOffset || val > memoOffset {
+		return appendTemperature(dst, val, m.precision)
+	}
+	return append(dst, m.format(val)...)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// bomLength returns the length of the UTF-8 byte order mark at the start of
+// the file, or 0 if there isn't one.
+func bomLength(file io.ReaderAt) (int64, error) {
+	buffer := make([]byte, len(utf8BOM))
+	n, err := file.ReadAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if bytes.Equal(buffer[:n], utf8BOM) {
+		return int64(len(utf8BOM)), nil
+	}
+	return 0, nil
+}
+
+// source is the input of the concurrent parser, satisfied by *os.File.
+type source interface {
+	io.ReaderAt
+	Stat() (fs.FileInfo, error)
+}
+
+// concurrency funcs
+// chunkResult is the aggregate of a chunk sent to the merger, in table with
+// -fast-map and in locationMap otherwise.
+type chunkResult struct {
+	locationMap map[string]*Location
+	table       *stationTable
+	scan        scanStats
+	// start and end are the offsets of the chunk in the input
+	start, end int64
+}
+
+// scanStats counts notable lines seen while parsing text input.
+type scanStats struct {
+	// lines is the number of lines aggregated
+	lines int64
+	// skipped is the number of non-empty lines dropped as invalid
+	skipped int64
+	// integerTemps is the number of temperatures without a fractional part
+	// accepted with Config.AllowIntegerTemps
+	integerTemps int64
+}
+
+func (s *scanStats) add(other scanStats) {
+	s.lines += other.lines
+	s.skipped += other.skipped
+	s.integerTemps += other.integerTemps
+}
+
+// chunkHandler aggregates the chunk of whole lines at offset start for
+// lineOrchestrator, returning the counts of its lines. ctx is cancelled once
+// any chunk fails.
+type chunkHandler func(ctx context.Context, start int64, chunk []byte) (scanStats, error)
+
+// lineOrchestrator splits the file into chunks ending on line boundaries and
+// hands each to handle on its own goroutine.
+func lineOrchestrator(ctx context.Context, file source, cfg Config, hasher *inputHasher, handle chunkHandler) error {
+	// Get file size
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := fileInfo.Size()
+
+	// skip a UTF-8 BOM so it isn't glued onto the first station name
+	start, err := bomLength(file)
+	if err != nil {
+		return err
+	}
+	hasher.expect(start, fileSize)
+
+	// the first error, of a worker or of the loop below, cancels gctx which
+	// stops further chunks from being scheduled, and is returned once the
+	// running workers finish
+	g, gctx := errgroup.WithContext(ctx)
+	fail := func(err error) {
+		g.Go(func() error { return err })
+	}
+
+	// failed records how far the run got when the chunk at offset failed
+	orchestrated := time.Now()
+	var processed atomic.Int64
+	failed := func(offset int64, err error) *chunkError {
+		return &chunkError{offset: offset, processed: processed.Load(), size: fileSize, elapsed: time.Since(orchestrated), err: err}
+	}
+
+	// a lenient run keeps the chunks read before the input shrank rather
+	// than failing, shrunk is the first shrink seen
+	var shrinkMu sync.Mutex
+	var shrunk *chunkError
+	skipShrunk := func(err *chunkError) error {
+		var shrinkErr *shrunkInputError
+		if cfg.Strict || !errors.As(err, &shrinkErr) {
+			return err
+		}
+		shrinkMu.Lock()
+		defer shrinkMu.Unlock()
+		if shrunk == nil {
+			shrunk = err
+		}
+		return nil
+	}
+	shrank := func() bool {
+		shrinkMu.Lock()
+		defer shrinkMu.Unlock()
+		return shrunk != nil
+	}
+
+	// read reads the chunk [start, end)
+	read := func(start, end int64) ([]byte, error) {
+		length, err := chunkLength(start, end)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, length)
+		n, err := readFullAt(file, chunk, start)
+		if n < len(chunk) && err == io.EOF {
+			// reaching the end within the size the file had when the run
+			// started means it was truncated underneath us, a nil chunk
+			// is skipped
+			return nil, skipShrunk(failed(start, shrunkError(file, fileSize, start)))
+		}
+		if err != nil {
+			return nil, failed(start, fmt.Errorf("reading chunk at offset %d: %w", start, err))
+		}
+		return chunk, nil
+	}
+	var dropper *pageCacheDropper
+	if cfg.Fadvise {
+		dropper = newPageCacheDropper(file, start, fileSize)
+	}
+	// process hands the chunk read at start to handle
+	process := func(start int64, chunk []byte) error {
+		if chunk == nil {
+			return nil
+		}
+		hasher.add(start, chunk)
+		scan, err := handle(gctx, start, chunk)
+		if err != nil {
+			return failed(start, fmt.Errorf("chunk at offset %d: %w", start, err))
+		}
+		metrics.addChunk(int64(len(chunk)), scan)
+		processed.Add(int64(len(chunk)))
+		dropper.parsed(start, start+int64(len(chunk)))
+		return nil
+	}
+
+	// by default every chunk gets a goroutine that reads and processes it,
+	// -readers separates the reads from the parsing
+	schedule := func(start, end int64) {
+		g.Go(func() error {
+			chunk, err := read(start, end)
+			if err != nil {
+				return err
+			}
+			return process(start, chunk)
+		})
+	}
+	finish := func() {}
+	if cfg.Readers > 0 {
+		schedule, finish = startReaders(gctx, g, cfg.Readers, read, process)
+	}
+
+	chunkSize := cfg.chunkSizeFor(fileSize)
+	slog.Info("chunk size", slog.Int64("chunkSize", chunkSize), slog.Bool("automatic", cfg.ChunkSize == 0))
+
+	end := int64(0)
+	sampled := !cfg.AdaptiveChunks
+	for start < fileSize && gctx.Err() == nil && !shrank() {
+		end, err = chunkEnd(file, start, fileSize, chunkSize)
+		if errors.Is(err, io.EOF) {
+			if err := skipShrunk(failed(start, shrunkError(file, fileSize, start))); err != nil {
+				fail(err)
+			}
+			break
+		}
+		if err != nil {
+			fail(failed(start, fmt.Errorf("finding the end of chunk at offset %d: %w", start, err)))
+			break
+		}
+		// the chunks after the first are sized by its line length
+		if !sampled {
+			sampled = true
+			if chunkSize, err = adaptiveChunkSize(file, start, end, chunkSize); err != nil {
+				fail(err)
+				break
+			}
+			slog.Debug("adaptive chunk size", slog.Int64("chunkSize", chunkSize))
+		}
+		slog.Debug("chunk", slog.Int64("start", start), slog.Int64("end", end))
+
+		schedule(start, end)
+
+		// the next chunk starts at the line boundary the previous one ended on
+		start = end
+	}
+	finish()
+
+	slog.Info("file",
+		slog.Int64("fileSize", fileSize),
+		slog.Int64("bytesRead", end))
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if shrunk != nil {
+		// the chunks before the new end may still have been processed since
+		shrunk.processed = processed.Load()
+		return &partialError{err: shrunk}
+	}
+	return nil
+}
+
+// chunkEnd returns the end of the chunk starting at start, the last line
+// boundary within chunkSize bytes. The final chunk always extends exactly to
+// fileSize so a last line without a trailing newline is still parsed.
+func chunkEnd(file io.ReaderAt, start, fileSize, chunkSize int64) (int64, error) {
+	// comparing the remaining bytes rather than start+chunkSize can't overflow
+	if fileSize-start <= chunkSize {
+		return fileSize, nil
+	}
+
+	end := start + chunkSize
+	boundary, err := findNextLineBoundary(file, end, fileSize)
+	if err != nil {
+		return 0, err
+	}
+	if boundary > start {
+		// end the chunk on a line boundary so no partial line is handed to a
+		// worker, a prefix of a CRLF line would otherwise parse as valid
+		return boundary, nil
+	}
+	// a line longer than the chunk extends the chunk to its end rather than
+	// being split
+	return findLineEndAfter(file, end, fileSize)
+}
+
+// findLineEndAfter returns the offset of the first newline at or after
+// offset, or fileSize when the rest of the file holds none.
+func findLineEndAfter(file io.ReaderAt, offset, fileSize int64) (int64, error) {
+	buffer := make([]byte, 4096)
+	for offset < fileSize {
+		p := buffer[:min(int64(len(buffer)), fileSize-offset)]
+		if _, err := readFullAt(file, p, offset); err != nil {
+			return 0, err
+		}
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			return offset + int64(i), nil
+		}
+		offset += int64(len(p))
+	}
+	return fileSize, nil
+}
+
+// chunkLength returns the length of the chunk from start to end as the int
+// make takes, which is 32 bits on 32-bit platforms even though offsets are
+// int64.
+func chunkLength(start, end int64) (int, error) {
+	if end < start || end-start > maxChunkSize {
+		return 0, fmt.Errorf("invalid chunk from offset %d to %d, chunks are at most %d bytes", start, end, int64(maxChunkSize))
+	}
+	return int(end - start), nil
+}
+
+// readFullAt reads len(p) bytes from file at offset into p, reading again
+// after short reads such as those of network filesystems. An io.EOF along
+// with a full read is not an error. It returns io.EOF when the end of the file
+// is reached first and io.ErrNoProgress when a read returns nothing.
+func readFullAt(file io.ReaderAt, p []byte, offset int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		n, err := file.ReadAt(p[read:], offset+int64(read))
+		read += n
+		if read == len(p) {
+			break
+		}
+		if err != nil {
+			return read, err
+		}
+		if n == 0 {
+			return read, io.ErrNoProgress
+		}
+	}
+	return read, nil
+}
+
+// shrunkError describes a read at offset that came up short of a file that
+// was originalSize bytes when the run started.
+func shrunkError(file source, originalSize, offset int64) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("short read of chunk at offset %d: %w", offset, err)
+	}
+	if fileInfo.Size() < originalSize {
+		return &shrunkInputError{originalSize: originalSize, size: fileInfo.Size(), offset: offset}
+	}
+	return fmt.Errorf("short read of chunk at offset %d: %w", offset, io.ErrUnexpectedEOF)
+}
+
+// shrunkInputError is a read of the chunk at offset failing because the
+// input shrank from originalSize to size bytes during the run.
+type shrunkInputError struct {
+	originalSize, size, offset int64
+}
+
+func (e *shrunkInputError) Error() string {
+	return fmt.Sprintf("input shrank from %d to %d bytes while reading chunk at offset %d: %v", e.originalSize, e.size, e.offset, io.ErrUnexpectedEOF)
+}
+
+func (e *shrunkInputError) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// chunkError is the failure of the chunk at offset of a size byte input,
+// once processed bytes of it were aggregated in elapsed.
+type chunkError struct {
+	offset, processed, size int64
+	elapsed                 time.Duration
+	err                     error
+}
+
+func (e *chunkError) Error() string {
+	return fmt.Sprintf("%v, after processing %d bytes", e.err, e.processed)
+}
+
+func (e *chunkError) Unwrap() error {
+	return e.err
+}
+
+// partialError is returned along with the aggregates of the chunks read when
+// the input shrank during a lenient run, which then only cover the bytes
+// processed before the failing chunk.
+type partialError struct {
+	err *chunkError
+}
+
+func (e *partialError) Error() string {
+	return "partial result: " + e.err.Error()
+}
+
+func (e *partialError) Unwrap() error {
+	return e.err
+}
+
+// processChunk aggregates the lines of a chunk, counting invalid lines and
+// integer temperatures in its scanStats.
+func processChunk(input []byte, cfg Config) (map[string]*Location, scanStats, error) {
+	locationMap := make(map[string]*Location, capStationsHint(cfg.StationsHint, int64(len(input))))
+	var scan scanStats
+	names := internTables.Get().(*internTable)
+	defer internTables.Put(names)
+
+	data := string(input)
+
+	lines := strings.Split(data, "\n")
+
+	// Process each line
+	for _, line := range lines {
+		skipped := scan.skipped
+		locationName, location := processLine(line, cfg, &scan)
+		if location == nil {
+			if cfg.Strict && scan.skipped > skipped {
+				return nil, scanStats{}, malformedLineError(line, cfg)
+			}
+			continue
+		}
+
+		// processLine allocates every location, so the first reading of a
+		// station is stored as is and later ones update it in place
+		loc, ok := locationMap[locationName]
+		if !ok {
+			loc = location
+			locationMap[names.intern(locationName)] = loc
+		} else if err := mergeLocation(loc, *location); err != nil {
+			return nil, scanStats{}, fmt.Errorf("location '%s': %w", locationName, err)
+		}
+		if tracksHistogram(cfg) {
+			if loc.Histogram == nil {
+				loc.Histogram = &histogram{}
+			}
+			if err := loc.Histogram.add(location.Total); err != nil {
+				return nil, scanStats{}, fmt.Errorf("location '%s': %w", locationName, err)
+			}
+		}
+	}
+
+	return locationMap, scan, nil
+}
+
+// processLine parses a line into its station name and a Location holding its
+// reading, or a nil Location when the line is empty or invalid. Invalid lines
+// and integer temperatures are counted in scan.
+func processLine(line string, cfg Config, scan *scanStats) (string, *Location) {
+	// strip the CR of CRLF line endings
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	// blank lines aren't counted as skipped
+	if strings.TrimSpace(line) == "" || !sampled(line, cfg.SampleRate) {
+		return "", nil
+	}
+	locationName, val, ok := splitLine(line, cfg.Delimiter, cfg.Quoted)
+	if !ok {
+		slog.Debug("line does not have a delimiter", slog.String("line", line))
+		scan.skipped++
+		return "", nil
+	}
+	if len(locationName) > cfg.MaxNameLength {
+		slog.Debug("line has a station name that is too long", slog.String("line", line))
+		scan.skipped++
+		return "", nil
+	}
+
+	temperature, integer, ok := parseTemp(val, cfg.Precision, cfg.AllowIntegerTemps, cfg.decimalSeparator())
+	if ok && cfg.Strict && mixesPrecision(val, cfg) {
+		ok = false
+	}
+	if !ok {
+		slog.Debug("line has invalid temperature", slog.String("line", line))
+		scan.skipped++
+		return "", nil
+	}
+	if integer {
+		scan.integerTemps++
+	}
+
+	scan.lines++
+	location := newLocation(temperature)
+	return locationName, &location
+}
+
+// malformedLineError describes the malformed line for -strict, quoting at
+// most malformedPrefixLength bytes of it.
+func malformedLineError(line string, cfg Config) error {
+	line = strings.TrimSuffix(line, "\r")
+	prefix := line
+	if len(prefix) > malformedPrefixLength {
+		prefix = prefix[:malformedPrefixLength] + "..."
+	}
+	name, temperature, ok := splitLine(line, cfg.Delimiter, cfg.Quoted)
+	if ok && len(name) > cfg.MaxNameLength {
+		return fmt.Errorf("station name longer than %d bytes in line %q", cfg.MaxNameLength, prefix)
+	}
+	if ok && mixesPrecision(temperature, cfg) {
+		return fmt.Errorf("temperature with a single decimal at a precision of %d in line %q", cfg.Precision, prefix)
+	}
+	return fmt.Errorf("malformed line %q", prefix)
+}
+
+// splitLine splits a line into the station name and the temperature at the
+// first delimiter. With quoted set a name in double quotes may contain the
+// delimiter, a quote within it is escaped by doubling it as in CSV.
+func splitLine(line string, delimiter byte, quoted bool) (string, string, bool) {
+	if quoted && len(line) > 0 && line[0] == '"' {
+		return splitQuotedLine(line, delimiter)
+	}
+
+	// avoid using strings.Split from CPU profiling
+	splitIndex := strings.IndexByte(line, delimiter)
+	if splitIndex == -1 {
+		return "", "", false
+	}
+	return line[:splitIndex], line[splitIndex+1:], true
+}
+
+// splitQuotedLine splits a line starting with a quoted station name.
+func splitQuotedLine(line string, delimiter byte) (string, string, bool) {
+	escaped := false
+	for i := 1; i < len(line); i++ {
+		if line[i] != '"' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == '"' {
+			escaped = true
+			i++
+			continue
+		}
+
+		// the closing quote must be followed by the delimiter
+		if i+1 == len(line) || line[i+1] != delimiter {
+			return "", "", false
+		}
+		name := line[1:i]
+		if escaped {
+			name = strings.ReplaceAll(name, `""`, `"`)
+		}
+		return name, line[i+2:], true
+	}
+	// unterminated quote
+	return "", "", false
+}
+
+// parseFileWithConcurrency aggregates file in chunks processed by concurrent
+// workers whose results are merged as they arrive.
+//
+// The orchestrator and the merger run in an errgroup so an early return
+// leaks neither goroutines nor chunk maps when embedded in a long-lived
+// process: the first error of either, or of a worker, cancels the group's
+// context, workers select on it for every send, and once the group has
+// exited the results left in the buffer are dropped.
+func parseFileWithConcurrency(ctx context.Context, file source, cfg Config, hasher *inputHasher) ([]string, map[string]Location, scanStats, error) {
+	return parseChunks(ctx, file, cfg, hasher, nil)
+}
+
+// parseChunks is parseFileWithConcurrency saving periodic checkpoints with
+// cp when it isn't nil. The run then starts from the state cp resumes and
+// merges the chunks in input order, so the merged state always covers a
+// contiguous prefix of the input that a checkpoint can record the end of.
+func parseChunks(ctx context.Context, file source, cfg Config, hasher *inputHasher, cp *checkpointer) ([]string, map[string]Location, scanStats, error) {
+	locationMap := make(map[string]*Location, stationsHint(file, cfg))
+	var scan scanStats
+	if cp != nil {
+		scan = cp.resumedState(locationMap)
+	}
+
+	// Channel to communicate processed data, buffered so workers can hand
+	// off their result and read their next chunk while the merger is busy
+	results := make(chan chunkResult, resultsPerWorker*runtime.GOMAXPROCS(0))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(results)
+		return lineOrchestrator(gctx, file, cfg, hasher, func(ctx context.Context, start int64, chunk []byte) (scanStats, error) {
+			result := chunkResult{start: start, end: start + int64(len(chunk))}
+			var err error
+			if cfg.FastMap {
+				result.table, result.scan, err = processChunkTable(chunk, cfg)
+			} else {
+				result.locationMap, result.scan, err = processChunk(chunk, cfg)
+			}
+			if err != nil {
+				return scanStats{}, err
+			}
+			// the merger stops receiving once the context is cancelled
+			select {
+			case results <- result:
+				return result.scan, nil
+			case <-ctx.Done():
+				return scanStats{}, ctx.Err()
+			}
+		})
+	})
+	merge := func(result chunkResult) error {
+		scan.add(result.scan)
+		if result.table != nil {
+			return mergeTable(locationMap, result.table)
+		}
+		return mergeChunk(locationMap, result.locationMap)
+	}
+	g.Go(func() error {
+		if cp == nil {
+			for result := range results {
+				if err := merge(result); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// hold back the chunks past a gap until the chunk filling it arrives
+		next, err := bomLength(file)
+		if err != nil {
+			return err
+		}
+		pending := map[int64]chunkResult{}
+		for result := range results {
+			pending[result.start] = result
+			for ready, ok := pending[next]; ok; ready, ok = pending[next] {
+				delete(pending, next)
+				if err := merge(ready); err != nil {
+					return err
+				}
+				next = ready.end
+				if err := cp.save(locationMap, scan, next, cfg); err != nil {
+					return fmt.Errorf("saving checkpoint: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+
+	err := g.Wait()
+	// release the results buffered by workers after the merger stopped
+	for range results {
+	}
+	if ctx.Err() != nil {
+		return nil, nil, scanStats{}, fmt.Errorf("cancelled due to context: %w", ctx.Err())
+	}
+	var partial *partialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, nil, scanStats{}, err
+	}
+	// the stations arrive in whichever order the chunks are merged, so rather
+	// than tracking it they are taken from the map, writeResult sorts them
+	values := locationValues(locationMap)
+	return mapLocations(values), values, scan, err
+}
+
+// resultsPerWorker is how many chunk results the results channel buffers per
+// worker. GOMAXPROCS bounds the workers running at once, so the buffer holds
+// at most a couple of chunk maps per worker rather than growing with the file.
+var resultsPerWorker = 2
+
+// mergeHook, when set, is called with every location after merging. Tests use
+// it to check invariants, panicking on a violation, or to perturb results.
+var mergeHook func(name string, loc *Location)
+
+// mergeChunk merges the result of a chunk into locationMap. A panic while
+// merging is returned as an error so the run can stop its workers rather than
+// leave them blocked.
+func mergeChunk(locationMap, chunk map[string]*Location) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("merging results panicked: %v", r)
+		}
+	}()
+
+	//mapLock.Lock()
+	for key, location := range chunk {
+		if err := mergeStation(locationMap, key, location); err != nil {
+			return err
+		}
+	}
+	//mapLock.Unlock()
+	return nil
+}
+
+// mergeTable is mergeChunk for the stationTable of a -fast-map chunk.
+func mergeTable(locationMap map[string]*Location, table *stationTable) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("merging results panicked: %v", r)
+		}
+	}()
+
+	return table.each(func(name string, location *Location) error {
+		return mergeStation(locationMap, name, location)
+	})
+}
+
+// mergeStation merges the location of a station of a chunk into locationMap.
+func mergeStation(locationMap map[string]*Location, key string, location *Location) error {
+	loc, exists := locationMap[key]
+	if !exists {
+		// the chunk's location is copied rather than adopted so the
+		// merged map doesn't share entries with a worker
+		loc = &Location{}
+		locationMap[key] = loc
+	}
+	// chunks are discarded after merging so their histograms can be
+	// adopted rather than copied
+	if err := mergeLocation(loc, *location); err != nil {
+		return fmt.Errorf("location '%s': %w", key, err)
+	}
+	if mergeHook != nil {
+		mergeHook(key, loc)
+	}
+	return nil
+}
+
+// locationPointers returns a map of pointers to copies of the locations in
+// locationMap, the form the engines update in place.
+func locationPointers(locationMap map[string]Location) map[string]*Location {
+	pointers := make(map[string]*Location, len(locationMap))
+	for name, loc := range locationMap {
+		loc := loc
+		pointers[name] = &loc
+	}
+	return pointers
+}
+
+// locationValues returns the locations of an engine's map by value, the form
+// the output and checkpoints use.
+func locationValues(pointers map[string]*Location) map[string]Location {
+	locationMap := make(map[string]Location, len(pointers))
+	for name, loc := range pointers {
+		locationMap[name] = *loc
+	}
+	return locationMap
+}
+
+// findNextLineBoundary returns the offset of the last newline at or before
+// start, 0 when there is none, or fileSize when start is at or past the end of
+// the file.
+func findNextLineBoundary(file io.ReaderAt, start, fileSize int64) (int64, error) {
+	if start >= fileSize {
+		return fileSize, nil
+	}
+
+	buffer := make([]byte, 1)
+	for ; start >= 0; start-- {
+		if _, err := file.ReadAt(buffer, start); err != nil {
+			return 0, err
+		}
+		if buffer[0] == '\n' {
+			return start, nil
+		}
+	}
+	return 0, nil
+}
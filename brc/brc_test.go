@@ -0,0 +1,2663 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	measurements10In          string = "measurements_ten.txt"
+	measurements10Out         string = "{Adelaide=15.0/15.0/15.0, Cabo San Lucas=14.9/14.9/14.9, Dodoma=22.2/22.2/22.2, Halifax=12.9/12.9/12.9, Karachi=15.4/15.4/15.4, Pittsburgh=9.7/9.7/9.7, Ségou=25.7/25.7/25.7, Tauranga=38.2/38.2/38.2, Xi'an=24.2/24.2/24.2, Zagreb=12.2/12.2/12.2}"
+	measurementsRoundingIn    string = "measurements_rounding.txt"
+	measurementsRoundingOut   string = "{ham=14.6/25.5/33.6, jel=-9.0/18.0/46.5}"
+	measurementsMillionIn     string = "measurements_million.txt"
+	measurements10CRLFIn      string = "measurements_ten_crlf.txt"
+	measurements10BOMIn       string = "measurements_ten_bom.txt"
+	measurements10CommaIn     string = "measurements_ten_comma.txt"
+	measurements10DecimalIn   string = "measurements_ten_decimal_comma.txt"
+	measurements10GluedIn     string = "measurements_ten_glued.txt"
+	measurementsQuotedIn      string = "measurements_quoted.txt"
+	measurementsHundredthsIn  string = "measurements_hundredths.txt"
+	measurementsHundredthsOut string = "{a=-1.05/4.80/12.34, b=-0.01/0.00/0.02, c=0.01/0.02/0.02, d=-0.02/-0.01/-0.01}"
+)
+
+// fixtures of the edge cases around line endings, measurements10In itself
+// ends without a trailing newline
+const (
+	// measurements10TruncatedIn is measurements10In with a last line cut off
+	// in its temperature
+	measurements10TruncatedIn string = "measurements_ten_truncated.txt"
+	measurementsEmptyIn       string = "measurements_empty.txt"
+	// measurementsBlankIn holds only empty and whitespace lines
+	measurementsBlankIn string = "measurements_blank.txt"
+)
+
+// testChunkSize is the chunk size of the tests spanning several chunks, the
+// automatic size fits the fixtures in one
+const testChunkSize = 80 * 1024
+
+var benchRows = flag.Int("bench-rows", 1_000_000, "rows to generate for BenchmarkRun when measurements_million.txt is absent")
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		expOutput string
+	}{
+		{
+			fileName:  measurements10In,
+			expOutput: measurements10Out,
+		},
+		{
+			fileName:  measurementsRoundingIn,
+			expOutput: measurementsRoundingOut,
+		},
+		{
+			fileName:  measurements10CRLFIn,
+			expOutput: measurements10Out,
+		},
+		{
+			fileName:  measurements10BOMIn,
+			expOutput: measurements10Out,
+		},
+		{
+			fileName:  measurementsEmptyIn,
+			expOutput: "{}",
+		},
+		{
+			fileName:  measurementsBlankIn,
+			expOutput: "{}",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fileName, func(t *testing.T) {
+
+			ctx := context.Background()
+			cfg := DefaultConfig()
+
+			// with concurrency
+			setConcurrency(&cfg, true)
+			output, err := runString(ctx, fixturePath(t, tc.fileName), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expOutput != output {
+				t.Errorf("(concurrency) expected %+v but got %+v", tc.expOutput, output)
+			}
+
+			// without concurrency
+			setConcurrency(&cfg, false)
+			output, err = runString(ctx, fixturePath(t, tc.fileName), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.expOutput != output {
+				t.Errorf("expected %+v but got %+v", tc.expOutput, output)
+			}
+		})
+	}
+}
+
+func TestRealMainOutput(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := fixturePath(t, measurements10In)
+	// the CPU profile is written to the working directory
+	chdir(t, t.TempDir())
+	// realMain replaces the default logger
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		name      string
+		flags     []string
+		expLogs   []string
+		expNoLogs bool
+	}{
+		{name: "default", expLogs: []string{"level=INFO msg=success"}},
+		{name: "quiet", flags: []string{"-quiet"}, expNoLogs: true},
+		{name: "q", flags: []string{"-q"}, expNoLogs: true},
+		{name: "q over v", flags: []string{"-q", "-v"}, expNoLogs: true},
+		{name: "error level", flags: []string{"-log-level=error"}, expNoLogs: true},
+		{name: "verbose", flags: []string{"-v"}, expLogs: []string{`level=DEBUG msg="parsing a small input sequentially" fileSize=135`, "mode=sequential"}},
+		{name: "verbose concurrent", flags: []string{"-v", "-concurrency-threshold=0"}, expLogs: []string{"level=DEBUG msg=chunk start=0 end=", "msg=success", "mode=concurrent"}},
+		{name: "debug level", flags: []string{"-log-level=DEBUG", "-concurrency-threshold=0"}, expLogs: []string{"level=DEBUG msg=chunk"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append(append([]string{"1brc"}, tc.flags...), filePath)
+
+			stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+			if err := realMain(ctx, args, &stdout, &stderr); err != nil {
+				t.Fatal(err)
+			}
+
+			if stdout.String() != measurements10Out+"\n" {
+				t.Errorf("expected only the result on stdout but got %q", stdout.String())
+			}
+			if tc.expNoLogs && stderr.Len() != 0 {
+				t.Errorf("expected no logs but got %q", stderr.String())
+			}
+			for _, expLog := range tc.expLogs {
+				if !strings.Contains(stderr.String(), expLog) {
+					t.Errorf("expected %q on stderr but got %q", expLog, stderr.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRealMainMode(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		flags   []string
+		expMode string
+	}{
+		// the default concurrent mode falls back for the small fixture
+		{expMode: modeSequential},
+		{flags: []string{"-mode=sequential"}, expMode: modeSequential},
+		{flags: []string{"-mode=concurrent"}, expMode: modeConcurrent},
+		{flags: []string{"-mode", "concurrent", "-concurrency-threshold=1000"}, expMode: modeSequential},
+	}
+	for _, tc := range tests {
+		args := append(append([]string{"1brc", "-profile-overwrite"}, tc.flags...), filePath)
+		stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+		if err := realMain(context.Background(), args, &stdout, &stderr); err != nil {
+			t.Fatalf("(%v) %v", tc.flags, err)
+		}
+		if stdout.String() != measurements10Out+"\n" {
+			t.Errorf("(%v) expected %q but got %q", tc.flags, measurements10Out+"\n", stdout.String())
+		}
+		profile := "measurements_ten-" + tc.expMode + "-profile.pb.gz"
+		for _, expLog := range []string{"path=" + profile, "mode=" + tc.expMode} {
+			if !strings.Contains(stderr.String(), expLog) {
+				t.Errorf("(%v) expected %q on stderr but got %q", tc.flags, expLog, stderr.String())
+			}
+		}
+	}
+
+	err := realMain(context.Background(), []string{"1brc", "-mode=parallel", filePath}, &bytes.Buffer{}, &bytes.Buffer{})
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("expected exit code %d for an unknown mode but got %d for %v", exitUsage, code, err)
+	}
+}
+
+func TestRealMainDecimals(t *testing.T) {
+	filePath := fixturePath(t, measurementsHundredthsIn)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	for _, flags := range [][]string{{"-decimals=2"}, {"-precision=2"}, {"-precision=2", "-decimals=2"}} {
+		stdout := bytes.Buffer{}
+		if err := realMain(context.Background(), append(append([]string{"1brc"}, flags...), filePath), &stdout, &bytes.Buffer{}); err != nil {
+			t.Fatalf("(%v) %v", flags, err)
+		}
+		if stdout.String() != measurementsHundredthsOut+"\n" {
+			t.Errorf("(%v) expected %q but got %q", flags, measurementsHundredthsOut+"\n", stdout.String())
+		}
+	}
+
+	// conflicting values are rejected whichever comes last
+	for _, flags := range [][]string{{"-precision=1", "-decimals=2"}, {"-decimals=2", "-precision=1"}} {
+		err := realMain(context.Background(), append(append([]string{"1brc"}, flags...), filePath), &bytes.Buffer{}, &bytes.Buffer{})
+		if code := exitCode(err); code != exitUsage || !strings.Contains(err.Error(), "conflicts with") {
+			t.Errorf("(%v) expected a usage error but got %d for %v", flags, code, err)
+		}
+	}
+
+	// 12.34 has one decimal too many for tenths
+	stdout := bytes.Buffer{}
+	if err := realMain(context.Background(), []string{"1brc", "-decimals=1", filePath}, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "12.3") {
+		t.Errorf("expected 12.34 to be skipped with one decimal but got %q", stdout.String())
+	}
+}
+
+func TestRealMainJSONLogs(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	if err := realMain(context.Background(), []string{"1brc", "-log-format=json", "-concurrency-threshold=0", filePath}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != measurements10Out+"\n" {
+		t.Errorf("expected only the result on stdout but got %q", stdout.String())
+	}
+
+	var summary map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected every log line to be JSON but got %q: %v", line, err)
+		}
+		if record["msg"] == "success" {
+			summary = record
+		}
+	}
+	if summary == nil {
+		t.Fatalf("expected a success record in %q", stderr.String())
+	}
+
+	for _, key := range []string{"time", "level", "durationSeconds", "inputPath", "mode", "workers", "chunkSize", "build", "lines", "skippedLines", "stations", "bytes", "rows", "mbPerSecond", "rowsPerSecond"} {
+		if _, ok := summary[key]; !ok {
+			t.Errorf("expected key %q in the summary %v", key, summary)
+		}
+	}
+	if summary["inputPath"] != filePath || summary["mode"] != "concurrent" || summary["chunkSize"] != float64(minAutoChunkSize) {
+		t.Errorf("unexpected run metadata in the summary %v", summary)
+	}
+	if summary["lines"] != float64(10) || summary["skippedLines"] != float64(0) || summary["stations"] != float64(10) || summary["bytes"] != float64(135) {
+		t.Errorf("expected 10 lines of 10 stations in 135 bytes in the summary %v", summary)
+	}
+}
+
+func TestRealMainEmptyInput(t *testing.T) {
+	filePaths := []string{fixturePath(t, measurementsEmptyIn), fixturePath(t, measurementsBlankIn)}
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	for _, fileName := range filePaths {
+		stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+		if err := realMain(context.Background(), []string{"1brc", fileName}, &stdout, &stderr); err != nil {
+			t.Fatalf("(%s) %v", fileName, err)
+		}
+		if stdout.String() != "{}\n" {
+			t.Errorf("(%s) expected an empty result but got %q", fileName, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "msg=success") || !strings.Contains(stderr.String(), " lines=0 skippedLines=0") {
+			t.Errorf("(%s) expected the summary to report zero lines but got %q", fileName, stderr.String())
+		}
+	}
+}
+
+func TestRealMainInvalidLogLevel(t *testing.T) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	err := realMain(context.Background(), []string{"1brc", "-log-level=trace", measurements10In}, &stdout, &stderr)
+	expErr := `invalid log level "trace", expected debug, info, warn or error`
+	if err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+}
+
+// fixturePath returns the absolute path of the fixture name, given with '/'
+// separators relative to the package directory, failing the test when it
+// doesn't exist.
+func fixturePath(tb testing.TB, name string) string {
+	tb.Helper()
+
+	filePath, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		tb.Fatal(err)
+	}
+	return filePath
+}
+
+func TestRunFixturePathSeparators(t *testing.T) {
+	absPath := fixturePath(t, measurements10In)
+	// on Windows these mix '/' and '\', elsewhere they are plain paths
+	paths := []string{
+		measurements10In,
+		"./" + measurements10In,
+		filepath.FromSlash("./" + measurements10In),
+		filepath.Join(".", measurements10In),
+		absPath,
+		filepath.ToSlash(absPath),
+	}
+	for _, filePath := range paths {
+		output, err := runString(context.Background(), filePath, DefaultConfig())
+		if err != nil {
+			t.Fatalf("(%s) %v", filePath, err)
+		}
+		if output != measurements10Out {
+			t.Errorf("(%s) expected %q but got %q", filePath, measurements10Out, output)
+		}
+	}
+}
+
+func TestRunThroughputStats(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		expBytes    int64
+		expRows     int64
+		expSkipped  int64
+		expStations int
+	}{
+		{fileName: measurements10In, expBytes: 135, expRows: 10, expStations: 10},
+		// the malformed last line is read but not aggregated
+		{fileName: measurements10TruncatedIn, expBytes: 145, expRows: 10, expSkipped: 1, expStations: 10},
+	}
+	for _, tc := range tests {
+		for _, mode := range []string{modeSequential, modeConcurrent, modeSharded} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, mode != modeSequential)
+			cfg.Sharded = mode == modeSharded
+			_, stats, err := runWithStats(context.Background(), tc.fileName, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Bytes != tc.expBytes || stats.Rows != tc.expRows || stats.ParseDuration <= 0 {
+				t.Errorf("(%s, %s) expected %d bytes and %d rows but got %d bytes and %d rows in %s", tc.fileName, mode, tc.expBytes, tc.expRows, stats.Bytes, stats.Rows, stats.ParseDuration)
+			}
+			if stats.Lines != tc.expRows || stats.SkippedLines != tc.expSkipped || stats.Stations != tc.expStations {
+				t.Errorf("(%s, %s) expected %d lines, %d skipped and %d stations but got %d lines, %d skipped and %d stations", tc.fileName, mode, tc.expRows, tc.expSkipped, tc.expStations, stats.Lines, stats.SkippedLines, stats.Stations)
+			}
+		}
+	}
+}
+
+func TestRunConcurrencyThreshold(t *testing.T) {
+	// measurements10In is 135 bytes
+	tests := []struct {
+		name        string
+		concurrency bool
+		threshold   int64
+		expMode     string
+	}{
+		{name: "default", concurrency: true, threshold: defaultConcurrencyThreshold, expMode: "sequential"},
+		{name: "at the input size", concurrency: true, threshold: 135, expMode: "concurrent"},
+		{name: "disabled", concurrency: true, threshold: 0, expMode: "concurrent"},
+		{name: "sequential", concurrency: false, threshold: 0, expMode: "sequential"},
+	}
+	for _, tc := range tests {
+		cfg := DefaultConfig()
+		cfg.Concurrency = tc.concurrency
+		cfg.ConcurrencyThreshold = tc.threshold
+		output, stats, err := runWithStats(context.Background(), measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurements10Out || stats.Mode != tc.expMode {
+			t.Errorf("(%s) expected %q in %s mode but got %q in %s mode", tc.name, measurements10Out, tc.expMode, output, stats.Mode)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.ConcurrencyThreshold = -1
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected a negative concurrency threshold to be rejected")
+	}
+}
+
+// setConcurrency picks the engine of cfg, disabling the sequential fallback
+// so the concurrent engine also parses the small test inputs.
+func setConcurrency(cfg *Config, concurrency bool) {
+	cfg.Concurrency = concurrency
+	cfg.ConcurrencyThreshold = 0
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRunCSV(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := DefaultConfig()
+	cfg.Format = formatCSV
+
+	output, err := runString(ctx, measurements10In, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expRecords := [][]string{
+		{"station", "min", "mean", "max", "count"},
+		{"Adelaide", "15.0", "15.0", "15.0", "1"},
+		{"Cabo San Lucas", "14.9", "14.9", "14.9", "1"},
+		{"Dodoma", "22.2", "22.2", "22.2", "1"},
+		{"Halifax", "12.9", "12.9", "12.9", "1"},
+		{"Karachi", "15.4", "15.4", "15.4", "1"},
+		{"Pittsburgh", "9.7", "9.7", "9.7", "1"},
+		{"Ségou", "25.7", "25.7", "25.7", "1"},
+		{"Tauranga", "38.2", "38.2", "38.2", "1"},
+		{"Xi'an", "24.2", "24.2", "24.2", "1"},
+		{"Zagreb", "12.2", "12.2", "12.2", "1"},
+	}
+	if !reflect.DeepEqual(expRecords, records) {
+		t.Errorf("expected %+v but got %+v", expRecords, records)
+	}
+}
+
+func TestCreateCSVResultQuoting(t *testing.T) {
+	locations := []string{`Foo, "Bar"`}
+	locationMap := map[string]Location{
+		`Foo, "Bar"`: {Min: -12, Max: 34, Total: 22, Count: 2},
+	}
+
+	output, err := createCSVResult(locations, locationMap, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expRecords := [][]string{
+		{"station", "min", "mean", "max", "count"},
+		{`Foo, "Bar"`, "-1.2", "1.1", "3.4", "2"},
+	}
+	if !reflect.DeepEqual(expRecords, records) {
+		t.Errorf("expected %+v but got %+v", expRecords, records)
+	}
+}
+
+func TestRunDelimiter(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Delimiter = ','
+
+		output, err := runString(ctx, measurements10CommaIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurements10Out {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurements10Out, output)
+		}
+	}
+}
+
+func TestRunDecimalComma(t *testing.T) {
+	ctx := context.Background()
+
+	hundredths := filepath.Join(t.TempDir(), "measurements_hundredths_decimal_comma.txt")
+	if err := os.WriteFile(hundredths, []byte("a;-1,05\na;12,34\nb;0,5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.DecimalComma = true
+
+		output, err := runString(ctx, measurements10DecimalIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurements10Out {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurements10Out, output)
+		}
+
+		cfg.Precision = 2
+		output, err = runString(ctx, hundredths, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{a=-1.05/5.65/12.34, b=0.50/0.50/0.50}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v, precision=2) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+
+	// the decimal point is invalid with -decimal-comma
+	cfg := DefaultConfig()
+	cfg.DecimalComma = true
+	_, stats, err := runWithStats(ctx, measurements10In, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SkippedLines != 10 {
+		t.Errorf("expected the 10 lines with a decimal point skipped but got %d", stats.SkippedLines)
+	}
+}
+
+func TestRunHundredths(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Precision = 2
+
+		output, err := runString(ctx, measurementsHundredthsIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurementsHundredthsOut {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurementsHundredthsOut, output)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		temperature string
+		expVal      int64
+		expOk       bool
+	}{
+		{temperature: "1.2", expVal: 12, expOk: true},
+		{temperature: "12.3", expVal: 123, expOk: true},
+		{temperature: "-0.1", expVal: -1, expOk: true},
+		{temperature: "100.0", expVal: 1000, expOk: true},
+		{temperature: "999.9", expVal: 9999, expOk: true},
+		{temperature: "-100.0", expVal: -1000, expOk: true},
+		{temperature: "-999.9", expVal: -9999, expOk: true},
+		{temperature: "1000.0", expOk: false},
+		{temperature: "12.34", expOk: false},
+		{temperature: "1a2.3", expOk: false},
+		{temperature: "12a.3", expOk: false},
+		{temperature: "+1.2", expVal: 12, expOk: true},
+		{temperature: "+12.3", expVal: 123, expOk: true},
+		{temperature: "+999.9", expVal: 9999, expOk: true},
+		{temperature: "--1.2", expOk: false},
+		{temperature: "+-1.2", expOk: false},
+		{temperature: "-+1.2", expOk: false},
+		{temperature: "++1.2", expOk: false},
+		{temperature: "+", expOk: false},
+		{temperature: ".1", expOk: false},
+		{temperature: "-", expOk: false},
+		{temperature: "", expOk: false},
+	}
+
+	for _, tc := range tests {
+		val, ok := parseNumber(tc.temperature, '.')
+		if ok != tc.expOk || (ok && val != tc.expVal) {
+			t.Errorf("parseNumber(%q) expected %d, %v but got %d, %v", tc.temperature, tc.expVal, tc.expOk, val, ok)
+		}
+	}
+}
+
+func TestRunThreeIntegerDigits(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "measurements_three_digits.txt")
+	if err := os.WriteFile(filePath, []byte("a;100.0\na;999.9\nb;-100.0\nb;-999.9\nb;12.3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{a=100.0/550.0/999.9, b=-999.9/-362.5/12.3}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		// readings beyond ±99.9 are kept apart from the histogram's counts
+		cfg.Percentiles = []float64{50, 100}
+		output, err = runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "{a=100.0/550.0/999.9/100.0/999.9, b=-999.9/-362.5/12.3/-100.0/12.3}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestTemperatureMemo(t *testing.T) {
+	for _, precision := range []int{1, 2} {
+		memo := newTemperatureMemo(precision)
+		// twice so the second pass reads the memoized strings, beyond the
+		// memoized range at both ends
+		for pass := 0; pass < 2; pass++ {
+			for val := int64(-12000); val <= 12000; val++ {
+				if got, exp := memo.format(val), formatTemperature(val, precision); got != exp {
+					t.Fatalf("(precision=%d) format(%d) expected %q but got %q", precision, val, exp, got)
+				}
+			}
+		}
+	}
+}
+
+func TestAppendTenths(t *testing.T) {
+	tests := []struct {
+		val    int64
+		expOut string
+	}{
+		{val: 0, expOut: "0.0"},
+		{val: 5, expOut: "0.5"},
+		{val: -1, expOut: "-0.1"},
+		{val: -9, expOut: "-0.9"},
+		{val: -10, expOut: "-1.0"},
+		{val: 999, expOut: "99.9"},
+		{val: -999, expOut: "-99.9"},
+		{val: 123456789, expOut: "12345678.9"},
+		{val: math.MinInt64, expOut: "-922337203685477580.8"},
+	}
+
+	for _, test := range tests {
+		if got := string(appendTenths(nil, test.val)); got != test.expOut {
+			t.Errorf("appendTenths(%d) expected %q but got %q", test.val, test.expOut, got)
+		}
+	}
+
+	// the float64 formatting it replaces, exact in this range
+	for val := int64(-20000); val <= 20000; val++ {
+		for precision, scale := range map[int]float64{1: 10, 2: 100} {
+			exp := strconv.FormatFloat(float64(val)/scale, 'f', precision, 64)
+			if got := formatTemperature(val, precision); got != exp {
+				t.Fatalf("(precision=%d) formatTemperature(%d) expected %q but got %q", precision, val, exp, got)
+			}
+		}
+	}
+	if got := formatTemperature(-5, 2); got != "-0.05" {
+		t.Errorf("expected -0.05 but got %q", got)
+	}
+}
+
+func TestParseNumberHundredths(t *testing.T) {
+	tests := []struct {
+		temperature string
+		expVal      int64
+		expOk       bool
+	}{
+		{temperature: "1.23", expVal: 123, expOk: true},
+		{temperature: "12.34", expVal: 1234, expOk: true},
+		{temperature: "-0.01", expVal: -1, expOk: true},
+		{temperature: "-99.99", expVal: -9999, expOk: true},
+		// single decimal values are normalized to hundredths
+		{temperature: "12.3", expVal: 1230, expOk: true},
+		{temperature: "-1.2", expVal: -120, expOk: true},
+		{temperature: "+12.34", expVal: 1234, expOk: true},
+		{temperature: "+1.2", expVal: 120, expOk: true},
+		{temperature: "1.234", expOk: false},
+		{temperature: "123.45", expOk: false},
+		{temperature: "1.2a", expOk: false},
+		{temperature: "-.12", expOk: false},
+		{temperature: "", expOk: false},
+	}
+
+	for _, tc := range tests {
+		val, ok := parseNumberHundredths(tc.temperature, '.')
+		if ok != tc.expOk || (ok && val != tc.expVal) {
+			t.Errorf("parseNumberHundredths(%q) expected %d, %v but got %d, %v", tc.temperature, tc.expVal, tc.expOk, val, ok)
+		}
+	}
+}
+
+func TestValidateConfigDelimiter(t *testing.T) {
+	for _, delimiter := range []byte{';', ',', '\t', '|'} {
+		cfg := DefaultConfig()
+		cfg.Delimiter = delimiter
+		if err := validateConfig(cfg); err != nil {
+			t.Errorf("expected delimiter %q to be valid but got %v", delimiter, err)
+		}
+	}
+
+	for _, delimiter := range []byte{'\n', '\r', '.', '-', '0', '9'} {
+		cfg := DefaultConfig()
+		cfg.Delimiter = delimiter
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("expected delimiter %q to be rejected", delimiter)
+		}
+	}
+
+	// a decimal comma would be ambiguous with a comma delimiter
+	cfg := DefaultConfig()
+	cfg.Delimiter = ','
+	cfg.DecimalComma = true
+	expErr := "a ',' delimiter can't be combined with -decimal-comma"
+	if err := validateConfig(cfg); err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 500_000, 1)
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Timeout = time.Millisecond
+
+		_, err := runString(ctx, filePath, cfg)
+		expErr := "timed out after 1ms"
+		if err == nil || err.Error() != expErr {
+			t.Errorf("(concurrency=%v) expected error %q but got %v", concurrency, expErr, err)
+		}
+	}
+}
+
+func TestRunUnordered(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+
+	for _, concurrency := range []bool{true, false} {
+		for _, format := range []string{formatText, formatCSV} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Format = format
+
+			ordered, err := runString(ctx, filePath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Unordered = true
+			unordered, err := runString(ctx, filePath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// sorting the entries of the unordered output must give the ordered one
+			var entries []string
+			if format == formatCSV {
+				rows := strings.Split(strings.TrimSuffix(unordered, "\n"), "\n")
+				entries = rows[1:]
+				sort.Strings(entries)
+				unordered = rows[0] + "\n" + strings.Join(entries, "\n") + "\n"
+			} else {
+				entries = strings.Split(strings.TrimSuffix(strings.TrimPrefix(unordered, "{"), "}"), ", ")
+				sort.Strings(entries)
+				unordered = "{" + strings.Join(entries, ", ") + "}"
+			}
+			if unordered != ordered {
+				t.Errorf("(concurrency=%v, format=%s) expected sorted unordered output %+v but got %+v", concurrency, format, ordered, unordered)
+			}
+		}
+	}
+}
+
+func TestRunCancelledTeardown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping 100 cancelled runs in short mode")
+	}
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	setConcurrency(&cfg, true)
+	defer func() { mergeHook = nil }()
+
+	// baseline after a first run so lazily initialized state isn't counted
+	if _, err := runString(context.Background(), filePath, cfg); err != nil {
+		t.Fatal(err)
+	}
+	goroutines, heap := runtime.NumGoroutine(), settledHeap()
+
+	for i := 0; i < 100; i++ {
+		// cancel from the merger midway, with workers still sending
+		ctx, cancel := context.WithCancel(context.Background())
+		var once sync.Once
+		mergeHook = func(string, *Location) { once.Do(cancel) }
+
+		_, err := runString(ctx, filePath, cfg)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("run %d: expected a cancellation error but got %v", i, err)
+		}
+
+		if n := waitGoroutines(goroutines); n > goroutines {
+			t.Fatalf("run %d: expected at most %d goroutines after the cancelled run but got %d", i, goroutines, n)
+		}
+	}
+	mergeHook = nil
+
+	// leaked chunk maps would hold at least 100 runs of chunks
+	if h := settledHeap(); h > heap+4<<20 {
+		t.Errorf("expected the heap to return to about %d bytes but got %d", heap, h)
+	}
+}
+
+// waitGoroutines returns the goroutine count once it is at most max, giving
+// exiting goroutines up to a second.
+func waitGoroutines(max int) int {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > max && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
+
+// settledHeap returns the live heap after a garbage collection.
+func settledHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestRunMergePanic(t *testing.T) {
+	filePath := generateMeasurementsFile(t, 100_000, 1)
+	cfg := DefaultConfig()
+	setConcurrency(&cfg, true)
+	goroutines := runtime.NumGoroutine()
+
+	mergeHook = func(name string, loc *Location) {
+		if loc.Count > 100 {
+			panic(fmt.Sprintf("invariant violated by %s", name))
+		}
+	}
+	defer func() { mergeHook = nil }()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := runString(context.Background(), filePath, cfg)
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if err == nil || !strings.Contains(err.Error(), "merging results panicked: invariant violated") {
+			t.Errorf("expected a merge panic error but got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not return after the merger panicked")
+	}
+
+	// the workers and the orchestrator must have exited with run
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("expected at most %d goroutines after run but got %d", goroutines, n)
+	}
+}
+
+func TestParseFileWithConcurrencyShrinkingInput(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurementsRoundingIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is truncated right after the BOM check, before any chunk is read
+	file := &shrinkingSource{data: data, shrinkAfter: 1, shrinkTo: 1000}
+	cfg := DefaultConfig()
+	cfg.Strict = true
+
+	locations, locationMap, _, err := parseFileWithConcurrency(ctx, file, cfg, nil)
+	expErr := fmt.Sprintf("input shrank from %d to 1000 bytes", len(data))
+	if err == nil || !strings.Contains(err.Error(), expErr) {
+		t.Fatalf("expected error containing %q but got %v", expErr, err)
+	}
+	if locations != nil || locationMap != nil {
+		t.Errorf("expected no partial results but got %d locations", len(locationMap))
+	}
+}
+
+func TestParseFileWithConcurrencyShrinkingInputLenient(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(generateMeasurementsFile(t, 10_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shrinkTo := len(data) / 2
+
+	for _, sharded := range []bool{false, true} {
+		// the file is truncated to half its size after the first chunks
+		file := &shrinkingSource{data: data, shrinkAfter: 4, shrinkTo: shrinkTo}
+		cfg := DefaultConfig()
+		cfg.ChunkSize = 4096
+		cfg.Readers = 1
+		parse := parseFileWithConcurrency
+		if sharded {
+			parse = parseFileSharded
+		}
+
+		_, locationMap, scan, err := parse(ctx, file, cfg, nil)
+		var partial *partialError
+		if !errors.As(err, &partial) {
+			t.Fatalf("(sharded=%t) expected a partial result but got %v", sharded, err)
+		}
+		expErr := fmt.Sprintf("input shrank from %d to %d bytes", len(data), shrinkTo)
+		if !strings.Contains(err.Error(), expErr) {
+			t.Errorf("(sharded=%t) expected error containing %q but got %v", sharded, expErr, err)
+		}
+		// the chunks before the new end are still read, those past it aren't
+		if partial.err.processed < int64(shrinkTo)-4096 || partial.err.processed >= int64(len(data)) {
+			t.Errorf("(sharded=%t) expected about %d processed bytes but got %d", sharded, shrinkTo, partial.err.processed)
+		}
+		var readings int64
+		for _, loc := range locationMap {
+			readings += loc.Count
+		}
+		if readings != scan.lines || readings == 0 || readings >= 10_000 {
+			t.Errorf("(sharded=%t) expected part of the 10000 readings counted in %d lines but got %d", sharded, scan.lines, readings)
+		}
+	}
+}
+
+func TestRunShrinkingInput(t *testing.T) {
+	chdir(t, t.TempDir())
+	filePath := filepath.Join(t.TempDir(), "measurements.txt")
+	data, err := os.ReadFile(generateMeasurementsFile(t, 50_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { mergeHook = nil }()
+
+	for _, strict := range []bool{false, true} {
+		if err := os.WriteFile(filePath, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// truncate the file once the first chunk is merged, with the
+		// readers held back by the bounded channels
+		var once sync.Once
+		mergeHook = func(string, *Location) {
+			once.Do(func() {
+				if err := os.Truncate(filePath, 1000); err != nil {
+					panic(err)
+				}
+			})
+		}
+
+		args := []string{"1brc", "-quiet", "-mode=concurrent", "-concurrency-threshold=0", "-chunk-size=4096", "-readers=1", fmt.Sprintf("-strict=%t", strict), filePath}
+		var stdout bytes.Buffer
+		err := realMain(context.Background(), args, &stdout, &bytes.Buffer{})
+		if !strings.Contains(fmt.Sprint(err), fmt.Sprintf("input shrank from %d to 1000 bytes", len(data))) {
+			t.Fatalf("(strict=%t) expected the shrink error but got %v", strict, err)
+		}
+		if strict {
+			if code := exitCode(err); code != exitInput {
+				t.Errorf("expected exit code %d but got %d", exitInput, code)
+			}
+			if stdout.Len() > 0 {
+				t.Errorf("expected no output but got %q", stdout.String())
+			}
+			continue
+		}
+		if code := exitCode(err); code != exitPartial {
+			t.Errorf("expected exit code %d but got %d", exitPartial, code)
+		}
+		if !strings.HasPrefix(stdout.String(), "{") || !strings.HasSuffix(stdout.String(), "}"+partialMarker+"\n") {
+			t.Errorf("expected a result marked partial but got %q", stdout.String())
+		}
+	}
+}
+
+func TestParseFileWithConcurrencyReadError(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(generateMeasurementsFile(t, 10_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &failingSource{data: data, failAt: int64(len(data) / 2)}
+
+	// every engine built on lineOrchestrator must surface the failure
+	engines := []struct {
+		name  string
+		parse func(context.Context, source, Config, *inputHasher) ([]string, map[string]Location, scanStats, error)
+		cfg   func(*Config)
+	}{
+		{name: "concurrent", parse: parseFileWithConcurrency, cfg: func(*Config) {}},
+		{name: "fast-map", parse: parseFileWithConcurrency, cfg: func(cfg *Config) { cfg.FastMap = true }},
+		{name: "sharded", parse: parseFileSharded, cfg: func(*Config) {}},
+		{name: "readers", parse: parseFileWithConcurrency, cfg: func(cfg *Config) { cfg.Readers = 2 }},
+	}
+	for _, engine := range engines {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = 4096
+		engine.cfg(&cfg)
+
+		locations, locationMap, _, err := engine.parse(ctx, file, cfg, nil)
+		if !errors.Is(err, errInjectedRead) {
+			t.Fatalf("(%s) expected the injected read error but got %v", engine.name, err)
+		}
+		if !strings.Contains(err.Error(), "reading chunk at offset ") {
+			t.Errorf("(%s) expected the chunk offset in the error but got %v", engine.name, err)
+		}
+		if locations != nil || locationMap != nil {
+			t.Errorf("(%s) expected no partial results but got %d locations", engine.name, len(locationMap))
+		}
+	}
+}
+
+func TestParseFileWithConcurrencyWorkerError(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	cfg.Strict = true
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, expMap, _, err := parseFile(ctx, f, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroutines := runtime.NumGoroutine()
+	_, locationMap, _, err := parseFileWithConcurrency(ctx, f, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(locationMap, expMap) {
+		t.Error("expected the concurrent result to match the sequential one")
+	}
+
+	// a malformed line in the middle fails its worker under -strict, which
+	// must cancel the other workers and the merger
+	middle := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2 + 1
+	data = append(data[:middle:middle], append([]byte("malformed\n"), data[middle:]...)...)
+	file := &failingSource{data: data, failAt: int64(len(data))}
+
+	locations, locationMap, _, err := parseFileWithConcurrency(ctx, file, cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), `malformed line "malformed"`) {
+		t.Fatalf("expected the worker error but got %v", err)
+	}
+	if locations != nil || locationMap != nil {
+		t.Errorf("expected no partial results but got %d locations", len(locationMap))
+	}
+	if n := waitGoroutines(goroutines); n > goroutines {
+		t.Errorf("expected at most %d goroutines after the failed run but got %d", goroutines, n)
+	}
+}
+
+var errInjectedRead = errors.New("injected read error")
+
+// failingSource is an in-memory source failing chunk reads from offset failAt
+// on. The single byte reads finding line boundaries succeed.
+type failingSource struct {
+	data   []byte
+	failAt int64
+}
+
+func (s *failingSource) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > 1 && off >= s.failAt {
+		return 0, errInjectedRead
+	}
+	return bytes.NewReader(s.data).ReadAt(p, off)
+}
+
+func (s *failingSource) Stat() (fs.FileInfo, error) {
+	return fakeFileInfo{size: int64(len(s.data))}, nil
+}
+
+func TestParseFileWithConcurrencyShortReads(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(generateMeasurementsFile(t, 10_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+
+	_, expLocationMap, _, err := parseFileWithConcurrency(ctx, &dribblingSource{data: data, dribble: len(data)}, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, locationMap, _, err := parseFileWithConcurrency(ctx, &dribblingSource{data: data, dribble: 7}, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(locationMap, expLocationMap) {
+		t.Errorf("expected short reads to aggregate the same %d stations but got %d", len(expLocationMap), len(locationMap))
+	}
+}
+
+func TestParseFileWithConcurrencyLocations(t *testing.T) {
+	ctx := context.Background()
+
+	var input bytes.Buffer
+	if err := generateStationMeasurements(&input, 50_000, 2_000, 1); err != nil {
+		t.Fatal(err)
+	}
+	data := input.Bytes()
+	var expOutput string
+	for i, fastMap := range []bool{false, false, true} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = 4096
+		cfg.FastMap = fastMap
+
+		locations, locationMap, _, err := parseFileWithConcurrency(ctx, &dribblingSource{data: data, dribble: len(data)}, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stations are the keys of the map, each listed once
+		expLocations := make([]string, 0, len(locationMap))
+		for name := range locationMap {
+			expLocations = append(expLocations, name)
+		}
+		sort.Strings(expLocations)
+		sort.Strings(locations)
+		if !reflect.DeepEqual(locations, expLocations) {
+			t.Fatalf("(fastMap=%t) expected the %d stations of the map but got %d", fastMap, len(expLocations), len(locations))
+		}
+
+		output, err := createResult(locations, locationMap, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			expOutput = output
+		} else if output != expOutput {
+			t.Errorf("(run %d, fastMap=%t) expected the output of the first run", i, fastMap)
+		}
+	}
+
+	// and the sequential parser agrees
+	cfg := DefaultConfig()
+	cfg.Concurrency = false
+	filePath := filepath.Join(t.TempDir(), "measurements.txt")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := runString(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != strings.TrimSuffix(expOutput, "\n") {
+		t.Error("expected the sequential output to equal the concurrent one")
+	}
+}
+
+func TestReadFullAt(t *testing.T) {
+	data := []byte("ab;1.0\ncd;2.0\n")
+
+	tests := []struct {
+		name   string
+		file   io.ReaderAt
+		size   int
+		expN   int
+		expErr error
+	}{
+		{name: "full", file: bytes.NewReader(data), size: len(data), expN: len(data)},
+		{name: "eof with full read", file: &dribblingSource{data: data, dribble: len(data)}, size: len(data), expN: len(data)},
+		{name: "dribbles", file: &dribblingSource{data: data, dribble: 3}, size: len(data), expN: len(data)},
+		{name: "past the end", file: &dribblingSource{data: data, dribble: 3}, size: len(data) + 1, expN: len(data), expErr: io.EOF},
+		{name: "no progress", file: &dribblingSource{data: data}, size: len(data), expN: 0, expErr: io.ErrNoProgress},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := make([]byte, tc.size)
+			n, err := readFullAt(tc.file, p, 0)
+			if n != tc.expN || err != tc.expErr {
+				t.Fatalf("expected %d, %v but got %d, %v", tc.expN, tc.expErr, n, err)
+			}
+			if !bytes.Equal(p[:n], data[:n]) {
+				t.Errorf("expected %q but got %q", data[:n], p[:n])
+			}
+		})
+	}
+}
+
+// dribblingSource is an in-memory source returning at most dribble bytes per
+// read without an error, and io.EOF along with the read reaching the end.
+type dribblingSource struct {
+	data    []byte
+	dribble int
+}
+
+func (s *dribblingSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), s.dribble)], s.data[off:])
+	if off+int64(n) == int64(len(s.data)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (s *dribblingSource) Stat() (fs.FileInfo, error) {
+	return fakeFileInfo{size: int64(len(s.data))}, nil
+}
+
+// shrinkingSource is an in-memory source that is truncated to shrinkTo bytes
+// after shrinkAfter reads.
+type shrinkingSource struct {
+	mu          sync.Mutex
+	data        []byte
+	reads       int
+	shrinkAfter int
+	shrinkTo    int
+}
+
+func (s *shrinkingSource) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	if s.reads > s.shrinkAfter && len(s.data) > s.shrinkTo {
+		s.data = s.data[:s.shrinkTo]
+	}
+	return bytes.NewReader(s.data).ReadAt(p, off)
+}
+
+func (s *shrinkingSource) Stat() (fs.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return fakeFileInfo{size: int64(len(s.data))}, nil
+}
+
+type fakeFileInfo struct {
+	size int64
+}
+
+func (fi fakeFileInfo) Name() string       { return "measurements.txt" }
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) Mode() fs.FileMode  { return 0o644 }
+func (fi fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fakeFileInfo) IsDir() bool        { return false }
+func (fi fakeFileInfo) Sys() any           { return nil }
+
+func TestFindNextLineBoundary(t *testing.T) {
+	data := []byte("ab;1.0\ncd;2.0\nef;3.0")
+	file := bytes.NewReader(data)
+	fileSize := int64(len(data))
+
+	tests := []struct {
+		start       int64
+		expBoundary int64
+	}{
+		{start: 10, expBoundary: 6},
+		{start: 6, expBoundary: 6},
+		{start: 16, expBoundary: 13},
+		{start: fileSize, expBoundary: fileSize},
+		{start: fileSize + 5, expBoundary: fileSize},
+	}
+
+	for _, tc := range tests {
+		got, err := findNextLineBoundary(file, tc.start, fileSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.expBoundary {
+			t.Errorf("findNextLineBoundary(%d) expected %d but got %d", tc.start, tc.expBoundary, got)
+		}
+	}
+}
+
+func TestChunkBoundariesPastTwoGigabytes(t *testing.T) {
+	// a sparse file simulates the size without allocating it
+	f, err := os.Create(filepath.Join(t.TempDir(), "measurements_sparse.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const fileSize = 5 << 30
+	if err := f.Truncate(fileSize); err != nil {
+		t.Skipf("sparse files not supported: %v", err)
+	}
+	lines := []byte("ab;1.0\ncd;2.0\n")
+	offset := int64(3 << 30)
+	if _, err := f.WriteAt(lines, offset); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		start     int64
+		chunkSize int64
+		expEnd    int64
+	}{
+		{name: "line boundary", start: offset - 2000, chunkSize: 2007, expEnd: offset + 6},
+		{name: "final chunk", start: fileSize - 10, chunkSize: testChunkSize, expEnd: fileSize},
+		{name: "max chunk size", start: offset - maxChunkSize + 7, chunkSize: maxChunkSize, expEnd: offset + 6},
+		{name: "no overflow", start: offset, chunkSize: math.MaxInt64, expEnd: fileSize},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			end, err := chunkEnd(f, tc.start, fileSize, tc.chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end != tc.expEnd {
+				t.Errorf("expected end %d but got %d", tc.expEnd, end)
+			}
+		})
+	}
+
+	length, err := chunkLength(offset, offset+int64(len(lines)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, length)
+	if _, err := readFullAt(f, chunk, offset); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chunk, lines) {
+		t.Errorf("expected %q at offset %d but got %q", lines, offset, chunk)
+	}
+}
+
+func TestAutoChunkSize(t *testing.T) {
+	tests := []struct {
+		fileSize int64
+		workers  int
+		expSize  int64
+	}{
+		{fileSize: 0, workers: 8, expSize: minAutoChunkSize},
+		{fileSize: 246, workers: 8, expSize: minAutoChunkSize},
+		{fileSize: 64 << 20, workers: 8, expSize: minAutoChunkSize},
+		{fileSize: 1 << 30, workers: 8, expSize: 16 << 20},
+		{fileSize: 1 << 30, workers: 64, expSize: 2 << 20},
+		{fileSize: 13 << 30, workers: 1, expSize: maxAutoChunkSize},
+		{fileSize: 13 << 30, workers: 64, expSize: 13 << 30 / (64 * autoChunksPerWorker)},
+	}
+	for _, tc := range tests {
+		if size := autoChunkSize(tc.fileSize, tc.workers); size != tc.expSize {
+			t.Errorf("autoChunkSize(%d, %d) expected %d but got %d", tc.fileSize, tc.workers, tc.expSize, size)
+		}
+	}
+
+	// an explicit chunk size is kept whatever the file size
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	if size := cfg.chunkSizeFor(13 << 30); size != 4096 {
+		t.Errorf("expected the chunk size 4096 but got %d", size)
+	}
+}
+
+func TestChunkEndLongLine(t *testing.T) {
+	data := []byte("a;1.0\n" + strings.Repeat("x", 100) + ";2.0\nb;3.0\n" + strings.Repeat("y", 5000) + ";4.0")
+	file := bytes.NewReader(data)
+	fileSize := int64(len(data))
+
+	// lines longer than the chunk extend it to their end, or to the end of
+	// the file for the last line
+	var ends []int64
+	for start := int64(0); start < fileSize; {
+		end, err := chunkEnd(file, start, fileSize, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, end)
+		start = end
+	}
+	long := int64(bytes.IndexByte(data[6:], '\n') + 6)
+	expEnds := []int64{5, long, long + 6, fileSize}
+	if !reflect.DeepEqual(ends, expEnds) {
+		t.Errorf("expected chunk ends %v but got %v", expEnds, ends)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.ChunkSize = 8
+		filePath := filepath.Join(t.TempDir(), "measurements_long_line.txt")
+		if err := os.WriteFile(filePath, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		output, stats, err := runWithStats(context.Background(), filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the 5000 byte name is over the name length limit
+		expOutput := "{a=1.0/1.0/1.0, b=3.0/3.0/3.0, " + strings.Repeat("x", 100) + "=2.0/2.0/2.0}"
+		if output != expOutput || stats.SkippedLines != 1 {
+			t.Errorf("(concurrency=%v) expected %+v with 1 skipped line but got %+v with %d", concurrency, expOutput, output, stats.SkippedLines)
+		}
+	}
+}
+
+func TestChunkLength(t *testing.T) {
+	start := int64(3 << 30)
+	if length, err := chunkLength(start, start+maxChunkSize); err != nil || length != maxChunkSize {
+		t.Errorf("expected length %d but got %d, %v", maxChunkSize, length, err)
+	}
+	for _, end := range []int64{start + maxChunkSize + 1, start - 1} {
+		if _, err := chunkLength(start, end); err == nil {
+			t.Errorf("expected an error for the chunk from %d to %d", start, end)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.ChunkSize = maxChunkSize + 1
+	if err := validateConfig(cfg); err == nil {
+		t.Errorf("expected chunk size %d to be rejected", cfg.ChunkSize)
+	}
+}
+
+func TestRunLastLineWithoutNewline(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurementsRoundingIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a station only present on the final, unterminated line of the last chunk
+	data = append(bytes.TrimRight(data, "\n"), "\nzzz;1.0"...)
+	filePath := filepath.Join(t.TempDir(), "measurements_no_trailing_newline.txt")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	expOutput := strings.TrimSuffix(measurementsRoundingOut, "}") + ", zzz=1.0/1.0/1.0}"
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.ChunkSize = testChunkSize
+
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunStdDev(t *testing.T) {
+	ctx := context.Background()
+
+	// population standard deviations: a = sqrt(1.25) = 1.118, b = 0
+	filePath := filepath.Join(t.TempDir(), "measurements_stddev.txt")
+	data := "a;1.0\na;2.0\nb;-5.5\na;3.0\na;4.0\nb;-5.5\n"
+	if err := os.WriteFile(filePath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.StdDev = true
+
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{a=1.0/2.5/4.0/1.1, b=-5.5/-5.5/-5.5/0.0}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		cfg.Format = formatCSV
+		output, err = runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "station,min,mean,max,count,stddev\na,1.0,2.5,4.0,4,1.1\nb,-5.5,-5.5,-5.5,2,0.0\n"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestParseFileNoTrailingNewline(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(generateMeasurementsFile(t, 10_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	inputs := map[string][]byte{
+		"lf":   bytes.TrimSuffix(data, []byte("\n")),
+		"crlf": bytes.TrimSuffix(bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")), []byte("\n")),
+		// a short last line after the newline ending the generated lines
+		"short": append(data, "Zagreb;-3.5"...),
+	}
+
+	for name, input := range inputs {
+		filePath := filepath.Join(dir, name+".txt")
+		if err := os.WriteFile(filePath, input, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		cfg := DefaultConfig()
+		_, expMap, expScan, err := parseFile(ctx, f, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int64
+		for _, loc := range expMap {
+			count += loc.Count
+		}
+		expCount := int64(bytes.Count(input, []byte("\n")) + 1)
+		if count != expCount || expScan.skipped != 0 {
+			t.Fatalf("(%s) expected parseFile to count %d lines but got %d with %d skipped", name, expCount, count, expScan.skipped)
+		}
+
+		for _, chunkSize := range []int64{4096, 64 * 1024, 0} {
+			cfg.ChunkSize = chunkSize
+			_, locationMap, scan, err := parseFileWithConcurrency(ctx, f, cfg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(locationMap, expMap) || scan.lines != expScan.lines {
+				t.Errorf("(%s, chunkSize=%d) expected the concurrent result to match parseFile", name, chunkSize)
+			}
+		}
+	}
+}
+
+func TestRunLastLine(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurements10In)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		t.Fatalf("expected %s to end without a trailing newline", measurements10In)
+	}
+
+	tests := []struct {
+		fileName   string
+		expSkipped int64
+	}{
+		{fileName: measurements10In},
+		{fileName: measurements10TruncatedIn, expSkipped: 1},
+	}
+	for _, tc := range tests {
+		for _, concurrency := range []bool{false, true} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			output, stats, err := runWithStats(ctx, tc.fileName, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != measurements10Out || stats.SkippedLines != tc.expSkipped {
+				t.Errorf("(%s, concurrency=%v) expected %q with %d skipped but got %q with %d skipped", tc.fileName, concurrency, measurements10Out, tc.expSkipped, output, stats.SkippedLines)
+			}
+
+			cfg.Strict = true
+			if _, err := runString(ctx, tc.fileName, cfg); (err != nil) != (tc.expSkipped > 0) {
+				t.Errorf("(%s, concurrency=%v) expected -strict to fail on a truncated last line only but got %v", tc.fileName, concurrency, err)
+			}
+		}
+	}
+}
+
+func TestRunNegativeFractions(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "measurements_negative_fractions.txt")
+	data := "a;-0.1\na;-0.2\nb;-0.1\nb;0.1\nc;-0.1\nc;0.0\n"
+	if err := os.WriteFile(filePath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// half-up rounds the -0.05 mean of c towards positive infinity
+	expOutput := "{a=-0.2/-0.1/-0.1, b=-0.1/0.0/0.1, c=-0.1/0.0/0.0}"
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %q but got %q", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunPlusSign(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "measurements_plus.txt")
+	unsigned := filepath.Join(dir, "measurements_unsigned.txt")
+	data := "a;+1.2\nb;+12.3\na;-0.5\nb;+0.0\na;+7\n"
+	if err := os.WriteFile(signed, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(unsigned, []byte(strings.ReplaceAll(data, "+", "")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		for _, precision := range []int{1, 2} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Precision = precision
+			cfg.AllowIntegerTemps = true
+
+			expOutput, err := runString(ctx, unsigned, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, stats, err := runWithStats(ctx, signed, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != expOutput || stats.SkippedLines != 0 {
+				t.Errorf("(concurrency=%v, precision=%d) expected %+v but got %+v with %d skipped lines", concurrency, precision, expOutput, output, stats.SkippedLines)
+			}
+		}
+	}
+}
+
+func TestRunCount(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Count = true
+
+		output, err := runString(ctx, measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every station of measurements_ten.txt has a single reading
+		expOutput := strings.ReplaceAll(measurements10Out, ",", " (count=1),")
+		expOutput = strings.TrimSuffix(expOutput, "}") + " (count=1)}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		cfg.StdDev = true
+		output, err = runString(ctx, measurementsRoundingIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "{ham=14.6/25.5/33.6/7.7 (count=4), jel=-9.0/18.0/46.5/6.9 (count=20124)}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunIntegerTemps(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	mixed := filepath.Join(dir, "measurements_integer.txt")
+	decimal := filepath.Join(dir, "measurements_decimal.txt")
+	mixedLines := "Paris;12\nParis;12.5\nOslo;-3\nOslo;-3.5\nRome;100\nRome;0\nLima;-0\nbad;1-\nbad;1234"
+	decimalLines := "Paris;12.0\nParis;12.5\nOslo;-3.0\nOslo;-3.5\nRome;100.0\nRome;0.0\nLima;-0.0"
+	if err := os.WriteFile(mixed, []byte(mixedLines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(decimal, []byte(decimalLines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, precision := range []int{1, 2} {
+		for _, concurrency := range []bool{true, false} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Precision = precision
+
+			expOutput, err := runString(ctx, decimal, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// integer temperatures are skipped unless allowed
+			_, stats, err := runWithStats(ctx, mixed, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.SkippedLines != 7 || stats.IntegerTemps != 0 {
+				t.Errorf("(precision=%d, concurrency=%v) expected 7 skipped lines but got %+v", precision, concurrency, stats)
+			}
+
+			cfg.AllowIntegerTemps = true
+			output, stats, err := runWithStats(ctx, mixed, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != expOutput {
+				t.Errorf("(precision=%d, concurrency=%v) expected %+v but got %+v", precision, concurrency, expOutput, output)
+			}
+			if stats.SkippedLines != 2 || stats.IntegerTemps != 5 {
+				t.Errorf("(precision=%d, concurrency=%v) expected 2 skipped lines and 5 integer temperatures but got %+v", precision, concurrency, stats)
+			}
+		}
+	}
+}
+
+func TestRunQuoted(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		delimiter byte
+		lines     []string
+		expOutput string
+		expSkip   int64
+	}{
+		{
+			name:      "semicolon",
+			delimiter: ';',
+			lines: []string{
+				`"St. John's, NL";12.3`, `"St. John's, NL";-2.3`, `"a;b";1.0`, `"say ""hi""";5.0`, `plain;2.0`,
+				`"St. John's, NL";5.0`, `"unterminated;3.0`, `"bad"x;1.0`,
+			},
+			expOutput: `{St. John's, NL=-2.3/5.0/12.3, a;b=1.0/1.0/1.0, plain=2.0/2.0/2.0, say "hi"=5.0/5.0/5.0}`,
+			expSkip:   2,
+		},
+		{
+			name:      "comma",
+			delimiter: ',',
+			lines:     []string{`"Washington, D.C.",12.3`, `"Washington, D.C.",14.3`, `Oslo,1.0`},
+			expOutput: `{Oslo=1.0/1.0/1.0, Washington, D.C.=12.3/13.3/14.3}`,
+		},
+	}
+
+	for _, tc := range tests {
+		filePath := filepath.Join(t.TempDir(), "measurements_quoted_"+tc.name+".txt")
+		if err := os.WriteFile(filePath, []byte(strings.Join(tc.lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, concurrency := range []bool{true, false} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Delimiter = tc.delimiter
+			cfg.Quoted = true
+
+			output, stats, err := runWithStats(ctx, filePath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tc.expOutput {
+				t.Errorf("(%s, concurrency=%v) expected %+v but got %+v", tc.name, concurrency, tc.expOutput, output)
+			}
+			if stats.SkippedLines != tc.expSkip {
+				t.Errorf("(%s, concurrency=%v) expected %d skipped lines but got %d", tc.name, concurrency, tc.expSkip, stats.SkippedLines)
+			}
+		}
+	}
+}
+
+func TestRunQuotedFixture(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Quoted = true
+
+		// the unterminated quote is malformed
+		output, stats, err := runWithStats(ctx, measurementsQuotedIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{Foo;Bar Observatory=-4.1/4.1/12.3, Halifax=-0.5/6.2/12.9, Zagreb=12.2/12.2/12.2}"
+		if output != expOutput || stats.SkippedLines != 1 {
+			t.Errorf("(concurrency=%v) expected %+v with 1 skipped line but got %+v with %d", concurrency, expOutput, output, stats.SkippedLines)
+		}
+
+		// without -quoted the names split at their delimiter
+		cfg.Quoted = false
+		output, stats, err = runWithStats(ctx, measurementsQuotedIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = `{"Zagreb"=12.2/12.2/12.2, Halifax=-0.5/6.2/12.9}`
+		if output != expOutput || stats.SkippedLines != 3 {
+			t.Errorf("(concurrency=%v, unquoted) expected %+v with 3 skipped lines but got %+v with %d", concurrency, expOutput, output, stats.SkippedLines)
+		}
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line           string
+		quoted         bool
+		expName        string
+		expTemperature string
+		expOk          bool
+	}{
+		{line: "a;1.0", expName: "a", expTemperature: "1.0", expOk: true},
+		{line: `"a;b";1.0`, expName: `"a`, expTemperature: `b";1.0`, expOk: true},
+		{line: `"a;b";1.0`, quoted: true, expName: "a;b", expTemperature: "1.0", expOk: true},
+		{line: `"";1.0`, quoted: true, expName: "", expTemperature: "1.0", expOk: true},
+		{line: `"a""b";1.0`, quoted: true, expName: `a"b`, expTemperature: "1.0", expOk: true},
+		{line: `"a"""`, quoted: true},
+		{line: `"a;1.0`, quoted: true},
+		{line: `"a"`, quoted: true},
+		{line: `"a" ;1.0`, quoted: true},
+		{line: "no delimiter", quoted: true},
+	}
+
+	for _, tc := range tests {
+		name, temperature, ok := splitLine(tc.line, ';', tc.quoted)
+		if ok != tc.expOk || name != tc.expName || temperature != tc.expTemperature {
+			t.Errorf("splitLine(%q, quoted=%v) expected %q, %q, %v but got %q, %q, %v",
+				tc.line, tc.quoted, tc.expName, tc.expTemperature, tc.expOk, name, temperature, ok)
+		}
+	}
+}
+
+func TestRunWhitespaceLines(t *testing.T) {
+	ctx := context.Background()
+
+	lines := []string{"a;1.0", " ", "\t", "  \r", "a;3.0", "\v\f", ""}
+	filePath := filepath.Join(t.TempDir(), "measurements_whitespace.txt")
+
+	for _, concurrency := range []bool{true, false} {
+		for _, delimiter := range []byte{';', '\t', ' '} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Delimiter = delimiter
+
+			content := strings.ReplaceAll(strings.Join(lines, "\n"), ";", string(delimiter))
+			if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			output, stats, err := runWithStats(ctx, filePath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expOutput := "{a=1.0/2.0/3.0}"
+			if output != expOutput {
+				t.Errorf("(concurrency=%v, delimiter=%q) expected %+v but got %+v", concurrency, delimiter, expOutput, output)
+			}
+			if stats.SkippedLines != 0 {
+				t.Errorf("(concurrency=%v, delimiter=%q) expected whitespace lines not to be skipped but got %d", concurrency, delimiter, stats.SkippedLines)
+			}
+		}
+	}
+
+	var scan scanStats
+	if name, location := processLine(" \t ", DefaultConfig(), &scan); name != "" || location != nil || scan.skipped != 0 {
+		t.Errorf("expected a whitespace line to be ignored but got %q, %+v, %+v", name, location, scan)
+	}
+}
+
+func TestRunNameLength(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+
+		// the glued line has a valid temperature, only its name gives it away
+		output, stats, err := runWithStats(ctx, measurements10GluedIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurements10Out || stats.SkippedLines != 1 {
+			t.Errorf("(concurrency=%v) expected %+v with 1 skipped line but got %+v with %d", concurrency, measurements10Out, output, stats.SkippedLines)
+		}
+
+		cfg.Strict = true
+		_, err = runString(ctx, measurements10GluedIn, cfg)
+		expErr := `station name longer than 100 bytes in line "St. John'sPalembangPetropavlovsk-KamchatskyAddis AbabaWellington..."`
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Errorf("(concurrency=%v) expected error %q but got %v", concurrency, expErr, err)
+		}
+		if code := exitCode(inputOrParseError(err)); code != exitParse {
+			t.Errorf("(concurrency=%v) expected exit code %d but got %d", concurrency, exitParse, code)
+		}
+
+		cfg.Strict = false
+		cfg.MaxNameLength = 200
+		output, err = runString(ctx, measurements10GluedIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, "Amsterdam=10.2/10.2/10.2") {
+			t.Errorf("(concurrency=%v) expected the glued station with a longer limit but got %+v", concurrency, output)
+		}
+	}
+}
+
+func TestRunStrict(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "measurements_strict.txt")
+	if err := os.WriteFile(filePath, []byte("a;1.0\n\nb;1.x\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Strict = true
+
+		_, err := runString(ctx, filePath, cfg)
+		expErr := `malformed line "b;1.x"`
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Errorf("(concurrency=%v) expected error %q but got %v", concurrency, expErr, err)
+		}
+	}
+
+	// blank lines aren't malformed
+	cfg := DefaultConfig()
+	cfg.Strict = true
+	output, err := runString(ctx, measurements10In, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != measurements10Out {
+		t.Errorf("expected %+v but got %+v", measurements10Out, output)
+	}
+}
+
+func TestRunStrictMixedPrecision(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := filepath.Join(t.TempDir(), "measurements_mixed_precision.txt")
+	if err := os.WriteFile(filePath, []byte("a;1.25\nb;-3.50\na;1.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []string{modeSequential, modeConcurrent, modeSharded} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, mode != modeSequential)
+		cfg.Sharded = mode == modeSharded
+		cfg.Precision = 2
+
+		// without -strict the single decimal is normalized to hundredths
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expOutput := "{a=1.25/1.38/1.50, b=-3.50/-3.50/-3.50}"; output != expOutput {
+			t.Errorf("(%s) expected %q but got %q", mode, expOutput, output)
+		}
+
+		cfg.Strict = true
+		_, err = runString(ctx, filePath, cfg)
+		expErr := `temperature with a single decimal at a precision of 2 in line "a;1.5"`
+		if err == nil || !strings.Contains(err.Error(), expErr) {
+			t.Errorf("(%s) expected error %q but got %v", mode, expErr, err)
+		}
+	}
+
+	// a file of hundredths only passes
+	hundredths := filepath.Join(t.TempDir(), "measurements_hundredths_only.txt")
+	if err := os.WriteFile(hundredths, []byte("a;1.25\nb;-3.50\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Precision = 2
+	cfg.Strict = true
+	if _, err := runString(ctx, hundredths, cfg); err != nil {
+		t.Errorf("expected hundredths to pass -strict but got %v", err)
+	}
+}
+
+func TestRunSkippedLines(t *testing.T) {
+	ctx := context.Background()
+
+	// 4 valid lines, blank lines don't count as skipped
+	lines := []string{
+		"a;1.0", "no delimiter", "b;1.", "", "c;12.34", "a;-2.0\r", "\r", "b;x.y", "b;3.5", "d;4.5", "c;1",
+	}
+	filePath := filepath.Join(t.TempDir(), "measurements_corrupt.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+
+		output, stats, err := runWithStats(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{a=-2.0/-0.5/1.0, b=3.5/3.5/3.5, d=4.5/4.5/4.5}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+		if stats.SkippedLines != 5 {
+			t.Errorf("(concurrency=%v) expected 5 skipped lines but got %d", concurrency, stats.SkippedLines)
+		}
+	}
+
+	// chunk boundaries must not be counted as skipped lines
+	cfg := DefaultConfig()
+	cfg.ChunkSize = testChunkSize
+	_, stats, err := runWithStats(ctx, generateMeasurementsFile(t, 50_000, 1), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SkippedLines != 0 {
+		t.Errorf("expected no skipped lines across chunks but got %d", stats.SkippedLines)
+	}
+}
+
+func TestRunMinCount(t *testing.T) {
+	ctx := context.Background()
+
+	// ham has 4 readings in the rounding fixture
+	tests := []struct {
+		format    string
+		minCount  int64
+		expOutput string
+		expExcl   int
+	}{
+		{format: formatText, minCount: 4, expOutput: measurementsRoundingOut, expExcl: 0},
+		{format: formatText, minCount: 5, expOutput: "{jel=-9.0/18.0/46.5}", expExcl: 1},
+		{format: formatCSV, minCount: 5, expOutput: "station,min,mean,max,count\njel,-9.0,18.0,46.5,20124\n", expExcl: 1},
+		{format: formatText, minCount: 1_000_000, expOutput: "{}", expExcl: 2},
+	}
+
+	for _, tc := range tests {
+		for _, concurrency := range []bool{true, false} {
+			cfg := DefaultConfig()
+			setConcurrency(&cfg, concurrency)
+			cfg.Format = tc.format
+			cfg.MinCount = tc.minCount
+
+			output, stats, err := runWithStats(ctx, measurementsRoundingIn, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tc.expOutput {
+				t.Errorf("(%s, min count %d) expected %+v but got %+v", tc.format, tc.minCount, tc.expOutput, output)
+			}
+			if stats.ExcludedStations != tc.expExcl {
+				t.Errorf("(%s, min count %d) expected %d excluded stations but got %d", tc.format, tc.minCount, tc.expExcl, stats.ExcludedStations)
+			}
+		}
+	}
+}
+
+func TestRunCRLFAcrossChunks(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurementsRoundingIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) <= testChunkSize {
+		t.Fatalf("%s must span several chunks", measurementsRoundingIn)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "measurements_rounding_crlf.txt")
+	if err := os.WriteFile(filePath, bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.ChunkSize = testChunkSize
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurementsRoundingOut {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurementsRoundingOut, output)
+		}
+	}
+}
+
+func TestFormatLocationsParallel(t *testing.T) {
+	for _, stations := range []int{1, 2, 7, 1000} {
+		locations, locationMap := syntheticLocations(stations)
+
+		expOutput := bytes.Buffer{}
+		err := formatLocations(&expOutput, locations, locationMap, DefaultConfig(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, workers := range []int{2, 3, 8, 2000} {
+			output := bytes.Buffer{}
+			if err := formatLocations(&output, locations, locationMap, DefaultConfig(), workers); err != nil {
+				t.Fatal(err)
+			}
+			if output.String() != expOutput.String() {
+				t.Errorf("(stations=%d, workers=%d) output differs from serial formatting", stations, workers)
+			}
+		}
+	}
+}
+
+func TestRunWriter(t *testing.T) {
+	// the parallel formatting fails on the write of the joined parts
+	locations, locationMap := syntheticLocations(parallelFormatThreshold)
+	if err := writeResult(failingWriter{}, locations, locationMap, DefaultConfig()); err == nil {
+		t.Error("expected the write error")
+	}
+
+	output := bytes.Buffer{}
+	stats, err := run(context.Background(), &output, measurements10In, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != measurements10Out || stats.SkippedLines != 0 {
+		t.Errorf("expected %+v but got %+v with %+v", measurements10Out, output.String(), stats)
+	}
+}
+
+func BenchmarkFormatLocations(b *testing.B) {
+	locations, locationMap := syntheticLocations(100_000)
+
+	benchmarks := []struct {
+		name    string
+		workers int
+	}{
+		{name: "serial", workers: 1},
+		{name: "parallel", workers: runtime.GOMAXPROCS(0)},
+	}
+
+	for _, bm := range benchmarks {
+		workers := bm.workers
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := formatLocations(io.Discard, locations, locationMap, DefaultConfig(), workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCreateResultUnordered(b *testing.B) {
+	_, locationMap := syntheticLocations(100_000)
+
+	b.Run("ordered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			// map order stands in for the discovery order of a run
+			if _, err := createResult(mapLocations(locationMap), locationMap, DefaultConfig()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unordered", func(b *testing.B) {
+		cfg := DefaultConfig()
+		cfg.Unordered = true
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := createResult(mapLocations(locationMap), locationMap, cfg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// syntheticLocations returns n sorted stations with deterministic readings.
+func syntheticLocations(n int) ([]string, map[string]Location) {
+	rng := rand.New(rand.NewSource(int64(n)))
+	locations := make([]string, 0, n)
+	locationMap := make(map[string]Location, n)
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("station-%07d", i)
+		low := int64(rng.Intn(1999) - 999)
+		high := low + int64(rng.Intn(int(999-low)+1))
+		count := int64(rng.Intn(1000) + 1)
+
+		locations = append(locations, name)
+		locationMap[name] = Location{Min: low, Max: high, Total: (low + high) / 2 * count, Count: count}
+	}
+
+	sort.Strings(locations)
+	return locations, locationMap
+}
+
+func BenchmarkRun(b *testing.B) {
+	ctx := context.Background()
+
+	filePath := benchmarkFile(b)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	slog.SetDefault(logger)
+
+	b.SetBytes(fileInfo.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := runString(ctx, filePath, DefaultConfig())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	fmt.Print("\n")
+}
+
+// BenchmarkRunSmallFile compares the latency of the concurrent engine on the
+// ten line fixture with the sequential fallback for small inputs.
+func BenchmarkRunSmallFile(b *testing.B) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	slog.SetDefault(logger)
+
+	for _, threshold := range []int64{0, defaultConcurrencyThreshold} {
+		name := "concurrent"
+		if threshold > 0 {
+			name = "fallback"
+		}
+		cfg := DefaultConfig()
+		cfg.ConcurrencyThreshold = threshold
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := runString(ctx, measurements10In, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRunResultsBuffer(b *testing.B) {
+	ctx := context.Background()
+
+	filePath := benchmarkFile(b)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	slog.SetDefault(logger)
+	defer func(perWorker int) { resultsPerWorker = perWorker }(resultsPerWorker)
+
+	for _, perWorker := range []int{0, 2} {
+		name := "unbuffered"
+		if perWorker > 0 {
+			name = fmt.Sprintf("buffered-%dx", perWorker)
+		}
+		b.Run(name, func(b *testing.B) {
+			resultsPerWorker = perWorker
+			b.SetBytes(fileInfo.Size())
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := runString(ctx, filePath, DefaultConfig()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkProcessChunk aggregates a chunk of the benchmark file into a Go
+// map and into the stationTable of -fast-map, the per line update being most
+// of the work of a worker.
+func BenchmarkProcessChunk(b *testing.B) {
+	data, err := os.ReadFile(benchmarkFile(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(data) > 4<<20 {
+		data = data[:bytes.LastIndexByte(data[:4<<20], '\n')]
+	}
+
+	b.Run("map", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := processChunk(data, DefaultConfig()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("fast-map", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := processChunkTable(data, DefaultConfig()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkProcessChunkStationsHint compares a chunk map grown from empty
+// with ones pre-sized by -stations-hint on a chunk with 50,000 stations.
+func BenchmarkProcessChunkStationsHint(b *testing.B) {
+	buffer := bytes.Buffer{}
+	if err := generateStationMeasurements(&buffer, 200_000, 50_000, 1); err != nil {
+		b.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	for _, hint := range []int{0, defaultStationsHint, 1 << 16} {
+		b.Run(fmt.Sprintf("hint-%d", hint), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.StationsHint = hint
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := processChunk(data, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkFile returns the path of the million row fixture, generating
+// -bench-rows rows into a temp dir, removed when the benchmark ends, when it
+// isn't in the repo.
+func benchmarkFile(b *testing.B) string {
+	b.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	filePath := filepath.Join(wd, measurementsMillionIn)
+	if _, err := os.Stat(filePath); err == nil {
+		return filePath
+	}
+
+	if testing.Short() {
+		b.Skipf("%s not found, skipping generation in short mode", measurementsMillionIn)
+	}
+
+	return generateMeasurementsFile(b, *benchRows, 1)
+}
+
+// generateMeasurementsFile writes rows of generated measurements to a file in
+// a temp dir that is cleaned up with the test.
+func generateMeasurementsFile(tb testing.TB, rows int, seed int64) string {
+	tb.Helper()
+
+	filePath := filepath.Join(tb.TempDir(), fmt.Sprintf("measurements_%d.txt", rows))
+	f, err := os.Create(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := generateMeasurements(f, rows, seed); err != nil {
+		f.Close()
+		tb.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return filePath
+}
+
+var generatorStations = []string{
+	"Abha", "Abidjan", "Accra", "Addis Ababa", "Adelaide", "Alexandria", "Amsterdam", "Athens",
+	"Bangkok", "Beijing", "Belgrade", "Berlin", "Bogotá", "Cabo San Lucas", "Cairo", "Dodoma",
+	"Dublin", "Halifax", "Hamburg", "Istanbul", "Jakarta", "Karachi", "Kyiv", "Lagos",
+	"Lima", "London", "Madrid", "Mexico City", "Montreal", "Nairobi", "Oslo", "Paris",
+	"Pittsburgh", "Reykjavík", "Rome", "Ségou", "Seoul", "St. John's", "Tauranga", "Tokyo",
+	"Vienna", "Xi'an", "Zagreb", "Zürich",
+}
+
+// generateMeasurements writes rows of deterministic "station;temperature"
+// lines to w using the given seed.
+func generateMeasurements(w io.Writer, rows int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	bw := bufio.NewWriter(w)
+
+	for i := 0; i < rows; i++ {
+		station := generatorStations[rng.Intn(len(generatorStations))]
+		temperature := rng.Intn(1999) - 999
+
+		bw.WriteString(station)
+		bw.WriteByte(';')
+		bw.WriteString(strconv.FormatFloat(float64(temperature)/10, 'f', 1, 64))
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+func FuzzParseNumber(f *testing.F) {
+	seeds := []string{
+		"", "-", ".", "1.", ".5", "-.5", "1.2", "-1.2", "12.3", "-12.3",
+		"99.9", "-99.9", "123.4", "1.23", "a.b", "1a.2", "12.3\r", "+1.2",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, temperature string) {
+		val, ok := parseNumber(temperature, '.')
+		if !ok {
+			return
+		}
+		if val < -9999 || val > 9999 {
+			t.Fatalf("parseNumber(%q) = %d, out of range", temperature, val)
+		}
+		expected, err := strconv.ParseFloat(temperature, 64)
+		if err != nil {
+			t.Fatalf("parseNumber(%q) accepted a value strconv rejects: %v", temperature, err)
+		}
+		if int64(math.Round(expected*10)) != val {
+			t.Fatalf("parseNumber(%q) = %d, expected %v", temperature, val, expected)
+		}
+	})
+}
+
+func FuzzProcessLine(f *testing.F) {
+	seeds := []string{
+		"", ";", "Paris;", "X;.", "X;1.", "X;-", "X;-.5", "Ségou;25.7", "Xi'an;24.2",
+		"Tauranga;38", "São Paulo;-3.4", "a;b;12.3", "Hamburg;12.3;4.5", ";12.3",
+		"東京;12.3", "Zagreb;12.2\n",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		locationName, location := processLine(line, DefaultConfig(), &scanStats{})
+		if location == nil {
+			return
+		}
+		if strings.Contains(locationName, ";") {
+			t.Fatalf("processLine(%q) returned name %q containing ';'", line, locationName)
+		}
+		if location.Count != 1 || location.Min != location.Max || location.Min != location.Total {
+			t.Fatalf("processLine(%q) returned inconsistent location %+v", line, *location)
+		}
+	})
+}
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		name     string
+		location Location
+		expMean  int64
+	}{
+		{name: "exact", location: Location{Total: 30, Count: 3}, expMean: 10},
+		{name: "round down", location: Location{Total: 10, Count: 3}, expMean: 3},
+		{name: "round half up", location: Location{Total: 5, Count: 2}, expMean: 3},
+		{name: "negative round half up", location: Location{Total: -5, Count: 2}, expMean: -2},
+		{name: "negative round down", location: Location{Total: -10, Count: 3}, expMean: -3},
+		// float64 cannot represent these totals exactly
+		{name: "near max total", location: Location{Total: math.MaxInt64 - 1, Count: 3}, expMean: 3074457345618258602},
+		{name: "max total", location: Location{Total: math.MaxInt64, Count: 2}, expMean: 4611686018427387904},
+		{name: "near min total", location: Location{Total: math.MinInt64 + 2, Count: 3}, expMean: -3074457345618258602},
+		{name: "max count", location: Location{Total: math.MaxInt64, Count: math.MaxInt64}, expMean: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mean(tc.location, roundHalfUp); got != tc.expMean {
+				t.Errorf("expected %d but got %d", tc.expMean, got)
+			}
+		})
+	}
+}
+
+func TestMeanRounding(t *testing.T) {
+	tests := []struct {
+		total   int64
+		count   int64
+		expMean map[string]int64
+	}{
+		{total: -5, count: 2, expMean: map[string]int64{roundHalfUp: -2, roundHalfEven: -2, roundFloor: -3, roundCeil: -2}},
+		{total: 5, count: 2, expMean: map[string]int64{roundHalfUp: 3, roundHalfEven: 2, roundFloor: 2, roundCeil: 3}},
+		{total: -15, count: 2, expMean: map[string]int64{roundHalfUp: -7, roundHalfEven: -8, roundFloor: -8, roundCeil: -7}},
+		{total: 15, count: 2, expMean: map[string]int64{roundHalfUp: 8, roundHalfEven: 8, roundFloor: 7, roundCeil: 8}},
+		{total: -7, count: 3, expMean: map[string]int64{roundHalfUp: -2, roundHalfEven: -2, roundFloor: -3, roundCeil: -2}},
+		{total: 8, count: 3, expMean: map[string]int64{roundHalfUp: 3, roundHalfEven: 3, roundFloor: 2, roundCeil: 3}},
+		{total: -9, count: 3, expMean: map[string]int64{roundHalfUp: -3, roundHalfEven: -3, roundFloor: -3, roundCeil: -3}},
+	}
+
+	for _, tc := range tests {
+		for rounding, expMean := range tc.expMean {
+			location := Location{Total: tc.total, Count: tc.count}
+			if got := mean(location, rounding); got != expMean {
+				t.Errorf("mean(%d/%d, %s) expected %d but got %d", tc.total, tc.count, rounding, expMean, got)
+			}
+		}
+	}
+}
+
+func TestMergeLocation(t *testing.T) {
+	t.Run("insert", func(t *testing.T) {
+		loc := Location{}
+		if err := mergeLocation(&loc, Location{Min: 5, Max: 12, Total: 25, Count: 3, SumSquares: sumSquares{Lo: 221}}); err != nil {
+			t.Fatal(err)
+		}
+		expLocation := Location{Min: 5, Max: 12, Total: 25, Count: 3, SumSquares: sumSquares{Lo: 221}}
+		if loc != expLocation {
+			t.Errorf("expected %+v but got %+v", expLocation, loc)
+		}
+	})
+
+	t.Run("insert negative", func(t *testing.T) {
+		// the zero Min and Max of an empty dst must not win over src
+		loc := Location{}
+		if err := mergeLocation(&loc, newLocation(-15)); err != nil {
+			t.Fatal(err)
+		}
+		expLocation := Location{Min: -15, Max: -15, Total: -15, Count: 1, SumSquares: sumSquares{Lo: 225}}
+		if loc != expLocation {
+			t.Errorf("expected %+v but got %+v", expLocation, loc)
+		}
+	})
+
+	t.Run("accumulate", func(t *testing.T) {
+		loc := Location{Min: 5, Max: 12, Total: 25, Count: 3, SumSquares: sumSquares{Lo: 221}}
+		if err := mergeLocation(&loc, Location{Min: -3, Max: 8, Total: 5, Count: 2, SumSquares: sumSquares{Lo: 73}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mergeLocation(&loc, newLocation(20)); err != nil {
+			t.Fatal(err)
+		}
+		expLocation := Location{Min: -3, Max: 20, Total: 50, Count: 6, SumSquares: sumSquares{Lo: 694}}
+		if loc != expLocation {
+			t.Errorf("expected %+v but got %+v", expLocation, loc)
+		}
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		src := newLocation(10)
+		src.Histogram = &histogram{}
+		src.Histogram.add(10)
+
+		loc := Location{}
+		if err := mergeLocation(&loc, src); err != nil {
+			t.Fatal(err)
+		}
+		if loc.Histogram != src.Histogram {
+			t.Error("expected the histogram to be adopted by an empty location")
+		}
+
+		other := newLocation(10)
+		other.Histogram = &histogram{}
+		other.Histogram.add(10)
+		if err := mergeLocation(&loc, other); err != nil {
+			t.Fatal(err)
+		}
+		if got := loc.Histogram.Counts[10+histogramOffset]; got != 2 {
+			t.Errorf("expected 2 readings in the merged histogram but got %d", got)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		loc := Location{Min: 999, Max: 999, Total: math.MaxInt64, Count: 1}
+		if err := mergeLocation(&loc, newLocation(999)); !errors.Is(err, errTotalOverflow) {
+			t.Errorf("expected %v but got %v", errTotalOverflow, err)
+		}
+	})
+
+	t.Run("sum of squares beyond int64", func(t *testing.T) {
+		// 999.9 in hundredths, whose squares overflow an int64 within a
+		// billion readings
+		const reading, count = 99990, 500_000_000
+		loc := Location{}
+		for i := 0; i < 4; i++ {
+			sign := int64(1 - 2*(i%2))
+			half := Location{Min: sign * reading, Max: sign * reading, Total: sign * reading * count, Count: count, SumSquares: sumSquares{Lo: reading * reading * count}}
+			if err := mergeLocation(&loc, half); err != nil {
+				t.Fatal(err)
+			}
+			if i == 1 && loc.SumSquares.Lo <= math.MaxInt64 {
+				t.Errorf("expected the sum of squares of a billion readings past math.MaxInt64 but got %+v", loc.SumSquares)
+			}
+		}
+		// the low 64 bits carry over after two billion readings
+		if expHi := uint64(1); loc.Count != 4*count || loc.SumSquares.Hi != expHi {
+			t.Errorf("expected %d readings with a high sum of squares of %d but got %+v", 4*count, expHi, loc)
+		}
+		if got := stdDev(loc, 1); got != reading {
+			t.Errorf("expected a standard deviation of %d but got %d", reading, got)
+		}
+	})
+}
+
+func TestAddTotal(t *testing.T) {
+	if sum, ok := addTotal(math.MaxInt64-10, 10); !ok || sum != math.MaxInt64 {
+		t.Errorf("expected %d without overflow but got %d, %v", int64(math.MaxInt64), sum, ok)
+	}
+	if _, ok := addTotal(math.MaxInt64, 1); ok {
+		t.Error("expected overflow adding to math.MaxInt64")
+	}
+	if _, ok := addTotal(math.MinInt64, -1); ok {
+		t.Error("expected overflow subtracting from math.MinInt64")
+	}
+}
@@ -0,0 +1,196 @@
+package brc
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// checkpoint is the aggregation state of a run saved with -checkpoint and
+// merged back with -resume.
+type checkpoint struct {
+	// Precision is the scale the locations are stored in, resuming requires
+	// the same precision
+	Precision   int
+	Locations   []string
+	LocationMap map[string]Location
+	// Offset is the end of the prefix of the input aggregated by a periodic
+	// checkpoint, resuming continues the same input from there. It is 0 for
+	// the state of a finished run, which resuming merges into a run over
+	// another input.
+	Offset int64
+	// InputSize is the size of the input of a periodic checkpoint
+	InputSize int64
+	// Lines and SkippedLines count the lines of the prefix of a periodic
+	// checkpoint
+	Lines        int64
+	SkippedLines int64
+}
+
+// saveCheckpoint writes the aggregation state of a finished run to path.
+func saveCheckpoint(path string, locations []string, locationMap map[string]Location, cfg Config) error {
+	return writeCheckpoint(path, checkpoint{Precision: cfg.Precision, Locations: locations, LocationMap: locationMap})
+}
+
+// writeCheckpoint writes state to path with encoding/gob. The file is written
+// next to path and renamed over it so an interrupted save doesn't destroy an
+// earlier checkpoint.
+func writeCheckpoint(path string, state checkpoint) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(state); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadCheckpoint reads a checkpoint written by saveCheckpoint and checks it
+// can be merged into a run with cfg.
+func loadCheckpoint(path string, cfg Config) (checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	defer f.Close()
+
+	var state checkpoint
+	if err := gob.NewDecoder(f).Decode(&state); err != nil {
+		return checkpoint{}, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+
+	if state.Precision != cfg.Precision {
+		return checkpoint{}, fmt.Errorf("checkpoint has precision %d but the run has %d", state.Precision, cfg.Precision)
+	}
+	if len(state.Locations) != len(state.LocationMap) {
+		return checkpoint{}, errors.New("checkpoint locations don't match its location map")
+	}
+	var count int64
+	for _, location := range state.Locations {
+		loc, ok := state.LocationMap[location]
+		if !ok {
+			return checkpoint{}, errors.New("checkpoint locations don't match its location map")
+		}
+		// percentiles would silently miss the readings of the checkpoint
+		if tracksHistogram(cfg) && loc.Histogram == nil {
+			return checkpoint{}, fmt.Errorf("checkpoint has no histogram for location '%s'", location)
+		}
+		count += loc.Count
+	}
+	// the run checks its station counts add up to its lines, seeded with
+	// those of a periodic checkpoint
+	if state.Offset > 0 && count != state.Lines {
+		return checkpoint{}, fmt.Errorf("checkpoint station counts add up to %d but it has %d lines", count, state.Lines)
+	}
+	return state, nil
+}
+
+// checkpointer saves the periodic checkpoints of a concurrent run, resuming
+// the one of an interrupted run when its Offset is set.
+type checkpointer struct {
+	// path is where the checkpoints are saved, none when empty
+	path     string
+	interval int64
+	// input is the part of the file the run reads, from the resumed offset
+	input     source
+	inputSize int64
+	resumed   checkpoint
+	// saved is the offset in input of the last checkpoint
+	saved int64
+}
+
+func newCheckpointer(f *os.File, cfg Config) (*checkpointer, error) {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &checkpointer{path: cfg.Checkpoint, interval: cfg.CheckpointInterval, input: f, inputSize: fileInfo.Size()}, nil
+}
+
+// resumeCheckpointer returns the checkpointer of a run continuing the input
+// f of the periodic checkpoint resumed.
+func resumeCheckpointer(f *os.File, resumed checkpoint, cfg Config) (*checkpointer, error) {
+	cp, err := newCheckpointer(f, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cp.inputSize != resumed.InputSize || resumed.Offset > resumed.InputSize {
+		return nil, fmt.Errorf("checkpoint at offset %d of a %d byte input doesn't match the %d byte input", resumed.Offset, resumed.InputSize, cp.inputSize)
+	}
+	if cfg.Checkpoint == "" || cfg.CheckpointInterval == 0 {
+		cp.path = ""
+	}
+	cp.input = sectionSource{file: f, offset: resumed.Offset}
+	cp.resumed = resumed
+	return cp, nil
+}
+
+// resumedState seeds locationMap with the resumed checkpoint, returning the
+// line counts it covers.
+func (cp *checkpointer) resumedState(locationMap map[string]*Location) scanStats {
+	for name, loc := range cp.resumed.LocationMap {
+		loc := loc
+		locationMap[name] = &loc
+	}
+	return scanStats{lines: cp.resumed.Lines, skipped: cp.resumed.SkippedLines}
+}
+
+// save saves a checkpoint of the state covering input up to offset once the
+// interval has passed since the last one. It runs in the merger, which is the
+// only goroutine updating locationMap.
+func (cp *checkpointer) save(locationMap map[string]*Location, scan scanStats, offset int64, cfg Config) error {
+	if cp.path == "" || offset-cp.saved < cp.interval {
+		return nil
+	}
+	cp.saved = offset
+
+	values := locationValues(locationMap)
+	return writeCheckpoint(cp.path, checkpoint{
+		Precision:    cfg.Precision,
+		Locations:    mapLocations(values),
+		LocationMap:  values,
+		Offset:       cp.resumed.Offset + offset,
+		InputSize:    cp.inputSize,
+		Lines:        scan.lines,
+		SkippedLines: scan.skipped,
+	})
+}
+
+// sectionSource is the part of a file from offset on.
+type sectionSource struct {
+	file   *os.File
+	offset int64
+}
+
+func (s sectionSource) ReadAt(p []byte, off int64) (int, error) {
+	return s.file.ReadAt(p, s.offset+off)
+}
+
+func (s sectionSource) Stat() (fs.FileInfo, error) {
+	fileInfo, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sectionFileInfo{FileInfo: fileInfo, size: max(fileInfo.Size()-s.offset, 0)}, nil
+}
+
+// sectionFileInfo is the FileInfo of a file with the size of a section of it.
+type sectionFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi sectionFileInfo) Size() int64 {
+	return fi.size
+}
@@ -0,0 +1,147 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCheckpointResume(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurementsRoundingIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	dir := t.TempDir()
+	firstHalf := filepath.Join(dir, "first.txt")
+	secondHalf := filepath.Join(dir, "second.txt")
+	if err := os.WriteFile(firstHalf, []byte(strings.Join(lines[:len(lines)/2], "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secondHalf, []byte(strings.Join(lines[len(lines)/2:], "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.StdDev = true
+		cfg.Percentiles = []float64{50, 99}
+
+		expOutput, err := runString(ctx, measurementsRoundingIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first := cfg
+		first.Checkpoint = filepath.Join(dir, "checkpoint.gob")
+		if _, err := runString(ctx, firstHalf, first); err != nil {
+			t.Fatal(err)
+		}
+
+		second := cfg
+		second.Resume = first.Checkpoint
+		output, err := runString(ctx, secondHalf, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunResumeInterrupted(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	cfg.Percentiles = []float64{50, 99}
+	setConcurrency(&cfg, true)
+	expOutput, err := runString(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Checkpoint = filepath.Join(t.TempDir(), "checkpoint.gob")
+	cfg.CheckpointInterval = 64 * 1024
+
+	// kill the run partway, after a few periodic checkpoints
+	cancelled, cancel := context.WithCancel(ctx)
+	defer cancel()
+	merges := 0
+	mergeHook = func(string, *Location) {
+		if merges++; merges == 3000 {
+			cancel()
+		}
+	}
+	defer func() { mergeHook = nil }()
+	if _, err := runString(cancelled, filePath, cfg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation error but got %v", err)
+	}
+	mergeHook = nil
+
+	state, err := loadCheckpoint(cfg.Checkpoint, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Offset < cfg.CheckpointInterval || state.Offset >= fileInfo.Size() {
+		t.Fatalf("expected a checkpoint partway through the %d byte input but got offset %d", fileInfo.Size(), state.Offset)
+	}
+
+	resumed := cfg
+	resumed.Resume = cfg.Checkpoint
+	// a periodic checkpoint only continues the input it was taken of
+	if _, err := runString(ctx, measurements10In, resumed); err == nil || !strings.Contains(err.Error(), "doesn't match the") {
+		t.Errorf("expected resuming another input to fail but got %v", err)
+	}
+
+	output, err := runString(ctx, filePath, resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != expOutput {
+		t.Errorf("expected the resumed run to match the full run %q but got %q", expOutput, output)
+	}
+	// the finished run replaces the periodic checkpoint
+	if state, err := loadCheckpoint(cfg.Checkpoint, cfg); err != nil || state.Offset != 0 {
+		t.Errorf("expected the checkpoint of the finished run but got offset %d, %v", state.Offset, err)
+	}
+}
+
+func TestLoadCheckpointMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.gob")
+	locationMap := map[string]Location{"a": newLocation(10)}
+	if err := saveCheckpoint(path, []string{"a"}, locationMap, DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Precision = 2
+	if _, err := loadCheckpoint(path, cfg); err == nil || err.Error() != "checkpoint has precision 1 but the run has 2" {
+		t.Errorf("expected a precision mismatch error but got %v", err)
+	}
+
+	cfg = DefaultConfig()
+	cfg.Percentiles = []float64{50}
+	if _, err := loadCheckpoint(path, cfg); err == nil || err.Error() != "checkpoint has no histogram for location 'a'" {
+		t.Errorf("expected a missing histogram error but got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("not a checkpoint"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(path, DefaultConfig()); err == nil || !strings.HasPrefix(err.Error(), "decoding checkpoint: ") {
+		t.Errorf("expected a decoding error but got %v", err)
+	}
+}
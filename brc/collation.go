@@ -0,0 +1,68 @@
+package brc
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The reference 1BRC implementation collects the stations in a Java TreeMap,
+// which orders them by String.compareTo: lexicographically by UTF-16 code
+// unit. That is the byte order of the UTF-8 names except where a character
+// beyond U+FFFF, encoded as surrogates in U+D800 to U+DFFF, meets one in
+// U+E000 to U+FFFF, so the output is sorted with compareStations rather than
+// sort.Strings.
+
+// sortStations sorts names in the order of the reference implementation.
+func sortStations(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return compareStations(names[i], names[j]) < 0
+	})
+}
+
+// compareStations compares a and b by UTF-16 code unit, returning -1, 0 or
+// +1. Invalid UTF-8 falls back to byte order.
+func compareStations(a, b string) int {
+	for a != "" && b != "" {
+		// ASCII orders the same in UTF-8 and UTF-16
+		if a[0] < utf8.RuneSelf && b[0] < utf8.RuneSelf {
+			if a[0] != b[0] {
+				return compareKeys(uint32(a[0]), uint32(b[0]))
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra == utf8.RuneError || rb == utf8.RuneError {
+			return strings.Compare(a, b)
+		}
+		if ra != rb {
+			return compareKeys(utf16Key(ra), utf16Key(rb))
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return compareKeys(uint32(len(a)), uint32(len(b)))
+}
+
+// utf16Key maps r to its UTF-16 code units, the first in the high half, so
+// keys order as the encoded runes do.
+func utf16Key(r rune) uint32 {
+	if r < 0x10000 {
+		return uint32(r) << 16
+	}
+	r1, r2 := utf16.EncodeRune(r)
+	return uint32(r1)<<16 | uint32(r2)
+}
+
+func compareKeys(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
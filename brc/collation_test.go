@@ -0,0 +1,65 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSortStations(t *testing.T) {
+	// U+1F600 is the surrogate pair D83D DE00 in UTF-16, ordering before
+	// U+FF21 although its UTF-8 encoding orders after
+	names := []string{"Ａ", "İzmir", "Zürich", "Abha", "\U0001f600", "Zagreb", "Ürümqi", "Abéché", "Ab"}
+	expOrder := []string{"Ab", "Abha", "Abéché", "Zagreb", "Zürich", "Ürümqi", "İzmir", "\U0001f600", "Ａ"}
+	sortStations(names)
+	if !reflect.DeepEqual(names, expOrder) {
+		t.Errorf("expected %q but got %q", expOrder, names)
+	}
+}
+
+func TestCompareStations(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  int
+	}{
+		{a: "", b: "", exp: 0},
+		{a: "", b: "a", exp: -1},
+		{a: "b", b: "a", exp: 1},
+		{a: "Zürich", b: "Zürich", exp: 0},
+		{a: "\U0001f600", b: "￿", exp: -1},
+		{a: "\U0001f600", b: "\U0001f601", exp: -1},
+		{a: "퟿", b: "\U00010000", exp: -1},
+		{a: "\xff", b: "\xfe", exp: 1},
+	}
+	for _, tc := range tests {
+		if got := compareStations(tc.a, tc.b); got != tc.exp {
+			t.Errorf("compareStations(%q, %q) expected %d but got %d", tc.a, tc.b, tc.exp, got)
+		}
+		if got := compareStations(tc.b, tc.a); got != -tc.exp {
+			t.Errorf("compareStations(%q, %q) expected %d but got %d", tc.b, tc.a, -tc.exp, got)
+		}
+	}
+}
+
+func TestRunCollation(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "measurements_collation.txt")
+	content := "Ａ;1.0\nZürich;2.0\n\U0001f600;3.0\nZagreb;4.0\n"
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	expOutput := "{Zagreb=4.0/4.0/4.0, Zürich=2.0/2.0/2.0, \U0001f600=3.0/3.0/3.0, Ａ=1.0/1.0/1.0}"
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		output, err := runString(context.Background(), filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %q but got %q", concurrency, expOutput, output)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package brc
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resultStation is a station parsed from a result in the text format, the
+// values kept as printed along with their value in hundredths, which holds
+// the values of either precision exactly.
+type resultStation struct {
+	Text   string
+	Values [3]int64
+}
+
+// parseResultText parses a result in the text format, {name=min/mean/max,
+// ...}, into its stations. Values beyond the mean and max, as appended by
+// -stddev or -percentiles, and a parenthesized suffix such as the
+// " (count=N)" of -count are ignored.
+func parseResultText(s string) (map[string]resultStation, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, errors.New("result isn't enclosed in braces")
+	}
+	s = s[1 : len(s)-1]
+
+	stations := map[string]resultStation{}
+	if s == "" {
+		return stations, nil
+	}
+	// a piece without '=' is part of a station name containing ", "
+	pending := ""
+	for _, entry := range strings.Split(s, ", ") {
+		entry = pending + entry
+		if j := strings.LastIndex(entry, " ("); j >= 0 && strings.HasSuffix(entry, ")") && strings.Contains(entry[:j], "=") {
+			entry = entry[:j]
+		}
+		i := strings.LastIndexByte(entry, '=')
+		if i < 0 {
+			pending = entry + ", "
+			continue
+		}
+		pending = ""
+
+		name, values := entry[:i], strings.Split(entry[i+1:], "/")
+		if len(values) < 3 {
+			return nil, fmt.Errorf("station %q: expected min/mean/max but got %q", name, entry[i+1:])
+		}
+		station := resultStation{Text: strings.Join(values[:3], "/")}
+		for j := range station.Values {
+			v, err := strconv.ParseFloat(values[j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("station %q: %w", name, err)
+			}
+			station.Values[j] = int64(math.Round(v * 100))
+		}
+		if _, ok := stations[name]; ok {
+			return nil, fmt.Errorf("duplicate station %q", name)
+		}
+		stations[name] = station
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("station %q has no values", strings.TrimSuffix(pending, ", "))
+	}
+	return stations, nil
+}
+
+// resultDiff is a station whose min, mean or max differs between two
+// results, a side is nil when it lacks the station.
+type resultDiff struct {
+	Name   string
+	First  *resultStation
+	Second *resultStation
+	// Tolerated is set when only the means differ, by no more than the
+	// tolerance of the comparison, which makes the diff a warning
+	Tolerated bool
+}
+
+func (d resultDiff) String() string {
+	s := fmt.Sprintf("station %q: first %s, second %s", d.Name, describeResultStation(d.First), describeResultStation(d.Second))
+	if d.Tolerated {
+		return "warning: " + s + ", the means are within the tolerance"
+	}
+	return s
+}
+
+func describeResultStation(station *resultStation) string {
+	if station == nil {
+		return "missing"
+	}
+	return station.Text
+}
+
+// diffResults compares two parsed results station by station, returning the
+// differing stations sorted by name. Means differing by at most tolerance
+// hundredths are tolerated, min, max and the stations must match exactly.
+func diffResults(first, second map[string]resultStation, tolerance int64) []resultDiff {
+	names := make([]string, 0, len(first))
+	for name := range first {
+		names = append(names, name)
+	}
+	for name := range second {
+		if _, ok := first[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []resultDiff{}
+	for _, name := range names {
+		f, inFirst := first[name]
+		s, inSecond := second[name]
+		if inFirst && inSecond && f.Values == s.Values {
+			continue
+		}
+		diff := resultDiff{Name: name}
+		if inFirst {
+			diff.First = &f
+		}
+		if inSecond {
+			diff.Second = &s
+		}
+		if inFirst && inSecond && f.Values[0] == s.Values[0] && f.Values[2] == s.Values[2] {
+			delta := f.Values[1] - s.Values[1]
+			diff.Tolerated = -tolerance <= delta && delta <= tolerance
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// readResultArg returns the result given as a compare argument, either the
+// result itself when it starts with '{' or the path of a file holding it.
+func readResultArg(arg string) (string, error) {
+	if strings.HasPrefix(arg, "{") {
+		return arg, nil
+	}
+	data, err := os.ReadFile(arg)
+	return string(data), err
+}
+
+// compareMain runs the compare subcommand: it diffs two results in the text
+// format and fails when a station differs or is missing from either. With
+// -tolerance, means differing by at most the tolerance are only warned about.
+func compareMain(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	tolerance := flags.Float64("tolerance", 0, "only warn about means differing by at most this many degrees, such as 0.1 for the rounding of other implementations")
+	if err := flags.Parse(args[1:]); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if flags.NArg() != 2 {
+		return withExitCode(exitUsage, errors.New("need to supply two results or result files"))
+	}
+	if *tolerance < 0 {
+		return withExitCode(exitUsage, fmt.Errorf("invalid tolerance %v", *tolerance))
+	}
+
+	results := [2]map[string]resultStation{}
+	for i := range results {
+		text, err := readResultArg(flags.Arg(i))
+		if err != nil {
+			return withExitCode(exitInput, err)
+		}
+		if results[i], err = parseResultText(text); err != nil {
+			return withExitCode(exitParse, fmt.Errorf("%s: %w", flags.Arg(i), err))
+		}
+	}
+
+	diffs := diffResults(results[0], results[1], int64(math.Round(*tolerance*100)))
+	tolerated := 0
+	for _, diff := range diffs {
+		if diff.Tolerated {
+			tolerated++
+		}
+		if _, err := fmt.Fprintln(stdout, diff); err != nil {
+			return withExitCode(exitOutput, fmt.Errorf("writing compare report: %w", err))
+		}
+	}
+	if differing := len(diffs) - tolerated; differing > 0 {
+		return fmt.Errorf("%d stations differ between the results", differing)
+	}
+	_, err := fmt.Fprintf(stdout, "results match for %d stations\n", len(results[0]))
+	return withExitCode(exitOutput, err)
+}
@@ -0,0 +1,164 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseResultText(t *testing.T) {
+	stations, err := parseResultText("{a, b=-1.0/0.5/2.0/0.3, c=1.0/1.0/1.0, d (e)=0.0/0.0/0.0 (count=3)}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expStations := map[string]resultStation{
+		"a, b": {Text: "-1.0/0.5/2.0", Values: [3]int64{-100, 50, 200}},
+		"c":    {Text: "1.0/1.0/1.0", Values: [3]int64{100, 100, 100}},
+		// a name with parentheses keeps them, the count is dropped
+		"d (e)": {Text: "0.0/0.0/0.0", Values: [3]int64{0, 0, 0}},
+	}
+	if len(stations) != len(expStations) {
+		t.Fatalf("expected %v but got %v", expStations, stations)
+	}
+	for name, exp := range expStations {
+		if stations[name] != exp {
+			t.Errorf("expected %q to be %+v but got %+v", name, exp, stations[name])
+		}
+	}
+
+	if stations, err := parseResultText("{}"); err != nil || len(stations) != 0 {
+		t.Errorf("expected an empty result but got %v, %v", stations, err)
+	}
+	for _, invalid := range []string{"a=1.0/1.0/1.0", "{a=1.0/1.0}", "{a=1.0/x/1.0}", "{a=1.0/1.0/1.0, a=1.0/1.0/1.0}", "{a}"} {
+		if _, err := parseResultText(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "result.txt")
+	if err := os.WriteFile(filePath, []byte(measurements10Out+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Count = true
+	countOut, err := runString(context.Background(), measurements10In, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		flags     []string
+		first     string
+		second    string
+		expOutput string
+		expCode   int
+	}{
+		{
+			name:      "identical",
+			first:     filePath,
+			second:    measurements10Out,
+			expOutput: "results match for 10 stations\n",
+			expCode:   exitOK,
+		},
+		{
+			name:      "slightly different",
+			first:     filePath,
+			second:    strings.Replace(measurements10Out, "Halifax=12.9/12.9/12.9", "Halifax=12.9/13.0/12.9", 1),
+			expOutput: "station \"Halifax\": first 12.9/12.9/12.9, second 12.9/13.0/12.9\n",
+			expCode:   exitFailure,
+		},
+		{
+			// 13.0 - 12.9 is above 0.1 in floating point
+			name:      "mean within tolerance",
+			flags:     []string{"-tolerance", "0.1"},
+			first:     filePath,
+			second:    strings.Replace(measurements10Out, "Halifax=12.9/12.9/12.9", "Halifax=12.9/13.0/12.9", 1),
+			expOutput: "warning: station \"Halifax\": first 12.9/12.9/12.9, second 12.9/13.0/12.9, the means are within the tolerance\nresults match for 10 stations\n",
+			expCode:   exitOK,
+		},
+		{
+			name:      "mean beyond tolerance",
+			flags:     []string{"-tolerance", "0.1"},
+			first:     filePath,
+			second:    strings.Replace(measurements10Out, "Halifax=12.9/12.9/12.9", "Halifax=12.9/13.1/12.9", 1),
+			expOutput: "station \"Halifax\": first 12.9/12.9/12.9, second 12.9/13.1/12.9\n",
+			expCode:   exitFailure,
+		},
+		{
+			name:      "min within tolerance",
+			flags:     []string{"-tolerance", "0.1"},
+			first:     filePath,
+			second:    strings.Replace(measurements10Out, "Halifax=12.9/12.9/12.9", "Halifax=12.8/12.9/12.9", 1),
+			expOutput: "station \"Halifax\": first 12.9/12.9/12.9, second 12.8/12.9/12.9\n",
+			expCode:   exitFailure,
+		},
+		{
+			name:      "station missing within tolerance",
+			flags:     []string{"-tolerance", "0.1"},
+			first:     "{a=1.0/2.0/3.0}",
+			second:    "{}",
+			expOutput: "station \"a\": first 1.0/2.0/3.0, second missing\n",
+			expCode:   exitFailure,
+		},
+		{
+			name:    "negative tolerance",
+			flags:   []string{"-tolerance", "-0.1"},
+			first:   filePath,
+			second:  filePath,
+			expCode: exitUsage,
+		},
+		{
+			name:      "with counts",
+			first:     countOut,
+			second:    strings.Replace(countOut, "Halifax=12.9/12.9/12.9 (count=1)", "Halifax=12.9/12.9/12.9 (count=2)", 1),
+			expOutput: "results match for 10 stations\n",
+			expCode:   exitOK,
+		},
+		{
+			name:      "with counts against without",
+			first:     countOut,
+			second:    strings.Replace(measurements10Out, "Halifax=12.9/12.9/12.9", "Halifax=12.9/13.0/12.9", 1),
+			expOutput: "station \"Halifax\": first 12.9/12.9/12.9, second 12.9/13.0/12.9\n",
+			expCode:   exitFailure,
+		},
+		{
+			name:      "disjoint",
+			first:     "{a=1.0/2.0/3.0}",
+			second:    "{b=-1.0/0.0/1.0}",
+			expOutput: "station \"a\": first 1.0/2.0/3.0, second missing\nstation \"b\": first missing, second -1.0/0.0/1.0\n",
+			expCode:   exitFailure,
+		},
+		{
+			name:    "malformed",
+			first:   filePath,
+			second:  "{Halifax=12.9}",
+			expCode: exitParse,
+		},
+		{
+			name:    "missing file",
+			first:   filePath,
+			second:  filepath.Join(t.TempDir(), "missing.txt"),
+			expCode: exitInput,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := bytes.Buffer{}
+			args := append(append([]string{"1brc", "compare"}, tc.flags...), tc.first, tc.second)
+			err := realMain(context.Background(), args, &stdout, &bytes.Buffer{})
+			if code := exitCode(err); code != tc.expCode {
+				t.Errorf("expected exit code %d but got %d for error %v", tc.expCode, code, err)
+			}
+			if stdout.String() != tc.expOutput {
+				t.Errorf("expected %q but got %q", tc.expOutput, stdout.String())
+			}
+		})
+	}
+}
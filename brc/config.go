@@ -0,0 +1,270 @@
+package brc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configFile is the JSON shape of a config file. Its keys are the names of
+// the matching flags and every key is optional.
+type configFile struct {
+	Mode                 string `json:"mode"`
+	ConcurrencyThreshold int64  `json:"concurrency-threshold"`
+	ChunkSize            int64  `json:"chunk-size"`
+	Format               string `json:"format"`
+	Delimiter            string `json:"delimiter"`
+	Precision            int    `json:"precision"`
+	// Decimals is the alias of Precision, only read from config files
+	Decimals            int       `json:"decimals,omitempty"`
+	InputFormat         string    `json:"input-format"`
+	Dictionary          string    `json:"dictionary"`
+	ByteOrder           string    `json:"byte-order"`
+	Timeout             string    `json:"timeout"`
+	InputHash           string    `json:"input-hash"`
+	Round               string    `json:"round"`
+	StdDev              bool      `json:"stddev"`
+	Count               bool      `json:"count"`
+	Percentiles         []float64 `json:"percentiles"`
+	MinCount            int64     `json:"min-count"`
+	HistogramOut        string    `json:"histogram-out"`
+	HistogramBucket     int       `json:"histogram-bucket"`
+	Station             string    `json:"station"`
+	Checkpoint          string    `json:"checkpoint"`
+	CheckpointInterval  int64     `json:"checkpoint-interval"`
+	Resume              string    `json:"resume"`
+	AllowIntegerTemps   bool      `json:"allow-integer-temps"`
+	Quoted              bool      `json:"quoted"`
+	Unit                string    `json:"unit"`
+	Unordered           bool      `json:"unordered"`
+	Top                 int       `json:"top"`
+	Sharded             bool      `json:"sharded"`
+	FastMap             bool      `json:"fast-map"`
+	AdaptiveChunks      bool      `json:"adaptive-chunks"`
+	NoPrescan           bool      `json:"no-prescan"`
+	StationsHint        int       `json:"stations-hint"`
+	MaxStations         int       `json:"max-stations"`
+	DecimalComma        bool      `json:"decimal-comma"`
+	NearDuplicateReport bool      `json:"near-duplicate-report"`
+	MaxNameLength       int       `json:"max-name-length"`
+	Strict              bool      `json:"strict"`
+	Readers             int       `json:"readers"`
+	Range               string    `json:"range"`
+	Fadvise             bool      `json:"fadvise"`
+	SampleRate          float64   `json:"sample-rate"`
+}
+
+func newConfigFile(cfg Config) configFile {
+	return configFile{
+		Mode:                 runMode(Config{Concurrency: cfg.Concurrency}),
+		ConcurrencyThreshold: cfg.ConcurrencyThreshold,
+		ChunkSize:            cfg.ChunkSize,
+		Format:               cfg.Format,
+		Delimiter:            string(cfg.Delimiter),
+		Precision:            cfg.Precision,
+		InputFormat:          cfg.InputFormat,
+		Dictionary:           cfg.Dictionary,
+		ByteOrder:            cfg.ByteOrder,
+		Timeout:              cfg.Timeout.String(),
+		InputHash:            cfg.InputHash,
+		Round:                cfg.Round,
+		StdDev:               cfg.StdDev,
+		Count:                cfg.Count,
+		Percentiles:          cfg.Percentiles,
+		MinCount:             cfg.MinCount,
+		HistogramOut:         cfg.HistogramOut,
+		HistogramBucket:      cfg.HistogramBucket,
+		Station:              cfg.Station,
+		Checkpoint:           cfg.Checkpoint,
+		CheckpointInterval:   cfg.CheckpointInterval,
+		Resume:               cfg.Resume,
+		AllowIntegerTemps:    cfg.AllowIntegerTemps,
+		Quoted:               cfg.Quoted,
+		Unit:                 cfg.Unit,
+		Unordered:            cfg.Unordered,
+		Top:                  cfg.Top,
+		Sharded:              cfg.Sharded,
+		FastMap:              cfg.FastMap,
+		AdaptiveChunks:       cfg.AdaptiveChunks,
+		NoPrescan:            cfg.NoPrescan,
+		StationsHint:         cfg.StationsHint,
+		MaxStations:          cfg.MaxStations,
+		DecimalComma:         cfg.DecimalComma,
+		NearDuplicateReport:  cfg.NearDuplicateReport,
+		MaxNameLength:        cfg.MaxNameLength,
+		Strict:               cfg.Strict,
+		Readers:              cfg.Readers,
+		Range:                cfg.Range,
+		Fadvise:              cfg.Fadvise,
+		SampleRate:           cfg.SampleRate,
+	}
+}
+
+// config converts the config file to a Config, checking the values a Config
+// can't hold. The options are validated with validateConfig like flags are.
+func (c configFile) config() (Config, error) {
+	if len(c.Delimiter) != 1 {
+		return Config{}, fmt.Errorf("delimiter must be a single byte, got %q", c.Delimiter)
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return Config{}, fmt.Errorf("timeout: %w", err)
+	}
+	var mode Config
+	if err := (modeValue{&mode}).Set(c.Mode); err != nil {
+		return Config{}, fmt.Errorf("mode %q: %w", c.Mode, err)
+	}
+	return Config{
+		Concurrency:          mode.Concurrency,
+		ConcurrencyThreshold: c.ConcurrencyThreshold,
+		ChunkSize:            c.ChunkSize,
+		Format:               c.Format,
+		Delimiter:            c.Delimiter[0],
+		Precision:            c.Precision,
+		InputFormat:          c.InputFormat,
+		Dictionary:           c.Dictionary,
+		ByteOrder:            c.ByteOrder,
+		Timeout:              timeout,
+		InputHash:            c.InputHash,
+		Round:                c.Round,
+		StdDev:               c.StdDev,
+		Count:                c.Count,
+		Percentiles:          c.Percentiles,
+		MinCount:             c.MinCount,
+		HistogramOut:         c.HistogramOut,
+		HistogramBucket:      c.HistogramBucket,
+		Station:              c.Station,
+		Checkpoint:           c.Checkpoint,
+		CheckpointInterval:   c.CheckpointInterval,
+		Resume:               c.Resume,
+		AllowIntegerTemps:    c.AllowIntegerTemps,
+		Quoted:               c.Quoted,
+		Unit:                 c.Unit,
+		Unordered:            c.Unordered,
+		Top:                  c.Top,
+		Sharded:              c.Sharded,
+		FastMap:              c.FastMap,
+		AdaptiveChunks:       c.AdaptiveChunks,
+		NoPrescan:            c.NoPrescan,
+		StationsHint:         c.StationsHint,
+		MaxStations:          c.MaxStations,
+		DecimalComma:         c.DecimalComma,
+		NearDuplicateReport:  c.NearDuplicateReport,
+		MaxNameLength:        c.MaxNameLength,
+		Strict:               c.Strict,
+		Readers:              c.Readers,
+		Range:                c.Range,
+		Fadvise:              c.Fadvise,
+		SampleRate:           c.SampleRate,
+	}, nil
+}
+
+// configKeys returns the keys a config file may hold.
+func configKeys() []string {
+	t := reflect.TypeOf(configFile{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i], _, _ = strings.Cut(t.Field(i).Tag.Get("json"), ",")
+	}
+	return keys
+}
+
+// loadConfig reads the config file at filePath over the default options. An
+// unknown key is rejected with the nearest valid key as a suggestion.
+func loadConfig(filePath string) (Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Config{}, fmt.Errorf("config %s: %w", filePath, err)
+	}
+	keys := configKeys()
+	unknown := []string{}
+	for key := range raw {
+		if !slices.Contains(keys, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		// report the first unknown key in a stable order
+		sort.Strings(unknown)
+		return Config{}, fmt.Errorf("config %s: unknown key %q, did you mean %q?", filePath, unknown[0], nearestKey(unknown[0], keys))
+	}
+
+	c := newConfigFile(DefaultConfig())
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("config %s: %w", filePath, err)
+	}
+	// like -mode, an explicit concurrent mode also parses small inputs
+	// concurrently unless the threshold is set
+	if _, ok := raw["mode"]; ok && c.Mode == modeConcurrent {
+		if _, ok := raw["concurrency-threshold"]; !ok {
+			c.ConcurrencyThreshold = 0
+		}
+	}
+	if _, ok := raw["decimals"]; ok {
+		if _, ok := raw["precision"]; ok && c.Precision != c.Decimals {
+			return Config{}, fmt.Errorf("config %s: precision %d conflicts with decimals %d", filePath, c.Precision, c.Decimals)
+		}
+		c.Precision = c.Decimals
+	}
+	cfg, err := c.config()
+	if err != nil {
+		return Config{}, fmt.Errorf("config %s: %w", filePath, err)
+	}
+	return cfg, nil
+}
+
+// printConfig writes cfg as a config file that loadConfig reads back.
+func printConfig(w io.Writer, cfg Config) error {
+	data, err := json.MarshalIndent(newConfigFile(cfg), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// nearestKey returns the key with the smallest edit distance to key.
+func nearestKey(key string, keys []string) string {
+	nearest, best := "", -1
+	for _, k := range keys {
+		if d := editDistance(strings.ToLower(key), k); best < 0 || d < best {
+			nearest, best = k, d
+		}
+	}
+	return nearest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,183 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file to a temp dir and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "run.json")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestLoadConfigRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Format = formatCSV
+	cfg.Delimiter = ','
+	cfg.Timeout = 90 * time.Second
+	cfg.Percentiles = []float64{50, 99.9}
+	cfg.MinCount = 3
+	cfg.Unit = unitFahrenheit
+	cfg.NoPrescan = true
+
+	printed := bytes.Buffer{}
+	if err := printConfig(&printed, cfg); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadConfig(writeConfig(t, printed.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("expected %+v but got %+v", cfg, loaded)
+	}
+}
+
+func TestLoadConfigSubset(t *testing.T) {
+	loaded, err := loadConfig(writeConfig(t, `{"format": "csv", "timeout": "1m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expCfg := DefaultConfig()
+	expCfg.Format = formatCSV
+	expCfg.Timeout = time.Minute
+	if !reflect.DeepEqual(loaded, expCfg) {
+		t.Errorf("expected the defaults for the missing keys %+v but got %+v", expCfg, loaded)
+	}
+}
+
+func TestLoadConfigDecimals(t *testing.T) {
+	expCfg := DefaultConfig()
+	expCfg.Precision = 2
+	for _, content := range []string{`{"decimals": 2}`, `{"precision": 2, "decimals": 2}`} {
+		loaded, err := loadConfig(writeConfig(t, content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, expCfg) {
+			t.Errorf("(%s) expected %+v but got %+v", content, expCfg, loaded)
+		}
+	}
+
+	// the printed config only has the precision
+	printed := bytes.Buffer{}
+	if err := printConfig(&printed, expCfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(printed.String(), "decimals") {
+		t.Errorf("expected no decimals key in %s", printed.String())
+	}
+}
+
+func TestLoadConfigMode(t *testing.T) {
+	tests := []struct {
+		content string
+		expCfg  func(cfg *Config)
+	}{
+		{content: `{"mode": "sequential"}`, expCfg: func(cfg *Config) { cfg.Concurrency = false }},
+		// like -mode=concurrent, small inputs are parsed concurrently too
+		{content: `{"mode": "concurrent"}`, expCfg: func(cfg *Config) { cfg.ConcurrencyThreshold = 0 }},
+		{content: `{"mode": "concurrent", "concurrency-threshold": 100}`, expCfg: func(cfg *Config) { cfg.ConcurrencyThreshold = 100 }},
+	}
+
+	for _, tc := range tests {
+		loaded, err := loadConfig(writeConfig(t, tc.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expCfg := DefaultConfig()
+		tc.expCfg(&expCfg)
+		if !reflect.DeepEqual(loaded, expCfg) {
+			t.Errorf("(%s) expected %+v but got %+v", tc.content, expCfg, loaded)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		expErr  string
+	}{
+		{name: "unknown key", content: `{"fromat": "csv"}`, expErr: `unknown key "fromat", did you mean "format"?`},
+		{name: "unknown flag style key", content: `{"min_count": 3}`, expErr: `unknown key "min_count", did you mean "min-count"?`},
+		{name: "wrong type", content: `{"precision": "2"}`, expErr: "cannot unmarshal string"},
+		{name: "delimiter", content: `{"delimiter": ";;"}`, expErr: `delimiter must be a single byte, got ";;"`},
+		{name: "timeout", content: `{"timeout": "soon"}`, expErr: "timeout: "},
+		{name: "not an object", content: `[]`, expErr: "cannot unmarshal array"},
+		{name: "mode", content: `{"mode": "parallel"}`, expErr: `mode "parallel": expected concurrent or sequential`},
+		{name: "conflicting decimals", content: `{"precision": 1, "decimals": 2}`, expErr: "precision 1 conflicts with decimals 2"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(writeConfig(t, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.expErr) {
+				t.Errorf("expected error containing %q but got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestRealMainConfig(t *testing.T) {
+	ctx := context.Background()
+	configPath := writeConfig(t, `{"format": "csv", "min-count": 5, "stddev": true}`)
+
+	t.Run("flags override the config file", func(t *testing.T) {
+		stdout := bytes.Buffer{}
+		args := []string{"1brc", "-config", configPath, "-format=text", "-print-config"}
+		if err := realMain(ctx, args, &stdout, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := loadConfig(writeConfig(t, stdout.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expCfg := DefaultConfig()
+		expCfg.MinCount = 5
+		expCfg.StdDev = true
+		if !reflect.DeepEqual(loaded, expCfg) {
+			t.Errorf("expected %+v but got %+v", expCfg, loaded)
+		}
+	})
+
+	t.Run("invalid options fail validation", func(t *testing.T) {
+		args := []string{"1brc", "-config", writeConfig(t, `{"round": "up"}`), "-print-config"}
+		err := realMain(ctx, args, &bytes.Buffer{}, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "unknown rounding mode 'up'") {
+			t.Errorf("expected a rounding mode error but got %v", err)
+		}
+		if code := exitCode(err); code != exitUsage {
+			t.Errorf("expected exit code %d but got %d", exitUsage, code)
+		}
+	})
+}
+
+func TestNearestKey(t *testing.T) {
+	keys := configKeys()
+	tests := map[string]string{
+		"Format":     "format",
+		"percentile": "percentiles",
+		"chunksize":  "chunk-size",
+		"std-dev":    "stddev",
+	}
+	for key, expKey := range tests {
+		if got := nearestKey(key, keys); got != expKey {
+			t.Errorf("nearestKey(%q) expected %q but got %q", key, expKey, got)
+		}
+	}
+}
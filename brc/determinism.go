@@ -0,0 +1,125 @@
+package brc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+)
+
+// determinismParams is the configuration of one run of the determinism check.
+type determinismParams struct {
+	Workers   int
+	ChunkSize int64
+}
+
+func (p determinismParams) String() string {
+	return fmt.Sprintf("workers=%d chunkSize=%d", p.Workers, p.ChunkSize)
+}
+
+// determinismParamSets returns runs parameter sets drawn from a shuffle of
+// the worker count and chunk size combinations seeded with seed, repeating
+// the shuffle when there are more runs than combinations.
+func determinismParamSets(runs int, seed int64) []determinismParams {
+	combinations := []determinismParams{}
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		for _, size := range []int64{4 * 1024, 16 * 1024, 80 * 1024, 1024 * 1024} {
+			combinations = append(combinations, determinismParams{Workers: workers, ChunkSize: size})
+		}
+	}
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(combinations), func(i, j int) {
+		combinations[i], combinations[j] = combinations[j], combinations[i]
+	})
+
+	params := make([]determinismParams, runs)
+	for i := range params {
+		params[i] = combinations[i%len(combinations)]
+	}
+	return params
+}
+
+// determinismMain runs the determinism subcommand: it processes the input
+// file several times with different worker counts and chunk sizes and fails
+// unless every run produces the same output. The runs share the options of
+// -config and the parsing flags, only the concurrency varies.
+func determinismMain(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	base := DefaultConfig()
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	runs := flags.Int("runs", 5, "number of runs to compare")
+	seed := flags.Int64("seed", 1, "seed of the shuffle choosing the parameters of each run")
+	configPath := flags.String("config", "", "read the options of the runs from this JSON config file, flags override it")
+	flags.Func("delimiter", "single byte separating station and temperature (default \";\")", delimiterFlag(&base))
+	flags.IntVar(&base.Precision, "precision", base.Precision, "decimals of the temperatures: 1 for tenths or 2 for hundredths")
+	flags.BoolVar(&base.DecimalComma, "decimal-comma", base.DecimalComma, "read temperatures with a decimal comma such as 12,3")
+	flags.BoolVar(&base.Quoted, "quoted", base.Quoted, "allow double quoted station names containing the delimiter")
+	flags.BoolVar(&base.AllowIntegerTemps, "allow-integer-temps", base.AllowIntegerTemps, "accept temperatures without a fractional part such as 12 as 12.0")
+	flags.BoolVar(&base.Strict, "strict", base.Strict, "fail on the first malformed line instead of skipping it")
+	if err := flags.Parse(args[1:]); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if *configPath != "" {
+		fileCfg, err := loadConfig(*configPath)
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		// like realMain, the flags are parsed again to override the file
+		base = fileCfg
+		if err := flags.Parse(args[1:]); err != nil {
+			return withExitCode(exitUsage, err)
+		}
+	}
+	// the parameters only vary the concurrent engine, whatever the size
+	base.Concurrency = true
+	base.ConcurrencyThreshold = 0
+	if err := validateConfig(base); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if flags.NArg() < 1 {
+		return withExitCode(exitUsage, errors.New("need to supply file"))
+	}
+	if *runs < 2 {
+		return withExitCode(exitUsage, fmt.Errorf("invalid runs %d, need at least 2 to compare", *runs))
+	}
+	filePath := flags.Arg(0)
+
+	// GOMAXPROCS bounds the number of chunk workers running at once
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	params := determinismParamSets(*runs, *seed)
+	hashes := make([]string, len(params))
+	for i, p := range params {
+		runtime.GOMAXPROCS(p.Workers)
+		cfg := base
+		cfg.ChunkSize = p.ChunkSize
+
+		result, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			return fmt.Errorf("run %d (%s): %w", i+1, p, err)
+		}
+		sum := sha256.Sum256([]byte(result))
+		hashes[i] = hex.EncodeToString(sum[:])
+		fmt.Fprintf(stdout, "run %d %s sha256=%s\n", i+1, p, hashes[i])
+	}
+
+	differing := 0
+	for i := range hashes {
+		if hashes[i] != hashes[0] {
+			differing++
+			fmt.Fprintf(stdout, "run %d (%s) differs from run 1 (%s)\n", i+1, params[i], params[0])
+		}
+	}
+	if differing > 0 {
+		fmt.Fprintf(stdout, "reproduce with -seed %d -runs %d\n", *seed, len(params))
+		fmt.Fprintln(stdout, "FAIL")
+		return fmt.Errorf("%d of %d runs produced a different output", differing, len(params))
+	}
+	fmt.Fprintln(stdout, "PASS")
+	return nil
+}
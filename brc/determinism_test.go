@@ -0,0 +1,106 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDeterminism(t *testing.T) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	args := []string{"1brc", "determinism", "-runs", "16", measurementsRoundingIn}
+	if err := realMain(context.Background(), args, &stdout, &stderr); err != nil {
+		t.Fatalf("expected the determinism check to pass but got %v: %s", err, stdout.String())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != 17 || lines[16] != "PASS" {
+		t.Errorf("expected 16 runs and PASS but got %q", stdout.String())
+	}
+}
+
+func TestDeterminismParsingOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		cfg   func(cfg *Config)
+	}{
+		{name: "delimiter", input: measurements10CommaIn, args: []string{"-delimiter", ","}, cfg: func(cfg *Config) { cfg.Delimiter = ',' }},
+		{name: "decimal comma", input: measurements10DecimalIn, args: []string{"-decimal-comma"}, cfg: func(cfg *Config) { cfg.DecimalComma = true }},
+		{name: "config", input: measurements10CommaIn, args: []string{"-config", writeConfig(t, `{"delimiter": ","}`)}, cfg: func(cfg *Config) { cfg.Delimiter = ',' }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tc.cfg(&cfg)
+			expOutput, err := runString(context.Background(), tc.input, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expOutput == "{}" {
+				t.Fatalf("expected the options to parse %s", tc.input)
+			}
+			sum := sha256.Sum256([]byte(expOutput))
+			expHash := "sha256=" + hex.EncodeToString(sum[:])
+
+			stdout := bytes.Buffer{}
+			args := append(append([]string{"1brc", "determinism", "-runs", "3"}, tc.args...), tc.input)
+			if err := realMain(context.Background(), args, &stdout, &bytes.Buffer{}); err != nil {
+				t.Fatalf("expected the determinism check to pass but got %v: %s", err, stdout.String())
+			}
+			// every run parsed the input with the options
+			if n := strings.Count(stdout.String(), expHash); n != 3 {
+				t.Errorf("expected 3 runs with %s but got %q", expHash, stdout.String())
+			}
+		})
+	}
+}
+
+func TestDeterminismDetectsNondeterminism(t *testing.T) {
+	// every merge bumps the max, so the output depends on the number of chunks
+	mergeHook = func(name string, loc *Location) {
+		loc.Max++
+	}
+	defer func() { mergeHook = nil }()
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	args := []string{"1brc", "determinism", "-runs", "16", measurementsRoundingIn}
+	err := realMain(context.Background(), args, &stdout, &stderr)
+	if err == nil || !strings.HasSuffix(err.Error(), "of 16 runs produced a different output") {
+		t.Errorf("expected the determinism check to fail but got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "differs from run 1 (workers=") || !strings.HasSuffix(stdout.String(), "reproduce with -seed 1 -runs 16\nFAIL\n") {
+		t.Errorf("expected the differing parameters, the seed and FAIL but got %q", stdout.String())
+	}
+}
+
+func TestDeterminismParamSets(t *testing.T) {
+	params := determinismParamSets(20, 1)
+	if len(params) != 20 {
+		t.Fatalf("expected 20 parameter sets but got %d", len(params))
+	}
+
+	// the same seed gives the same parameters
+	again := determinismParamSets(20, 1)
+	for i := range params {
+		if params[i] != again[i] {
+			t.Errorf("expected parameter set %d to be %s but got %s", i, params[i], again[i])
+		}
+	}
+	// the first 16 cover every combination, fewer are distinct when
+	// runtime.NumCPU is one of the fixed worker counts
+	workers := map[int]bool{1: true, 2: true, 4: true, runtime.NumCPU(): true}
+	seen := map[determinismParams]bool{}
+	for _, p := range params[:16] {
+		seen[p] = true
+	}
+	if len(seen) != len(workers)*4 {
+		t.Errorf("expected every combination in the first 16 sets but got %v", params[:16])
+	}
+}
@@ -0,0 +1,131 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// dryRunMaxReported is how many invalid line numbers a dry run reports
+const dryRunMaxReported = 10
+
+// dryRunReport is the outcome of validating an input without aggregating it.
+type dryRunReport struct {
+	Lines   int64
+	Valid   int64
+	Invalid int64
+	// Blank lines are neither valid nor invalid
+	Blank int64
+	// FirstInvalid are the 1-based numbers of the first invalid lines
+	FirstInvalid []int64
+}
+
+// dryRun checks every line of file like validate does and summarizes the
+// report as the valid and invalid line counts, with the numbers of the first
+// invalid lines instead of the defects.
+func dryRun(ctx context.Context, file source, cfg Config) (dryRunReport, error) {
+	report, err := validate(ctx, file, cfg)
+	if err != nil {
+		return dryRunReport{}, err
+	}
+	return dryRunReport{
+		Lines:        report.Lines,
+		Valid:        report.Lines - report.Blank - report.Malformed,
+		Invalid:      report.Malformed,
+		Blank:        report.Blank,
+		FirstInvalid: append([]int64{}, report.firstMalformedLines()...),
+	}, nil
+}
+
+// dryRunChunkBounds splits file, past any BOM, into chunks ending on line
+// boundaries. The bounds are found up front so the reports of the chunks
+// combine in file order.
+func dryRunChunkBounds(file source, cfg Config) (starts, ends []int64, err error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	fileSize := fileInfo.Size()
+	start, err := bomLength(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for start < fileSize {
+		end, err := chunkEnd(file, start, fileSize, cfg.chunkSizeFor(fileSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("finding the end of chunk at offset %d: %w", start, err)
+		}
+		starts, ends = append(starts, start), append(ends, end)
+		start = end
+	}
+	return starts, ends, nil
+}
+
+// dryRunWorkers is the number of workers forEachDryRunChunk runs.
+func dryRunWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// forEachDryRunChunk calls check with the index of each of chunks chunks on
+// dryRunWorkers workers, along with the index of the worker so it can reuse
+// its buffers. The workers bound the chunk buffers held at once.
+func forEachDryRunChunk(ctx context.Context, chunks int, check func(worker, i int)) error {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(dryRunWorkers(), chunks); worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < chunks && ctx.Err() == nil; i = int(next.Add(1) - 1) {
+				check(worker, i)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return fmt.Errorf("cancelled due to context: %w", ctx.Err())
+	}
+	return nil
+}
+
+// writeDryRunReport writes report as the output of -dry-run.
+func writeDryRunReport(w io.Writer, report dryRunReport) error {
+	invalid := make([]string, len(report.FirstInvalid))
+	for i, line := range report.FirstInvalid {
+		invalid[i] = fmt.Sprint(line)
+	}
+	_, err := fmt.Fprintf(w, "lines: %d\nvalid: %d\ninvalid: %d\nblank: %d\nfirst invalid lines: %s\n",
+		report.Lines, report.Valid, report.Invalid, report.Blank, strings.Join(invalid, ", "))
+	return err
+}
+
+// runDryRun validates the file at filePath for -dry-run, writing the report
+// to stdout. Invalid lines fail the run with the parse error exit code.
+func runDryRun(ctx context.Context, filePath string, cfg Config, stdout io.Writer) error {
+	if cfg.InputFormat != inputFormatText {
+		return withExitCode(exitUsage, fmt.Errorf("-dry-run only supports %s input", inputFormatText))
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return withExitCode(exitInput, err)
+	}
+	defer f.Close()
+
+	report, err := dryRun(ctx, f, cfg)
+	if err != nil {
+		return inputOrParseError(err)
+	}
+	if err := writeDryRunReport(stdout, report); err != nil {
+		return withExitCode(exitOutput, fmt.Errorf("writing dry run report: %w", err))
+	}
+	if report.Invalid > 0 {
+		return withExitCode(exitParse, fmt.Errorf("%d invalid lines", report.Invalid))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = "station;12.3"
+	}
+	// 1-based line numbers of the bad lines
+	lines[2-1] = "no delimiter"
+	lines[7-1] = "station;x.y"
+	lines[8-1] = ""
+	lines[50-1] = strings.Repeat("s", maxNameLength+1) + ";1.0"
+	lines[51-1] = "station;1.0\r"
+	// the temperature range of -validate applies too
+	lines[120-1] = "station;100.0"
+	lines[199-1] = "station;1."
+	content := strings.Join(lines, "\n") + "\n"
+
+	expReport := dryRunReport{Lines: 200, Valid: 194, Invalid: 5, Blank: 1, FirstInvalid: []int64{2, 7, 50, 120, 199}}
+	for _, size := range []int64{64, 1000, testChunkSize, 0} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = size
+
+		report, err := dryRun(ctx, &dribblingSource{data: []byte(content), dribble: len(content)}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(report, expReport) {
+			t.Errorf("(chunkSize=%d) expected %+v but got %+v", size, expReport, report)
+		}
+	}
+
+	// without a trailing newline the last line still counts
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 64
+	report, err := dryRun(ctx, &dribblingSource{data: []byte(strings.TrimSuffix(content, "\n")), dribble: len(content)}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, expReport) {
+		t.Errorf("(no trailing newline) expected %+v but got %+v", expReport, report)
+	}
+}
+
+func TestDryRunMaxReported(t *testing.T) {
+	content := strings.Repeat("invalid\n", dryRunMaxReported+5)
+	report, err := dryRun(context.Background(), &dribblingSource{data: []byte(content), dribble: len(content)}, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Invalid != dryRunMaxReported+5 || len(report.FirstInvalid) != dryRunMaxReported {
+		t.Errorf("expected %d invalid lines with %d reported but got %+v", dryRunMaxReported+5, dryRunMaxReported, report)
+	}
+}
+
+func TestRealMainDryRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// no CPU profile is written by a dry run
+	chdir(t, dir)
+
+	filePath := filepath.Join(dir, "measurements_dry_run.txt")
+	if err := os.WriteFile(filePath, []byte("a;1.0\nb;x\nc;2.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := bytes.Buffer{}
+	err := realMain(ctx, []string{"1brc", "-dry-run", filePath}, &stdout, &bytes.Buffer{})
+	if code := exitCode(err); code != exitParse {
+		t.Errorf("expected exit code %d but got %d for %v", exitParse, code, err)
+	}
+	expOutput := "lines: 3\nvalid: 2\ninvalid: 1\nblank: 0\nfirst invalid lines: 2\n"
+	if stdout.String() != expOutput {
+		t.Errorf("expected %q but got %q", expOutput, stdout.String())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the input in the working directory but got %d files", len(entries))
+	}
+}
@@ -0,0 +1,23 @@
+package brc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/web-slinger/1brc-go/brc"
+)
+
+func ExampleAggregate() {
+	result, err := brc.Aggregate(context.Background(), "measurements_rounding.txt", brc.DefaultConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+	// Output: {"stations":[{"name":"ham","min":14.6,"mean":25.5,"max":33.6,"count":4},{"name":"jel","min":-9.0,"mean":18.0,"max":46.5,"count":20124}]}
+}
@@ -0,0 +1,121 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+)
+
+// exit codes of the command, letting scripts tell failures apart
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitInput    = 3
+	exitParse    = 4
+	exitOutput   = 5
+	exitInternal = 6
+	exitPartial  = 7
+	exitMismatch = 8
+)
+
+// exitCodesHelp documents the exit codes in the -help output.
+const exitCodesHelp = `
+Exit codes:
+  0  success
+  1  other failure, e.g. profiling setup or a timeout
+  2  usage error: invalid flags or missing file
+  3  input error: the file could not be opened or read
+  4  parse error: the input holds data that cannot be aggregated
+  5  output error: the result could not be written
+  6  internal error: the aggregates failed a consistency check
+  7  partial result: the input shrank during a lenient run and the result
+     only covers the part read
+  8  result mismatch: -verify found the concurrent result differs and
+     -fallback-on-mismatch printed the sequential one
+`
+
+// exitError is an error carrying the exit code Main returns.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode wraps err so Main returns code, leaving nil as is.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// inputOrParseError classifies an error of parsing the input: failed or
+// short reads of the file are input errors and cancellation keeps the generic
+// code, any other error is the data failing to parse.
+func inputOrParseError(err error) error {
+	var pathErr *fs.PathError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &pathErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return withExitCode(exitInput, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	return withExitCode(exitParse, err)
+}
+
+// exitCode maps the error returned by realMain to the exit code of the
+// process.
+func exitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitFailure
+}
+
+// failureAttrs returns the attributes Main logs the error of a failed run
+// with, as key=value pairs of the last line of the text logs: the exit code
+// and, when a chunk failed, how far the run got and the offset of the chunk
+// so tooling can retry or resume from there.
+func failureAttrs(err error) []any {
+	attrs := []any{slog.Int("exitCode", exitCode(err))}
+	var chunkErr *chunkError
+	if errors.As(err, &chunkErr) {
+		percent := 0.0
+		if chunkErr.size > 0 {
+			percent = float64(chunkErr.processed) * 100 / float64(chunkErr.size)
+		}
+		attrs = append(attrs,
+			slog.Int64("bytesProcessed", chunkErr.processed),
+			slog.String("percent", fmt.Sprintf("%.1f", percent)),
+			slog.Float64("elapsedSeconds", chunkErr.elapsed.Seconds()),
+			slog.Int64("failingOffset", chunkErr.offset))
+	}
+	return attrs
+}
+
+// usage prints the usage of the command with its flags and exit codes.
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] <file>\n\nFlags:\n", flags.Name())
+		flags.PrintDefaults()
+		fmt.Fprint(flags.Output(), exitCodesHelp)
+	}
+}
@@ -0,0 +1,146 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRealMainExitCodes(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := fixturePath(t, measurements10In)
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "measurements_malformed.txt")
+	if err := os.WriteFile(malformed, []byte("a;1.0\nb;x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the CPU profile is written to the working directory
+	chdir(t, dir)
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdout  io.Writer
+		expCode int
+	}{
+		{name: "success", args: []string{filePath}, expCode: exitOK},
+		{name: "help", args: []string{"-help"}, expCode: exitOK},
+		{name: "no file", args: nil, expCode: exitUsage},
+		{name: "unknown flag", args: []string{"-unknown", filePath}, expCode: exitUsage},
+		{name: "invalid config", args: []string{"-format=xml", filePath}, expCode: exitUsage},
+		{name: "invalid log format", args: []string{"-log-format=xml", filePath}, expCode: exitUsage},
+		{name: "determinism usage", args: []string{"determinism"}, expCode: exitUsage},
+		{name: "compare usage", args: []string{"compare", filePath}, expCode: exitUsage},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.txt")}, expCode: exitInput},
+		{name: "parse error", args: []string{"-strict", malformed}, expCode: exitParse},
+		{name: "output error", args: []string{filePath}, stdout: failingWriter{}, expCode: exitOutput},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := tc.stdout
+			if stdout == nil {
+				stdout = &bytes.Buffer{}
+			}
+			err := realMain(ctx, append([]string{"1brc"}, tc.args...), stdout, &bytes.Buffer{})
+			if code := exitCode(err); code != tc.expCode {
+				t.Errorf("expected exit code %d but got %d for error %v", tc.expCode, code, err)
+			}
+		})
+	}
+}
+
+func TestRealMainHelpExitCodes(t *testing.T) {
+	stderr := bytes.Buffer{}
+	realMain(context.Background(), []string{"1brc", "-help"}, &bytes.Buffer{}, &stderr)
+
+	for _, exp := range []string{"Usage: 1brc [flags] <file>", "-format", "Exit codes:", "3  input error"} {
+		if !strings.Contains(stderr.String(), exp) {
+			t.Errorf("expected %q in the help output but got %q", exp, stderr.String())
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	wrapped := withExitCode(exitInput, errors.New("open"))
+	tests := []struct {
+		err     error
+		expCode int
+	}{
+		{err: nil, expCode: exitOK},
+		{err: errors.New("profiling"), expCode: exitFailure},
+		{err: wrapped, expCode: exitInput},
+		{err: errors.Join(errors.New("context"), wrapped), expCode: exitInput},
+		{err: withExitCode(exitParse, nil), expCode: exitOK},
+	}
+
+	for _, tc := range tests {
+		if code := exitCode(tc.err); code != tc.expCode {
+			t.Errorf("exitCode(%v) expected %d but got %d", tc.err, tc.expCode, code)
+		}
+	}
+}
+
+func TestFailureAttrs(t *testing.T) {
+	data, err := os.ReadFile(generateMeasurementsFile(t, 10_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failAt := int64(len(data) / 2)
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	_, _, _, err = parseFileWithConcurrency(context.Background(), &failingSource{data: data, failAt: failAt}, cfg, nil)
+	err = inputOrParseError(err)
+	if !strings.Contains(fmt.Sprint(err), "bytes") {
+		t.Errorf("expected the bytes processed in the error but got %v", err)
+	}
+
+	// the summary is the key=value pairs of the line Main logs
+	stderr := bytes.Buffer{}
+	slog.New(slog.NewTextHandler(&stderr, nil)).Error(err.Error(), failureAttrs(err)...)
+	summary := map[string]string{}
+	for _, field := range regexp.MustCompile(`(\w+)=(\S+)`).FindAllStringSubmatch(stderr.String(), -1) {
+		summary[field[1]] = field[2]
+	}
+
+	if summary["exitCode"] != strconv.Itoa(exitCode(err)) {
+		t.Errorf("expected exitCode=%d but got %q", exitCode(err), stderr.String())
+	}
+	// chunks from failAt on fail, those before it are processed
+	offset, err := strconv.ParseInt(summary["failingOffset"], 10, 64)
+	if err != nil || offset < failAt || offset >= int64(len(data)) {
+		t.Errorf("expected a failingOffset from %d but got %q", failAt, stderr.String())
+	}
+	processed, err := strconv.ParseInt(summary["bytesProcessed"], 10, 64)
+	if err != nil || processed >= int64(len(data)) {
+		t.Errorf("expected fewer than %d bytesProcessed but got %q", len(data), stderr.String())
+	}
+	for _, key := range []string{"percent", "elapsedSeconds"} {
+		if _, err := strconv.ParseFloat(summary[key], 64); err != nil {
+			t.Errorf("expected %s in the summary but got %q", key, stderr.String())
+		}
+	}
+
+	// errors without a failing chunk only carry the exit code
+	if attrs := failureAttrs(withExitCode(exitUsage, errors.New("usage"))); len(attrs) != 1 {
+		t.Errorf("expected only the exit code but got %v", attrs)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
@@ -0,0 +1,106 @@
+package brc
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// pageCacheDropper tells the kernel to drop the pages of the input once their
+// chunks are parsed, for -fadvise, so a one-shot scan of a large file doesn't
+// evict the rest of the page cache. Chunks finish out of order and don't
+// start on page boundaries, so only the page aligned prefix of the input
+// parsed without gaps is dropped: a page shared with a chunk still being
+// read stays cached.
+type pageCacheDropper struct {
+	// advise drops the pages of [offset, offset+length) of the input
+	advise   func(offset, length int64) error
+	pageSize int64
+	size     int64
+
+	mu sync.Mutex
+	// done maps the start of every chunk parsed past the prefix to its end
+	done map[int64]int64
+	// prefix is the end of the input parsed without gaps
+	prefix int64
+	// dropped is the end of the input dropped so far
+	dropped int64
+	// failed stops advising after the first error
+	failed bool
+}
+
+// newPageCacheDropper returns a dropper for the input of file from start to
+// size, nil when file isn't backed by an open file.
+func newPageCacheDropper(file source, start, size int64) *pageCacheDropper {
+	var f *os.File
+	var offset int64
+	switch file := file.(type) {
+	case *os.File:
+		f = file
+	case sectionSource:
+		f, offset = file.file, file.offset
+	case *rangeSource:
+		f, offset = file.file, file.start
+	default:
+		return nil
+	}
+	advise := func(off, length int64) error {
+		return adviseDontNeed(f, offset+off, length)
+	}
+	return newPageCacheDropperFunc(advise, int64(os.Getpagesize()), start, size)
+}
+
+func newPageCacheDropperFunc(advise func(offset, length int64) error, pageSize, start, size int64) *pageCacheDropper {
+	return &pageCacheDropper{
+		advise:   advise,
+		pageSize: pageSize,
+		size:     size,
+		done:     map[int64]int64{},
+		prefix:   start,
+	}
+}
+
+// parsed records the chunk [start, end) as parsed, dropping the pages the
+// prefix now covers in full, or up to the end of the input once it reaches it.
+func (d *pageCacheDropper) parsed(start, end int64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.done[start] = end
+	for {
+		end, ok := d.done[d.prefix]
+		if !ok {
+			break
+		}
+		delete(d.done, d.prefix)
+		d.prefix = end
+	}
+	limit := d.prefix
+	if limit < d.size {
+		limit -= limit % d.pageSize
+	}
+	from := d.dropped
+	if d.failed || limit <= from {
+		d.mu.Unlock()
+		return
+	}
+	d.dropped = limit
+	d.mu.Unlock()
+
+	// the advice is a hint, failing it only costs the page cache
+	if err := d.advise(from, limit-from); err != nil {
+		slog.Debug("dropping parsed input from the page cache", slog.Int64("offset", from), slog.Any("error", err))
+		d.mu.Lock()
+		d.failed = true
+		d.mu.Unlock()
+	}
+}
+
+// adviseInput hints the kernel that f is about to be read sequentially, for
+// -fadvise. Failing is only logged as the run reads the file regardless.
+func adviseInput(f *os.File) {
+	if err := adviseSequential(f); err != nil {
+		slog.Debug("advising sequential input", slog.Any("error", err))
+	}
+}
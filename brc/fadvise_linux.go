@@ -0,0 +1,17 @@
+//go:build linux
+
+package brc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func adviseSequential(f *os.File) error {
+	return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+func adviseDontNeed(f *os.File, offset, length int64) error {
+	return unix.Fadvise(int(f.Fd()), offset, length, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package brc
+
+import (
+	"errors"
+	"os"
+)
+
+// errFadviseUnsupported is returned by the -fadvise hints on platforms
+// without posix_fadvise.
+var errFadviseUnsupported = errors.New("posix_fadvise isn't supported on this platform")
+
+func adviseSequential(*os.File) error {
+	return errFadviseUnsupported
+}
+
+func adviseDontNeed(*os.File, int64, int64) error {
+	return errFadviseUnsupported
+}
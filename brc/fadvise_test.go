@@ -0,0 +1,69 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPageCacheDropper(t *testing.T) {
+	type drop struct{ offset, length int64 }
+	var drops []drop
+	advise := func(offset, length int64) error {
+		drops = append(drops, drop{offset, length})
+		return nil
+	}
+
+	// a 3 byte BOM, pages of 10 bytes and chunks finishing out of order
+	d := newPageCacheDropperFunc(advise, 10, 3, 47)
+	steps := []struct {
+		start, end int64
+		expDrops   []drop
+	}{
+		// a gap before the chunk keeps it cached
+		{start: 15, end: 28},
+		// closing the gap drops up to the page boundary before 28
+		{start: 3, end: 15, expDrops: []drop{{0, 20}}},
+		{start: 40, end: 47, expDrops: []drop{{0, 20}}},
+		// reaching the end of the input drops its last partial page
+		{start: 28, end: 40, expDrops: []drop{{0, 20}, {20, 27}}},
+	}
+	for _, step := range steps {
+		d.parsed(step.start, step.end)
+		if !reflect.DeepEqual(drops, step.expDrops) {
+			t.Errorf("after [%d, %d) expected the drops %v but got %v", step.start, step.end, step.expDrops, drops)
+		}
+	}
+
+	// the first failure stops the advice
+	calls := 0
+	d = newPageCacheDropperFunc(func(int64, int64) error {
+		calls++
+		return errors.New("unsupported")
+	}, 10, 0, 30)
+	d.parsed(0, 10)
+	d.parsed(10, 30)
+	if calls != 1 {
+		t.Errorf("expected a single call after the failure but got %d", calls)
+	}
+
+	var nilDropper *pageCacheDropper
+	nilDropper.parsed(0, 10)
+}
+
+func TestRunFadvise(t *testing.T) {
+	for _, concurrency := range []bool{false, true} {
+		cfg := DefaultConfig()
+		cfg.Fadvise = true
+		setConcurrency(&cfg, concurrency)
+		cfg.ChunkSize = 64
+		output, err := runString(context.Background(), measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurements10Out {
+			t.Errorf("(concurrency=%v) expected %q but got %q", concurrency, measurements10Out, output)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package brc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// initialTableSize is the starting capacity of a stationTable, a power of two
+// above the 413 stations of the 1BRC data set so a chunk rarely grows it
+const initialTableSize = 1024
+
+// stationTable is an open addressing hash table of station locations with
+// linear probing, the per-chunk accumulator of -fast-map. Entries live in a
+// flat slice indexed by the FNV-1a hash of the name, which is kept with the
+// hash to tell apart stations whose probes collide.
+type stationTable struct {
+	entries []tableEntry
+	mask    uint64
+	len     int
+	// names, when set, interns the names of new entries
+	names *internTable
+}
+
+// tableEntry is a slot of a stationTable, free while loc.Count is 0 as every
+// stored location has at least one reading.
+type tableEntry struct {
+	hash uint64
+	name string
+	loc  Location
+}
+
+// newStationTable returns a table with capacity for size entries, size being
+// a power of two.
+func newStationTable(size int) *stationTable {
+	return &stationTable{entries: make([]tableEntry, size), mask: uint64(size - 1)}
+}
+
+// fnv1a returns the 64-bit FNV-1a hash of name, inlined rather than through
+// hash/fnv to keep the hot path free of allocations.
+func fnv1a(name string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// add merges location into the entry of name, adding the reading to the
+// entry's histogram when trackHistogram is set.
+func (t *stationTable) add(name string, location *Location, trackHistogram bool) error {
+	h := fnv1a(name)
+	i := h & t.mask
+	for {
+		e := &t.entries[i]
+		if e.loc.Count == 0 {
+			if t.names != nil {
+				name = t.names.intern(name)
+			}
+			e.hash, e.name = h, name
+			t.len++
+		} else if e.hash != h || e.name != name {
+			i = (i + 1) & t.mask
+			continue
+		}
+
+		if err := mergeLocation(&e.loc, *location); err != nil {
+			return fmt.Errorf("location '%s': %w", name, err)
+		}
+		if trackHistogram {
+			if e.loc.Histogram == nil {
+				e.loc.Histogram = &histogram{}
+			}
+			if err := e.loc.Histogram.add(location.Total); err != nil {
+				return fmt.Errorf("location '%s': %w", name, err)
+			}
+		}
+		// grow at a load factor of 3/4 to keep the probes short
+		if t.len*4 > len(t.entries)*3 {
+			t.grow()
+		}
+		return nil
+	}
+}
+
+// grow doubles the capacity of the table, reinserting every entry.
+func (t *stationTable) grow() {
+	entries := t.entries
+	t.entries = make([]tableEntry, 2*len(entries))
+	t.mask = uint64(len(t.entries) - 1)
+	for _, e := range entries {
+		if e.loc.Count == 0 {
+			continue
+		}
+		i := e.hash & t.mask
+		for t.entries[i].loc.Count != 0 {
+			i = (i + 1) & t.mask
+		}
+		t.entries[i] = e
+	}
+}
+
+// get returns the location of name, nil when the table doesn't hold it.
+func (t *stationTable) get(name string) *Location {
+	h := fnv1a(name)
+	for i := h & t.mask; t.entries[i].loc.Count != 0; i = (i + 1) & t.mask {
+		if e := &t.entries[i]; e.hash == h && e.name == name {
+			return &e.loc
+		}
+	}
+	return nil
+}
+
+// each calls f with every station of the table in slot order, stopping at
+// the first error.
+func (t *stationTable) each(f func(name string, loc *Location) error) error {
+	for i := range t.entries {
+		if e := &t.entries[i]; e.loc.Count != 0 {
+			if err := f(e.name, &e.loc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processChunkTable is processChunk accumulating into a stationTable.
+func processChunkTable(input []byte, cfg Config) (*stationTable, scanStats, error) {
+	table := newStationTable(initialTableSize)
+	table.names = internTables.Get().(*internTable)
+	defer internTables.Put(table.names)
+	trackHistogram := tracksHistogram(cfg)
+	var scan scanStats
+
+	for _, line := range strings.Split(string(input), "\n") {
+		skipped := scan.skipped
+		locationName, location := processLine(line, cfg, &scan)
+		if location == nil {
+			if cfg.Strict && scan.skipped > skipped {
+				return nil, scanStats{}, malformedLineError(line, cfg)
+			}
+			continue
+		}
+		if err := table.add(locationName, location, trackHistogram); err != nil {
+			return nil, scanStats{}, err
+		}
+	}
+
+	return table, scan, nil
+}
@@ -0,0 +1,87 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestStationTable(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// short names over a two letter alphabet differ in few bytes, and a
+	// table starting at 2 slots grows through every size with long probes
+	table := newStationTable(2)
+	expMap := map[string]Location{}
+	for i := 0; i < 20_000; i++ {
+		name := make([]byte, 1+rng.Intn(10))
+		for j := range name {
+			name[j] = "ab"[rng.Intn(2)]
+		}
+		location := newLocation(int64(rng.Intn(1999) - 999))
+
+		exp := expMap[string(name)]
+		if err := mergeLocation(&exp, location); err != nil {
+			t.Fatal(err)
+		}
+		expMap[string(name)] = exp
+		if err := table.add(string(name), &location, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	locationMap := map[string]Location{}
+	err := table.each(func(name string, loc *Location) error {
+		if _, ok := locationMap[name]; ok {
+			return fmt.Errorf("station %q iterated twice", name)
+		}
+		locationMap[name] = *loc
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(locationMap, expMap) {
+		t.Errorf("expected the table to hold the %d stations of the map but got %d", len(expMap), len(locationMap))
+	}
+	if table.len != len(expMap) {
+		t.Errorf("expected a length of %d but got %d", len(expMap), table.len)
+	}
+	for name, exp := range expMap {
+		if loc := table.get(name); loc == nil || *loc != exp {
+			t.Fatalf("expected %q to be %+v but got %+v", name, exp, loc)
+		}
+	}
+	if loc := table.get("c"); loc != nil {
+		t.Errorf("expected a missing station but got %+v", loc)
+	}
+}
+
+func TestRunFastMap(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 100_000, 1)
+
+	for _, in := range []string{measurements10In, measurementsHundredthsIn, filePath} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = testChunkSize
+		cfg.Percentiles = []float64{50, 99}
+		setConcurrency(&cfg, true)
+		if in == measurementsHundredthsIn {
+			cfg.Precision, cfg.Percentiles = 2, nil
+		}
+		expOutput, err := runString(ctx, in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg.FastMap = true
+		output, err := runString(ctx, in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != expOutput {
+			t.Errorf("(%s) expected %q but got %q", in, expOutput, output)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package brc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zeebo/xxh3"
+)
+
+// input hash algorithms
+const (
+	inputHashSHA256 = "sha256"
+	// inputHashXXH3 is the 128-bit XXH3, much faster than sha256 but not
+	// cryptographic
+	inputHashXXH3 = "xxh3"
+)
+
+// hashBlockSize is the size of the blocks of the input hashed on their own,
+// aligned to it in the file so the blocks don't depend on how the file was
+// chunked
+const hashBlockSize = 1 << 20
+
+// inputHasher hashes the bytes a run consumed. The input is split into
+// hashBlockSize blocks at aligned offsets, each hashed on its own once all
+// of its bytes were added, and the final hash is taken over the (offset,
+// length, hash) of every block sorted by offset. The digest is the same
+// whichever engine read the input, in whichever chunks or order.
+type inputHasher struct {
+	algorithm string
+	mu        sync.Mutex
+	// start and end are the input the run reads, see expect
+	start, end int64
+	expected   bool
+	ranges     []rangeHash
+	// partial are the blocks only part of which was added so far, by block
+	// index
+	partial map[int64]*partialBlock
+}
+
+type rangeHash struct {
+	offset int64
+	length int64
+	sum    []byte
+}
+
+// partialBlock collects the bytes of a block added in several pieces. The
+// bytes added are contiguous once the block is complete, from lo to hi in
+// the file.
+type partialBlock struct {
+	data   []byte
+	lo, hi int64
+	filled int64
+}
+
+// newInputHasher returns a hasher for algorithm, or nil when algorithm is
+// empty and hashing is disabled. The methods of a nil hasher are no-ops.
+func newInputHasher(algorithm string) (*inputHasher, error) {
+	switch algorithm {
+	case "":
+		return nil, nil
+	case inputHashSHA256, inputHashXXH3:
+		return &inputHasher{algorithm: algorithm, partial: map[int64]*partialBlock{}}, nil
+	}
+	return nil, fmt.Errorf("unknown input hash '%s', expected %s or %s", algorithm, inputHashSHA256, inputHashXXH3)
+}
+
+// sum returns the hash of data with the algorithm of h.
+func (h *inputHasher) sum(data []byte) []byte {
+	if h.algorithm == inputHashXXH3 {
+		sum := xxh3.Hash128(data).Bytes()
+		return sum[:]
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// expect records that the run reads the input from start to end, the range
+// Sum requires the added bytes to cover.
+func (h *inputHasher) expect(start, end int64) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.start, h.end, h.expected = start, end, true
+	h.mu.Unlock()
+}
+
+// add records data read at offset. It may be called concurrently for
+// disjoint ranges of the input.
+func (h *inputHasher) add(offset int64, data []byte) {
+	if h == nil {
+		return
+	}
+	for len(data) > 0 {
+		blockStart := offset - offset%hashBlockSize
+		n := min(int64(len(data)), blockStart+hashBlockSize-offset)
+		if n == hashBlockSize {
+			// a whole block is hashed without copying it
+			h.record(rangeHash{offset: offset, length: n, sum: h.sum(data[:n])})
+		} else {
+			h.addPiece(blockStart, offset, data[:n])
+		}
+		data, offset = data[n:], offset+n
+	}
+}
+
+// addPiece copies the piece of the block at blockStart read at offset,
+// hashing the block once it is complete.
+func (h *inputHasher) addPiece(blockStart, offset int64, piece []byte) {
+	h.mu.Lock()
+	block, ok := h.partial[blockStart/hashBlockSize]
+	if !ok {
+		block = &partialBlock{data: make([]byte, hashBlockSize), lo: offset, hi: offset}
+		h.partial[blockStart/hashBlockSize] = block
+	}
+	copy(block.data[offset-blockStart:], piece)
+	block.lo = min(block.lo, offset)
+	block.hi = max(block.hi, offset+int64(len(piece)))
+	block.filled += int64(len(piece))
+	complete := block.filled == hashBlockSize
+	if complete {
+		delete(h.partial, blockStart/hashBlockSize)
+	}
+	h.mu.Unlock()
+
+	if complete {
+		h.record(rangeHash{offset: blockStart, length: hashBlockSize, sum: h.sum(block.data)})
+	}
+}
+
+func (h *inputHasher) record(r rangeHash) {
+	h.mu.Lock()
+	h.ranges = append(h.ranges, r)
+	h.mu.Unlock()
+}
+
+// Sum returns the hex encoded hash of all added bytes, or "" for a nil
+// hasher. The blocks still partial, at the start and end of the input, are
+// hashed as far as they were added. Unless the added bytes cover the
+// expected input without gaps, as after a failed run, Sum returns an error
+// rather than the hash of an input that wasn't read.
+func (h *inputHasher) Sum() (string, error) {
+	if h == nil {
+		return "", nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ranges := append([]rangeHash(nil), h.ranges...)
+	for index, block := range h.partial {
+		if block.filled != block.hi-block.lo {
+			return "", fmt.Errorf("hashed input has a gap in [%d, %d)", block.lo, block.hi)
+		}
+		blockStart := index * hashBlockSize
+		ranges = append(ranges, rangeHash{
+			offset: block.lo,
+			length: block.hi - block.lo,
+			sum:    h.sum(block.data[block.lo-blockStart : block.hi-blockStart]),
+		})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].offset < ranges[j].offset
+	})
+
+	if !h.expected {
+		return "", errors.New("hashed input has no expected range")
+	}
+	covered := h.start
+	for _, r := range ranges {
+		if r.offset != covered {
+			return "", fmt.Errorf("hashed input has a gap at offset %d", covered)
+		}
+		covered += r.length
+	}
+	if covered != h.end {
+		return "", fmt.Errorf("hashed input ends at offset %d instead of %d", covered, h.end)
+	}
+
+	records := make([]byte, 0, len(ranges)*(16+sha256.Size))
+	for _, r := range ranges {
+		records = binary.BigEndian.AppendUint64(records, uint64(r.offset))
+		records = binary.BigEndian.AppendUint64(records, uint64(r.length))
+		records = append(records, r.sum...)
+	}
+	return hex.EncodeToString(h.sum(records)), nil
+}
+
+// hashStream adds a range that is read sequentially to an inputHasher,
+// written to through an io.TeeReader.
+type hashStream struct {
+	hasher *inputHasher
+	offset int64
+}
+
+// newHashStream returns a hashStream for bytes read from offset onwards, or
+// nil when h is nil.
+func (h *inputHasher) newHashStream(offset int64) *hashStream {
+	if h == nil {
+		return nil
+	}
+	return &hashStream{hasher: h, offset: offset}
+}
+
+func (s *hashStream) Write(p []byte) (int, error) {
+	s.hasher.add(s.offset, p)
+	s.offset += int64(len(p))
+	return len(p), nil
+}
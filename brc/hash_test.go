@@ -0,0 +1,212 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRunInputHash(t *testing.T) {
+	ctx := context.Background()
+	// a few hash blocks, read in many chunks
+	filePath := generateMeasurementsFile(t, 300_000, 1)
+
+	tests := []struct {
+		name      string
+		mode      string
+		chunkSize int64
+	}{
+		{name: "sequential", mode: modeSequential},
+		{name: "concurrent", mode: modeConcurrent},
+		{name: "small chunks", mode: modeConcurrent, chunkSize: 4096},
+		{name: "unaligned chunks", mode: modeConcurrent, chunkSize: hashBlockSize + 7},
+		{name: "sharded", mode: modeSharded, chunkSize: 100_000},
+	}
+	// the hex length of the digest of each algorithm
+	for algorithm, length := range map[string]int{inputHashSHA256: 64, inputHashXXH3: 32} {
+		hashes := map[string][]string{}
+		for _, tc := range tests {
+			for _, procs := range []int{1, 8} {
+				cfg := DefaultConfig()
+				setConcurrency(&cfg, tc.mode != modeSequential)
+				cfg.Sharded = tc.mode == modeSharded
+				cfg.ChunkSize = tc.chunkSize
+				cfg.InputHash = algorithm
+
+				previous := runtime.GOMAXPROCS(procs)
+				_, stats, err := runWithStats(ctx, filePath, cfg)
+				runtime.GOMAXPROCS(previous)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(stats.InputHash) != length {
+					t.Fatalf("(%s) expected a hex %s but got %q", tc.name, algorithm, stats.InputHash)
+				}
+				hashes[stats.InputHash] = append(hashes[stats.InputHash], fmt.Sprintf("%s/GOMAXPROCS=%d", tc.name, procs))
+			}
+		}
+		if len(hashes) != 1 {
+			t.Errorf("expected the same %s hash for every engine, chunk size and GOMAXPROCS but got %v", algorithm, hashes)
+		}
+	}
+}
+
+func TestInputHasherPieces(t *testing.T) {
+	data := make([]byte, 3*hashBlockSize+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// the input hashed from an unaligned offset, as past a BOM
+	whole, err := newInputHasher(inputHashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole.expect(3, int64(len(data)))
+	whole.add(3, data[3:])
+	expSum, err := whole.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pieceSize := range []int{1000, 4096, hashBlockSize - 1, hashBlockSize + 1} {
+		hasher, err := newInputHasher(inputHashSHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hasher.expect(3, int64(len(data)))
+		// added concurrently, in reverse order
+		var wg sync.WaitGroup
+		for end := len(data); end > 3; end -= pieceSize {
+			start := max(end-pieceSize, 3)
+			wg.Add(1)
+			go func(start, end int) {
+				defer wg.Done()
+				hasher.add(int64(start), data[start:end])
+			}(start, end)
+		}
+		wg.Wait()
+		if sum, err := hasher.Sum(); err != nil || sum != expSum {
+			t.Errorf("(pieceSize=%d) expected %s but got %s, %v", pieceSize, expSum, sum, err)
+		}
+	}
+}
+
+func TestInputHasherGaps(t *testing.T) {
+	data := make([]byte, 3*hashBlockSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	size := int64(len(data))
+
+	tests := []struct {
+		name   string
+		pieces [][2]int64
+		expErr string
+	}{
+		{name: "nothing added", expErr: fmt.Sprintf("hashed input ends at offset 0 instead of %d", size)},
+		{name: "missing start", pieces: [][2]int64{{100, size}}, expErr: "hashed input has a gap at offset 0"},
+		{name: "missing block", pieces: [][2]int64{{0, hashBlockSize}, {2 * hashBlockSize, size}}, expErr: fmt.Sprintf("hashed input has a gap at offset %d", hashBlockSize)},
+		{name: "missing piece of a block", pieces: [][2]int64{{0, 100}, {200, size}}, expErr: "hashed input has a gap in [0, 1048576)"},
+		{name: "missing end", pieces: [][2]int64{{0, size - 1}}, expErr: fmt.Sprintf("hashed input ends at offset %d instead of %d", size-1, size)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hasher, err := newInputHasher(inputHashXXH3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasher.expect(0, size)
+			for _, piece := range tc.pieces {
+				hasher.add(piece[0], data[piece[0]:piece[1]])
+			}
+			if sum, err := hasher.Sum(); err == nil || err.Error() != tc.expErr {
+				t.Errorf("expected error %q but got %q, %v", tc.expErr, sum, err)
+			}
+		})
+	}
+}
+
+func TestRunInputHashChangesWithInput(t *testing.T) {
+	ctx := context.Background()
+
+	data, err := os.ReadFile(measurementsRoundingIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// change a single temperature digit in the second chunk
+	data[len(data)-2]++
+	filePath := filepath.Join(t.TempDir(), "measurements_rounding_changed.txt")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.InputHash = inputHashSHA256
+
+		_, original, err := runWithStats(ctx, measurementsRoundingIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, changed, err := runWithStats(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if original.InputHash == changed.InputHash {
+			t.Errorf("(concurrency=%v) expected a one byte change to change the hash", concurrency)
+		}
+	}
+}
+
+func TestRunInputHashDisabled(t *testing.T) {
+	_, stats, err := runWithStats(context.Background(), measurements10In, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.InputHash != "" {
+		t.Errorf("expected no hash by default but got %q", stats.InputHash)
+	}
+
+	cfg := DefaultConfig()
+	cfg.InputHash = "md5"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected an unknown hash algorithm to be rejected")
+	}
+}
+
+func TestRunInputHashAutoChunkSize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates a 10MB input")
+	}
+	ctx := context.Background()
+	// past autoChunksPerWorker minimum chunks, the automatic chunk size
+	// differs between GOMAXPROCS 1 and 8
+	filePath := generateMeasurementsFile(t, 750_000, 1)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if autoChunkSize(fileInfo.Size(), 1) == autoChunkSize(fileInfo.Size(), 8) {
+		t.Fatalf("expected the %d byte input to be chunked differently by 1 and 8 workers", fileInfo.Size())
+	}
+
+	cfg := DefaultConfig()
+	setConcurrency(&cfg, true)
+	cfg.InputHash = inputHashSHA256
+	hashes := map[string]int{}
+	for _, procs := range []int{1, 8} {
+		previous := runtime.GOMAXPROCS(procs)
+		_, stats, err := runWithStats(ctx, filePath, cfg)
+		runtime.GOMAXPROCS(previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[stats.InputHash]++
+	}
+	if len(hashes) != 1 {
+		t.Errorf("expected the same hash for every GOMAXPROCS but got %v", hashes)
+	}
+}
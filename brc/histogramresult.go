@@ -0,0 +1,77 @@
+package brc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// histogramBarWidth is the length of the bar of the fullest bucket of a
+// station in the histogram format, the others are scaled to it
+const histogramBarWidth = 40
+
+// createHistogramResult draws an ASCII histogram of the readings of each
+// station, or only of cfg.Station, in buckets of cfg.HistogramBucket tenths:
+//
+//	Hamburg (3 readings)
+//	 9.0 | ######################################## 2
+//	10.0 |  0
+//	11.0 | #################### 1
+//
+// Buckets are labelled by their lower bound, the empty ones between the
+// lowest and highest reading are kept so the bars show the distribution.
+func createHistogramResult(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	if cfg.Station != "" {
+		if _, ok := locationMap[cfg.Station]; !ok {
+			return "", fmt.Errorf("station '%s' not found", cfg.Station)
+		}
+		locations = []string{cfg.Station}
+	} else if !cfg.Unordered {
+		sortStations(locations)
+	}
+
+	var b strings.Builder
+	for i, name := range locations {
+		details, ok := locationMap[name]
+		if !ok {
+			return "", fmt.Errorf("location '%s' found in locations but not in map", name)
+		}
+		if details.Histogram == nil {
+			return "", fmt.Errorf("location '%s' has no histogram", name)
+		}
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s (%d readings)\n", name, details.Count)
+		writeHistogramBars(&b, details.Histogram.buckets(cfg.HistogramBucket), int64(cfg.HistogramBucket))
+	}
+	return b.String(), nil
+}
+
+// writeHistogramBars writes a line per bucket of width tenths from the first
+// to the last of buckets, filling the gaps with empty buckets.
+func writeHistogramBars(b *strings.Builder, buckets []histogramBucket, width int64) {
+	if len(buckets) == 0 {
+		return
+	}
+	first, last := buckets[0].lower, buckets[len(buckets)-1].lower
+
+	var maxCount int64
+	labelWidth := 0
+	for _, bucket := range buckets {
+		maxCount = max(maxCount, bucket.count)
+	}
+	for lower := first; lower <= last; lower += width {
+		labelWidth = max(labelWidth, len(formatTemperature(lower, 1)))
+	}
+
+	for lower := first; lower <= last; lower += width {
+		var count int64
+		if len(buckets) > 0 && buckets[0].lower == lower {
+			count = buckets[0].count
+			buckets = buckets[1:]
+		}
+		// round up so a single reading still shows
+		bar := int((count*histogramBarWidth + maxCount - 1) / maxCount)
+		fmt.Fprintf(b, "%*s | %s %d\n", labelWidth, formatTemperature(lower, 1), strings.Repeat("#", bar), count)
+	}
+}
@@ -0,0 +1,98 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunHistogramFormat(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "measurements.txt")
+	input := "a;1.0\nb;-2.0\na;1.5\na;-0.5\na;1.9\na;3.2\nb;-1.1\n"
+	if err := os.WriteFile(filePath, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg := DefaultConfig()
+	cfg.Format = formatHistogram
+	_, locationMap, _, err := parseFile(context.Background(), f, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expBuckets := []histogramBucket{{lower: -10, count: 1}, {lower: 10, count: 3}, {lower: 30, count: 1}}
+	if buckets := locationMap["a"].Histogram.buckets(10); !reflect.DeepEqual(buckets, expBuckets) {
+		t.Errorf("expected the buckets %v but got %v", expBuckets, buckets)
+	}
+
+	tests := []struct {
+		name      string
+		station   string
+		bucket    int
+		expOutput string
+	}{
+		{
+			name:   "all stations",
+			bucket: 10,
+			expOutput: "a (5 readings)\n" +
+				"-1.0 | ############## 1\n" +
+				" 0.0 |  0\n" +
+				" 1.0 | ######################################## 3\n" +
+				" 2.0 |  0\n" +
+				" 3.0 | ############## 1\n" +
+				"\n" +
+				"b (2 readings)\n" +
+				"-2.0 | ######################################## 2\n",
+		},
+		{
+			name:    "one station",
+			station: "a",
+			bucket:  20,
+			expOutput: "a (5 readings)\n" +
+				"-2.0 | ############## 1\n" +
+				" 0.0 | ######################################## 3\n" +
+				" 2.0 | ############## 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Format = formatHistogram
+			cfg.Station = tt.station
+			cfg.HistogramBucket = tt.bucket
+			output, err := runString(context.Background(), filePath, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.expOutput {
+				t.Errorf("expected %q but got %q", tt.expOutput, output)
+			}
+		})
+	}
+
+	cfg.Station = "c"
+	if _, err := runString(context.Background(), filePath, cfg); err == nil {
+		t.Error("expected an unknown station to fail")
+	}
+}
+
+func TestValidateConfigHistogramFormat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Station = "a"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected -station without the histogram format to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Format = formatHistogram
+	cfg.Precision = 2
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected the histogram format with a precision of 2 to be rejected")
+	}
+}
@@ -0,0 +1,210 @@
+package brc
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math"
+	"math/bits"
+)
+
+const (
+	// hllPrecision is the number of hash bits selecting a register, 2^12
+	// registers give a standard error of 1.04/sqrt(4096) ~ 1.6%
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+
+	// the prescan reads prescanWindows evenly spread windows of
+	// prescanWindowSize bytes, 4MB in total
+	prescanWindows    = 16
+	prescanWindowSize = 256 * 1024
+	// prescanMinFileSize is the file size below which pre-sizing maps isn't
+	// worth a prescan
+	prescanMinFileSize = 64 * 1024 * 1024
+	// prescanMaxEstimate caps the estimate when nearly every sampled line is
+	// a different station and the sample can't bound the cardinality
+	prescanMaxEstimate = 1 << 20
+	// minLineLength is the length of the shortest valid line
+	minLineLength = int64(len("a;0\n"))
+)
+
+// hyperLogLog is a HyperLogLog sketch estimating the number of distinct
+// station names it has seen.
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+func (h *hyperLogLog) add(name []byte) {
+	hash := hashName(name)
+	index := hash >> (64 - hllPrecision)
+	// the guard bit bounds the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() float64 {
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return estimate
+}
+
+// hashName hashes a station name with FNV-1a, finished with the splitmix64
+// mixer as HyperLogLog needs well distributed high bits.
+func hashName(name []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(name)
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// estimateStations estimates the number of distinct stations in
+// [start, fileSize) from a sample of evenly spread windows.
+//
+// The distinct names in the sample are counted with a HyperLogLog sketch and
+// scaled up assuming stations are about equally frequent, as in generated
+// 1BRC datasets, in which case the estimate is within 10% of the actual
+// count. Skewed station frequencies make it an underestimate.
+func estimateStations(file io.ReaderAt, start, fileSize int64, delimiter byte) (int, error) {
+	sketch := hyperLogLog{}
+	sampledLines := 0
+
+	span := fileSize - start
+	windows := int64(prescanWindows)
+	windowSize := int64(prescanWindowSize)
+	whole := span <= windows*windowSize
+	if whole {
+		windows = 1
+		windowSize = span
+	}
+
+	buffer := make([]byte, windowSize)
+	for i := int64(0); i < windows; i++ {
+		offset := start
+		if windows > 1 {
+			offset += i * (span - windowSize) / (windows - 1)
+		}
+
+		n, err := file.ReadAt(buffer, offset)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		window := buffer[:n]
+
+		// drop the partial lines at either end of the window
+		if offset > start {
+			newline := bytes.IndexByte(window, '\n')
+			if newline == -1 {
+				continue
+			}
+			window = window[newline+1:]
+		}
+		if offset+int64(n) < fileSize {
+			newline := bytes.LastIndexByte(window, '\n')
+			if newline == -1 {
+				continue
+			}
+			window = window[:newline]
+		}
+
+		for len(window) > 0 {
+			line := window
+			if newline := bytes.IndexByte(window, '\n'); newline != -1 {
+				line, window = window[:newline], window[newline+1:]
+			} else {
+				window = nil
+			}
+
+			splitIndex := bytes.IndexByte(line, delimiter)
+			if splitIndex == -1 {
+				continue
+			}
+			sketch.add(line[:splitIndex])
+			sampledLines++
+		}
+	}
+
+	distinct := sketch.estimate()
+	if whole {
+		return int(math.Round(distinct)), nil
+	}
+	return uniformCardinality(distinct, float64(sampledLines)), nil
+}
+
+// uniformCardinality returns the number of equally frequent stations D for
+// which a sample of m lines is expected to contain d distinct ones, solving
+// d = D(1 - e^(-m/D)) by bisection.
+func uniformCardinality(d, m float64) int {
+	if d >= 0.999*m {
+		return prescanMaxEstimate
+	}
+
+	low, high := d, float64(prescanMaxEstimate)
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if mid*(1-math.Exp(-m/mid)) < d {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return int(math.Round(low))
+}
+
+// stationsHint returns the station count of file used to pre-size the
+// aggregation maps: the estimate of the prescan, or cfg.StationsHint when the
+// prescan is disabled, the file is too small to benefit or the prescan
+// failed.
+func stationsHint(file source, cfg Config) int {
+	if cfg.NoPrescan {
+		return cfg.StationsHint
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return cfg.StationsHint
+	}
+	if fileInfo.Size() < prescanMinFileSize {
+		return capStationsHint(cfg.StationsHint, fileInfo.Size())
+	}
+	start, err := bomLength(file)
+	if err != nil {
+		return cfg.StationsHint
+	}
+
+	estimate, err := estimateStations(file, start, fileInfo.Size(), cfg.Delimiter)
+	if err != nil {
+		slog.Debug("prescan failed", slog.String("error", err.Error()))
+		return cfg.StationsHint
+	}
+	slog.Info("prescan", slog.Int("estimatedStations", estimate))
+	return estimate
+}
+
+// capStationsHint caps hint at the number of lines size bytes can hold, so
+// a small file or chunk doesn't allocate a map for stations it can't have.
+func capStationsHint(hint int, size int64) int {
+	return int(min(int64(hint), size/minLineLength))
+}
@@ -0,0 +1,130 @@
+package brc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, distinct := range []int{0, 1, 100, 10_000, 1_000_000} {
+		t.Run(strconv.Itoa(distinct), func(t *testing.T) {
+			sketch := hyperLogLog{}
+			for i := 0; i < distinct; i++ {
+				name := []byte(fmt.Sprintf("station %d", i))
+				// duplicates must not change the estimate
+				sketch.add(name)
+				sketch.add(name)
+			}
+
+			estimate := sketch.estimate()
+			if distinct == 0 {
+				if estimate != 0 {
+					t.Fatalf("estimate = %f, want 0", estimate)
+				}
+				return
+			}
+			// 3 standard errors
+			if err := math.Abs(estimate-float64(distinct)) / float64(distinct); err > 0.05 {
+				t.Errorf("estimate = %.0f, want %d ±5%%", estimate, distinct)
+			}
+		})
+	}
+}
+
+func TestEstimateStations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates large inputs")
+	}
+
+	for _, stations := range []int{400, 10_000, 100_000} {
+		t.Run(strconv.Itoa(stations), func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := generateStationMeasurements(&buffer, 2_000_000, stations, 1); err != nil {
+				t.Fatal(err)
+			}
+			data := buffer.Bytes()
+
+			estimate, err := estimateStations(bytes.NewReader(data), 0, int64(len(data)), ';')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := math.Abs(float64(estimate-stations)) / float64(stations); err > 0.1 {
+				t.Errorf("estimate = %d, want %d ±10%%", estimate, stations)
+			}
+		})
+	}
+}
+
+func TestEstimateStationsWholeFile(t *testing.T) {
+	data := []byte("a;1.0\nb;2.0\r\na;3.0\nbad line\nc;4.0")
+
+	estimate, err := estimateStations(bytes.NewReader(data), 0, int64(len(data)), ';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate != 3 {
+		t.Errorf("estimate = %d, want 3", estimate)
+	}
+}
+
+func TestStationsHintNoPrescan(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.NoPrescan = true
+
+	if hint := stationsHint(untouchedSource{t}, cfg); hint != cfg.StationsHint {
+		t.Errorf("hint = %d, want %d", hint, cfg.StationsHint)
+	}
+}
+
+func TestCapStationsHint(t *testing.T) {
+	tests := []struct {
+		hint    int
+		size    int64
+		expHint int
+	}{
+		{hint: 10_000, size: 1 << 20, expHint: 10_000},
+		// a 100 byte chunk holds at most 25 "a;0\n" lines
+		{hint: 10_000, size: 100, expHint: 25},
+		{hint: 0, size: 1 << 20, expHint: 0},
+	}
+	for _, tc := range tests {
+		if hint := capStationsHint(tc.hint, tc.size); hint != tc.expHint {
+			t.Errorf("capStationsHint(%d, %d) = %d, want %d", tc.hint, tc.size, hint, tc.expHint)
+		}
+	}
+}
+
+// untouchedSource fails the test if the prescan reads it.
+type untouchedSource struct {
+	t *testing.T
+}
+
+func (s untouchedSource) ReadAt(p []byte, off int64) (int, error) {
+	s.t.Fatal("ReadAt called with the prescan disabled")
+	return 0, nil
+}
+
+func (s untouchedSource) Stat() (fs.FileInfo, error) {
+	s.t.Fatal("Stat called with the prescan disabled")
+	return nil, nil
+}
+
+// generateStationMeasurements writes rows of "station;temperature" lines with
+// stations drawn uniformly from the given number of synthetic names.
+func generateStationMeasurements(w io.Writer, rows, stations int, seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	bw := bufio.NewWriter(w)
+
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(bw, "Station %d;%.1f\n", rng.Intn(stations), float64(rng.Intn(1999)-999)/10)
+	}
+
+	return bw.Flush()
+}
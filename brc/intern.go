@@ -0,0 +1,40 @@
+package brc
+
+import (
+	"strings"
+	"sync"
+)
+
+// maxInternedNames bounds an internTable, well above the 10k stations of the
+// 1BRC rules, so an input of mostly distinct names can't grow a pooled table
+// without limit
+const maxInternedNames = 1 << 16
+
+// internTable hands out a single copy of every station name it's given. The
+// workers of a concurrent run take a table from internTables for each chunk,
+// so as the pool keeps about one table per P a name is allocated at most
+// once per worker rather than once per chunk. The merger keeps the interned
+// string of whichever worker saw a station first as its key.
+//
+// The names of a chunk are slices of the chunk, interning them also keeps the
+// merged map from retaining every chunk a station was first seen in.
+type internTable struct {
+	names map[string]string
+}
+
+var internTables = sync.Pool{
+	New: func() any { return &internTable{names: map[string]string{}} },
+}
+
+// intern returns the interned copy of name, sharing no memory with it.
+func (t *internTable) intern(name string) string {
+	if s, ok := t.names[name]; ok {
+		return s
+	}
+	if len(t.names) >= maxInternedNames {
+		clear(t.names)
+	}
+	s := strings.Clone(name)
+	t.names[s] = s
+	return s
+}
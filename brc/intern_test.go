@@ -0,0 +1,30 @@
+package brc
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestInternTable(t *testing.T) {
+	table := &internTable{names: map[string]string{}}
+
+	chunk := "Hamburg;12.0\nHamburg;3.4\n"
+	first := table.intern(chunk[:7])
+	if first != "Hamburg" {
+		t.Fatalf("expected Hamburg but got %q", first)
+	}
+	if unsafe.StringData(first) == unsafe.StringData(chunk) {
+		t.Error("expected the interned name not to share memory with the chunk")
+	}
+	if second := table.intern(chunk[13:20]); unsafe.StringData(second) != unsafe.StringData(first) {
+		t.Error("expected the second occurrence to return the interned name")
+	}
+
+	for i := 0; i < maxInternedNames; i++ {
+		table.intern(fmt.Sprintf("station-%d", i))
+	}
+	if len(table.names) > maxInternedNames {
+		t.Errorf("expected at most %d interned names but got %d", maxInternedNames, len(table.names))
+	}
+}
@@ -0,0 +1,54 @@
+package brc
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkInvariants verifies the aggregates of a parsed text input before they
+// are output: the station counts must add up to the lines aggregated, no
+// station may have a Min above its Max and there may be no more stations
+// than cfg.MaxStations. A violation is a bug in the engine or a broken
+// assumption about the input, printing the result would print a wrong one.
+func checkInvariants(locationMap map[string]Location, scan scanStats, cfg Config) error {
+	if cfg.MaxStations > 0 && len(locationMap) > cfg.MaxStations {
+		return fmt.Errorf("%d stations exceed the maximum of %d", len(locationMap), cfg.MaxStations)
+	}
+	var count int64
+	for name, loc := range locationMap {
+		if loc.Min > loc.Max {
+			return fmt.Errorf("station %q has min %d above max %d", name, loc.Min, loc.Max)
+		}
+		count += loc.Count
+	}
+	if count != scan.lines {
+		return fmt.Errorf("station counts add up to %d but %d lines were aggregated", count, scan.lines)
+	}
+	return nil
+}
+
+// invariantError fails the run with the internal error exit code, dumping
+// the aggregates to a temporary file in the checkpoint format for diagnosis.
+func invariantError(err error, locations []string, locationMap map[string]Location, cfg Config) error {
+	dump, dumpErr := dumpAggregates(locations, locationMap, cfg)
+	if dumpErr != nil {
+		return withExitCode(exitInternal, fmt.Errorf("internal error: %w (dumping the aggregates failed: %v)", err, dumpErr))
+	}
+	return withExitCode(exitInternal, fmt.Errorf("internal error: %w, aggregates dumped to %s", err, dump))
+}
+
+// dumpAggregates saves the aggregates as a checkpoint in a new temporary
+// file and returns its path.
+func dumpAggregates(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	f, err := os.CreateTemp("", "1brc-aggregates-*.gob")
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if cfg.Unordered {
+		locations = mapLocations(locationMap)
+	}
+	return f.Name(), saveCheckpoint(f.Name(), locations, locationMap, cfg)
+}
@@ -0,0 +1,106 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	locationMap := map[string]Location{
+		"a": {Min: -5, Max: 10, Total: 5, Count: 2},
+		"b": {Min: 3, Max: 3, Total: 3, Count: 1},
+	}
+	if err := checkInvariants(locationMap, scanStats{lines: 3}, DefaultConfig()); err != nil {
+		t.Errorf("expected consistent aggregates to pass but got %v", err)
+	}
+
+	expErr := "station counts add up to 3 but 4 lines were aggregated"
+	if err := checkInvariants(locationMap, scanStats{lines: 4}, DefaultConfig()); err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.MaxStations = 2
+	if err := checkInvariants(locationMap, scanStats{lines: 3}, cfg); err != nil {
+		t.Errorf("expected as many stations as the maximum to pass but got %v", err)
+	}
+	cfg.MaxStations = 1
+	expErr = "2 stations exceed the maximum of 1"
+	if err := checkInvariants(locationMap, scanStats{lines: 3}, cfg); err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+
+	locationMap["b"] = Location{Min: 4, Max: 3, Total: 3, Count: 1}
+	expErr = `station "b" has min 4 above max 3`
+	if err := checkInvariants(locationMap, scanStats{lines: 3}, DefaultConfig()); err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+}
+
+func TestRunInvariantViolation(t *testing.T) {
+	defer func() { mergeHook = nil }()
+	// the hook corrupts the merges of the concurrent engine
+	cfg := DefaultConfig()
+	setConcurrency(&cfg, true)
+
+	tests := []struct {
+		name    string
+		corrupt func(loc *Location)
+		expErr  string
+	}{
+		{name: "count", corrupt: func(loc *Location) { loc.Count++ }, expErr: "lines were aggregated"},
+		{name: "min above max", corrupt: func(loc *Location) { loc.Min = loc.Max + 1 }, expErr: `station "Halifax" has min`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mergeHook = func(name string, loc *Location) {
+				if name == "Halifax" {
+					tc.corrupt(loc)
+				}
+			}
+
+			_, err := runString(context.Background(), measurements10In, cfg)
+			if code := exitCode(err); code != exitInternal {
+				t.Fatalf("expected exit code %d but got %d for %v", exitInternal, code, err)
+			}
+			if !strings.Contains(err.Error(), tc.expErr) {
+				t.Errorf("expected the error to contain %q but got %v", tc.expErr, err)
+			}
+
+			_, dump, ok := strings.Cut(err.Error(), "aggregates dumped to ")
+			if !ok {
+				t.Fatalf("expected the dump path in %v", err)
+			}
+			defer os.Remove(dump)
+			state, err := loadCheckpoint(dump, DefaultConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(state.LocationMap) != 10 {
+				t.Errorf("expected the 10 stations in the dump but got %d", len(state.LocationMap))
+			}
+		})
+	}
+}
+
+func TestRunMaxStations(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxStations = 10
+	if _, err := runString(context.Background(), measurements10In, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.MaxStations = 9
+	_, err := runString(context.Background(), measurements10In, cfg)
+	if code := exitCode(err); code != exitInternal {
+		t.Fatalf("expected exit code %d but got %d for %v", exitInternal, code, err)
+	}
+	if !strings.Contains(err.Error(), "10 stations exceed the maximum of 9") {
+		t.Errorf("expected the station count in %v", err)
+	}
+	if _, dump, ok := strings.Cut(err.Error(), "aggregates dumped to "); ok {
+		os.Remove(dump)
+	}
+}
@@ -0,0 +1,75 @@
+package brc
+
+import (
+	"errors"
+	"expvar"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+)
+
+// processMetrics are the counters published through expvar, letting a long
+// run be observed by scraping /debug/vars. They accumulate over every run of
+// the process.
+type processMetrics struct {
+	chunks  *expvar.Int
+	lines   *expvar.Int
+	bytes   *expvar.Int
+	skipped *expvar.Int
+}
+
+// metrics is registered once as expvar panics on duplicate names.
+var metrics = processMetrics{
+	chunks:  expvar.NewInt("chunksProcessed"),
+	lines:   expvar.NewInt("linesParsed"),
+	bytes:   expvar.NewInt("bytesRead"),
+	skipped: expvar.NewInt("skippedLines"),
+}
+
+// addChunk counts a chunk of size bytes processed by a worker.
+func (m processMetrics) addChunk(size int64, scan scanStats) {
+	m.chunks.Add(1)
+	m.bytes.Add(size)
+	m.lines.Add(scan.lines)
+	m.skipped.Add(scan.skipped)
+}
+
+// addLines publishes the line counts of scan gained since published, which
+// is then advanced to scan.
+func (m processMetrics) addLines(published *scanStats, scan scanStats) {
+	m.lines.Add(scan.lines - published.lines)
+	m.skipped.Add(scan.skipped - published.skipped)
+	*published = scan
+}
+
+// metricsReader counts the bytes read from the sequential input.
+type metricsReader struct {
+	file *os.File
+}
+
+func (r metricsReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	metrics.bytes.Add(int64(n))
+	return n, err
+}
+
+// serveMetrics serves /debug/vars on addr until the returned listener is
+// closed.
+func serveMetrics(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Error("serving metrics", slog.String("error", err.Error()))
+		}
+	}()
+
+	slog.Info("serving metrics", slog.String("addr", listener.Addr().String()))
+	return listener, nil
+}
@@ -0,0 +1,79 @@
+package brc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// metricsSnapshot reads the current values of the process metrics.
+func metricsSnapshot() [4]int64 {
+	return [4]int64{metrics.chunks.Value(), metrics.lines.Value(), metrics.bytes.Value(), metrics.skipped.Value()}
+}
+
+func TestRunMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	lines := []string{"a;1.0", "no delimiter", "b;1.", "", "a;-2.0", "b;3.5", "c;x.y", "d;4.5"}
+	content := strings.Join(lines, "\n") + "\n"
+	filePath := filepath.Join(t.TempDir(), "measurements_metrics.txt")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+
+		before := metricsSnapshot()
+		if _, err := runString(ctx, filePath, cfg); err != nil {
+			t.Fatal(err)
+		}
+		after := metricsSnapshot()
+
+		if lines := after[1] - before[1]; lines != 4 {
+			t.Errorf("(concurrency=%v) expected 4 lines parsed but got %d", concurrency, lines)
+		}
+		if bytes := after[2] - before[2]; bytes != int64(len(content)) {
+			t.Errorf("(concurrency=%v) expected %d bytes read but got %d", concurrency, len(content), bytes)
+		}
+		if skipped := after[3] - before[3]; skipped != 3 {
+			t.Errorf("(concurrency=%v) expected 3 skipped lines but got %d", concurrency, skipped)
+		}
+		expChunks := int64(0)
+		if concurrency {
+			expChunks = 1
+		}
+		if chunks := after[0] - before[0]; chunks != expChunks {
+			t.Errorf("(concurrency=%v) expected %d chunks processed but got %d", concurrency, expChunks, chunks)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	listener, err := serveMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	vars := map[string]json.RawMessage{}
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chunksProcessed", "linesParsed", "bytesRead", "skippedLines"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("expected %s in /debug/vars", name)
+		}
+	}
+}
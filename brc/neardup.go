@@ -0,0 +1,53 @@
+package brc
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// nearDuplicate is a group of distinct station names that are equal after
+// NFC normalization, case folding and trimming whitespace.
+type nearDuplicate struct {
+	// Folded is the form the names share
+	Folded string
+	// Names are sorted and Counts holds the readings of each name
+	Names  []string
+	Counts []int64
+}
+
+// foldName returns the form of name near duplicates share.
+func foldName(name string, caser cases.Caser) string {
+	return caser.String(norm.NFC.String(strings.TrimSpace(name)))
+}
+
+// findNearDuplicates returns the groups of near duplicate station names in
+// locationMap, sorted by their first name. It runs on the aggregated names
+// rather than per reading so its cost doesn't grow with the input.
+func findNearDuplicates(locationMap map[string]Location) []nearDuplicate {
+	caser := cases.Fold()
+	groups := map[string][]string{}
+	for name := range locationMap {
+		folded := foldName(name, caser)
+		groups[folded] = append(groups[folded], name)
+	}
+
+	duplicates := []nearDuplicate{}
+	for folded, names := range groups {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Strings(names)
+		counts := make([]int64, len(names))
+		for i, name := range names {
+			counts[i] = locationMap[name].Count
+		}
+		duplicates = append(duplicates, nearDuplicate{Folded: folded, Names: names, Counts: counts})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Names[0] < duplicates[j].Names[0]
+	})
+	return duplicates
+}
@@ -0,0 +1,62 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindNearDuplicates(t *testing.T) {
+	locationMap := map[string]Location{
+		// precomposed and combining é
+		"Caf\u00e9":   {Count: 3},
+		"Cafe\u0301":  {Count: 2},
+		" caf\u00e9 ": {Count: 1},
+		"Z\u00fcrich": {Count: 4},
+		"Z\u00dcRICH": {Count: 5},
+		"Berlin":      {Count: 6},
+		"Bern":        {Count: 7},
+	}
+
+	expDuplicates := []nearDuplicate{
+		{Folded: "caf\u00e9", Names: []string{" caf\u00e9 ", "Cafe\u0301", "Caf\u00e9"}, Counts: []int64{1, 2, 3}},
+		{Folded: "z\u00fcrich", Names: []string{"Z\u00dcRICH", "Z\u00fcrich"}, Counts: []int64{5, 4}},
+	}
+	if duplicates := findNearDuplicates(locationMap); !reflect.DeepEqual(duplicates, expDuplicates) {
+		t.Errorf("expected %+v but got %+v", expDuplicates, duplicates)
+	}
+
+	if duplicates := findNearDuplicates(map[string]Location{"Berlin": {}, "Bern": {}}); len(duplicates) != 0 {
+		t.Errorf("expected no near duplicates but got %+v", duplicates)
+	}
+}
+
+func TestRunNearDuplicateReport(t *testing.T) {
+	lines := []string{"Caf\u00e9;1.0", "Cafe\u0301;2.0", "Caf\u00e9;3.0", "Bern;4.0"}
+	filePath := filepath.Join(t.TempDir(), "measurements_near_duplicates.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	output, _, err := runWithStats(context.Background(), filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.NearDuplicateReport = true
+	reportOutput, stats, err := runWithStats(context.Background(), filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reportOutput != output {
+		t.Errorf("expected the report not to change the output %q but got %q", output, reportOutput)
+	}
+	expDuplicates := []nearDuplicate{{Folded: "caf\u00e9", Names: []string{"Cafe\u0301", "Caf\u00e9"}, Counts: []int64{1, 2}}}
+	if !reflect.DeepEqual(stats.NearDuplicates, expDuplicates) {
+		t.Errorf("expected %+v but got %+v", expDuplicates, stats.NearDuplicates)
+	}
+}
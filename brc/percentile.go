@@ -0,0 +1,203 @@
+package brc
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// histogramOffset shifts tenths in [-999, 999] to a histogram index
+	histogramOffset = 999
+	// histogramMaxTenths bounds the readings a histogram holds, the ±999.9
+	// the parser accepts
+	histogramMaxTenths = 9999
+)
+
+// histogram counts the readings of a station per tenth of a degree. At 8KB
+// per station it is only allocated when percentiles are requested, each chunk
+// map holds one per station in the chunk until merged.
+type histogram struct {
+	// Counts are the readings in [-99.9, 99.9] by tenth, offset by
+	// histogramOffset
+	Counts [2*histogramOffset + 2]uint32
+	// Outliers are the rarer readings beyond ±99.9 by tenth, only allocated
+	// once one is added
+	Outliers map[int64]uint32
+}
+
+// errHistogramRange is returned when a reading doesn't fit the histogram.
+var errHistogramRange = errors.New("temperature outside the histogram range of ±999.9")
+
+func (h *histogram) add(temperature int64) error {
+	if index := temperature + histogramOffset; index >= 0 && index < int64(len(h.Counts)) {
+		h.Counts[index]++
+		return nil
+	}
+	if temperature < -histogramMaxTenths || temperature > histogramMaxTenths {
+		return errHistogramRange
+	}
+	if h.Outliers == nil {
+		h.Outliers = map[int64]uint32{}
+	}
+	h.Outliers[temperature]++
+	return nil
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i := range other.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	for tenths, count := range other.Outliers {
+		if h.Outliers == nil {
+			h.Outliers = map[int64]uint32{}
+		}
+		h.Outliers[tenths] += count
+	}
+}
+
+// each calls fn with the count of every tenth holding readings in ascending
+// order, stopping once fn returns false.
+func (h *histogram) each(fn func(tenths, count int64) bool) {
+	outliers := make([]int64, 0, len(h.Outliers))
+	for tenths := range h.Outliers {
+		outliers = append(outliers, tenths)
+	}
+	sort.Slice(outliers, func(i, j int) bool { return outliers[i] < outliers[j] })
+
+	// the outliers below the counts, then those above them
+	i := 0
+	for ; i < len(outliers) && outliers[i] < 0; i++ {
+		if !fn(outliers[i], int64(h.Outliers[outliers[i]])) {
+			return
+		}
+	}
+	for index, count := range h.Counts {
+		if count > 0 && !fn(int64(index)-histogramOffset, int64(count)) {
+			return
+		}
+	}
+	for ; i < len(outliers); i++ {
+		if !fn(outliers[i], int64(h.Outliers[outliers[i]])) {
+			return
+		}
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of the count readings
+// in the histogram.
+func (h *histogram) percentile(p float64, count int64) int64 {
+	rank := int64(math.Ceil(p / 100 * float64(count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var cumulative int64
+	result := int64(histogramMaxTenths)
+	h.each(func(tenths, count int64) bool {
+		cumulative += count
+		if cumulative >= rank {
+			result = tenths
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// histogramBucket is the count of readings from lower, in tenths, up to the
+// next bucket.
+type histogramBucket struct {
+	lower int64
+	count int64
+}
+
+// buckets returns the non-empty buckets of bucketWidth tenths in ascending
+// order. A bucket is labelled by its lower bound, the bucket 1.0 of width 10
+// holds 1.0 to 1.9.
+func (h *histogram) buckets(bucketWidth int) []histogramBucket {
+	buckets := []histogramBucket{}
+	h.each(func(tenths, count int64) bool {
+		// floor division so negative tenths fall in the bucket below zero
+		lower := tenths / int64(bucketWidth) * int64(bucketWidth)
+		if lower > tenths {
+			lower -= int64(bucketWidth)
+		}
+		if n := len(buckets); n > 0 && buckets[n-1].lower == lower {
+			buckets[n-1].count += count
+		} else {
+			buckets = append(buckets, histogramBucket{lower: lower, count: count})
+		}
+		return true
+	})
+	return buckets
+}
+
+// parsePercentiles parses a comma separated list of percentiles such as
+// "50,90,99.9".
+func parsePercentiles(s string) ([]float64, error) {
+	percentiles := []float64{}
+	for _, field := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile %q", field)
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, nil
+}
+
+// formatPercentile formats p for a column header, e.g. p50 or p99.9.
+func formatPercentile(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// tracksHistogram reports whether cfg needs a histogram per station.
+func tracksHistogram(cfg Config) bool {
+	return len(cfg.Percentiles) > 0 || cfg.HistogramOut != "" || cfg.Format == formatHistogram
+}
+
+// writeHistogramFile writes the histograms of locations to path, see
+// writeHistograms.
+func writeHistogramFile(path string, locations []string, locationMap map[string]Location, bucketWidth int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeHistograms(f, locations, locationMap, bucketWidth); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeHistograms writes a station,bucket,count CSV row for each non-empty
+// bucket of bucketWidth tenths, stations sorted by name, see
+// histogram.buckets.
+func writeHistograms(w io.Writer, locations []string, locationMap map[string]Location, bucketWidth int) error {
+	sorted := append([]string(nil), locations...)
+	sortStations(sorted)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"station", "bucket", "count"})
+
+	for _, location := range sorted {
+		h := locationMap[location].Histogram
+		if h == nil {
+			continue
+		}
+
+		for _, bucket := range h.buckets(bucketWidth) {
+			writer.Write([]string{location, formatTemperature(bucket.lower, 1), strconv.FormatInt(bucket.count, 10)})
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,207 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunPercentiles(t *testing.T) {
+	ctx := context.Background()
+
+	// a holds 0.1 to 10.0 in steps of 0.1, b nine readings of 0.0 and one of 50.0
+	lines := []string{}
+	for i := 100; i >= 1; i-- {
+		lines = append(lines, "a;"+strconv.FormatFloat(float64(i)/10, 'f', 1, 64))
+	}
+	for i := 0; i < 9; i++ {
+		lines = append(lines, "b;0.0")
+	}
+	lines = append(lines, "b;50.0")
+
+	filePath := filepath.Join(t.TempDir(), "measurements_percentiles.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Percentiles = []float64{50, 90, 99, 100}
+
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{a=0.1/5.1/10.0/5.0/9.0/9.9/10.0, b=0.0/5.0/50.0/0.0/0.0/50.0/50.0}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		cfg.Format = formatCSV
+		output, err = runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "station,min,mean,max,count,p50,p90,p99,p100\na,0.1,5.1,10.0,100,5.0,9.0,9.9,10.0\nb,0.0,5.0,50.0,10,0.0,0.0,50.0,50.0\n"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunPercentilesAcrossChunks(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+
+	cfg := DefaultConfig()
+	cfg.Percentiles = []float64{1, 25, 50, 75, 99.9}
+
+	cfg.Concurrency = false
+	expOutput, err := runString(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setConcurrency(&cfg, true)
+	output, err := runString(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != expOutput {
+		t.Error("expected merged chunk histograms to match the sequential result")
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	percentiles, err := parsePercentiles("50, 90,99.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(percentiles) != 3 || percentiles[0] != 50 || percentiles[1] != 90 || percentiles[2] != 99.9 {
+		t.Errorf("expected [50 90 99.9] but got %v", percentiles)
+	}
+
+	if _, err := parsePercentiles("50,abc"); err == nil {
+		t.Error("expected an invalid percentile to be rejected")
+	}
+
+	for _, p := range []float64{0, -1, 100.1} {
+		cfg := DefaultConfig()
+		cfg.Percentiles = []float64{p}
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("expected percentile %v to be rejected", p)
+		}
+	}
+}
+
+func TestRunHistogramOut(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.HistogramOut = filepath.Join(t.TempDir(), "histogram.csv")
+		cfg.HistogramBucket = 100
+
+		output, err := runString(ctx, measurementsRoundingIn, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != measurementsRoundingOut {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, measurementsRoundingOut, output)
+		}
+
+		histograms, err := os.ReadFile(cfg.HistogramOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expHistograms := "station,bucket,count\n" +
+			"ham,10.0,1\nham,20.0,1\nham,30.0,2\n" +
+			"jel,-10.0,99\njel,0.0,2388\njel,10.0,9884\njel,20.0,6908\njel,30.0,825\njel,40.0,20\n"
+		if string(histograms) != expHistograms {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expHistograms, string(histograms))
+		}
+	}
+}
+
+func TestRunHistogramOutDefaultBucket(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HistogramOut = filepath.Join(t.TempDir(), "histogram.csv")
+
+	if _, err := runString(context.Background(), measurementsRoundingIn, cfg); err != nil {
+		t.Fatal(err)
+	}
+	histograms, err := os.ReadFile(cfg.HistogramOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(strings.TrimSuffix(string(histograms), "\n"), "\n")
+	expRows := map[string]bool{
+		"ham,14.0,1": true, "ham,21.0,1": true, "ham,31.0,1": true, "ham,33.0,1": true,
+		"jel,-9.0,1": true, "jel,-1.0,36": true, "jel,0.0,58": true, "jel,19.0,1166": true, "jel,46.0,1": true,
+	}
+	found := 0
+	for _, row := range rows[1:] {
+		if expRows[row] {
+			found++
+		}
+	}
+	if found != len(expRows) {
+		t.Errorf("expected rows %v in %v", expRows, rows)
+	}
+	// 4 ham buckets and 53 jel buckets between -9 and 46 with 43 and 44 empty
+	if len(rows) != 1+4+54 {
+		t.Errorf("expected %d rows but got %d", 1+4+54, len(rows))
+	}
+}
+
+func TestWriteHistogramsNegativeBuckets(t *testing.T) {
+	h := &histogram{}
+	for _, tenths := range []int64{-15, -10, -1, 0, 9, 10} {
+		h.add(tenths)
+	}
+	locationMap := map[string]Location{"a": {Histogram: h}}
+
+	var buffer strings.Builder
+	if err := writeHistograms(&buffer, []string{"a"}, locationMap, 10); err != nil {
+		t.Fatal(err)
+	}
+	expOutput := "station,bucket,count\na,-2.0,1\na,-1.0,2\na,0.0,2\na,1.0,1\n"
+	if buffer.String() != expOutput {
+		t.Errorf("expected %+v but got %+v", expOutput, buffer.String())
+	}
+}
+
+func TestHistogramOutliers(t *testing.T) {
+	h := &histogram{}
+	for _, tenths := range []int64{1000, -9999, 999, 5, 9999, -1000} {
+		if err := h.add(tenths); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := &histogram{}
+	other.add(1000)
+	h.merge(other)
+	for _, tenths := range []int64{10000, -10000} {
+		if err := h.add(tenths); !errors.Is(err, errHistogramRange) {
+			t.Errorf("(%d) expected %v but got %v", tenths, errHistogramRange, err)
+		}
+	}
+
+	expBuckets := []histogramBucket{{lower: -10000, count: 1}, {lower: -1000, count: 1}, {lower: 0, count: 2}, {lower: 1000, count: 2}, {lower: 9000, count: 1}}
+	if buckets := h.buckets(1000); !reflect.DeepEqual(buckets, expBuckets) {
+		t.Errorf("expected the buckets %v but got %v", expBuckets, buckets)
+	}
+	for p, expTenths := range map[float64]int64{1: -9999, 20: -1000, 40: 5, 50: 999, 70: 1000, 100: 9999} {
+		if tenths := h.percentile(p, 7); tenths != expTenths {
+			t.Errorf("(p%v) expected %d but got %d", p, expTenths, tenths)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package brc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// createProfile creates the CPU profile of a run over inputPath in dir, named
+// after the input file and the mode of the run. An existing profile is kept
+// by adding the first free -N suffix to the name, unless overwrite is set.
+func createProfile(dir, inputPath, mode string, overwrite bool) (*os.File, error) {
+	// get file name no ext
+	fileName := filepath.Base(inputPath)
+	fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-" + mode
+
+	profilePath := filepath.Join(dir, fileName+"-profile.pb.gz")
+	if overwrite {
+		return os.Create(profilePath)
+	}
+
+	for suffix := 1; ; suffix++ {
+		// O_EXCL also keeps concurrent runs from claiming the same name
+		f, err := os.OpenFile(profilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+		profilePath = filepath.Join(dir, fmt.Sprintf("%s-profile-%d.pb.gz", fileName, suffix))
+	}
+}
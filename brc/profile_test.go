@@ -0,0 +1,62 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRealMainProfileDir(t *testing.T) {
+	ctx := context.Background()
+
+	filePath := fixturePath(t, measurements10In)
+	// nothing may be written to the working directory
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+	dir := t.TempDir()
+
+	profiles := func() []string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	for i := 0; i < 2; i++ {
+		stderr := bytes.Buffer{}
+		if err := realMain(ctx, []string{"1brc", "-profile-dir", dir, filePath}, &bytes.Buffer{}, &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(stderr.Bytes(), []byte("msg=\"cpu profile\" path="+dir)) {
+			t.Errorf("expected the profile path logged but got %q", stderr.String())
+		}
+	}
+	// the small fixture falls back to the sequential parser
+	expProfiles := []string{"measurements_ten-sequential-profile-1.pb.gz", "measurements_ten-sequential-profile.pb.gz"}
+	if got := profiles(); !reflect.DeepEqual(got, expProfiles) {
+		t.Errorf("expected profiles %v but got %v", expProfiles, got)
+	}
+
+	if err := realMain(ctx, []string{"1brc", "-profile-dir", dir, "-profile-overwrite", filePath}, &bytes.Buffer{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := profiles(); !reflect.DeepEqual(got, expProfiles) {
+		t.Errorf("expected -profile-overwrite to keep profiles %v but got %v", expProfiles, got)
+	}
+
+	wd, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wd) != 0 {
+		t.Errorf("expected nothing written to the working directory but got %d files", len(wd))
+	}
+}
@@ -0,0 +1,79 @@
+package brc
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseRange parses a -range value, start:length in bytes.
+func parseRange(s string) (start, length int64, err error) {
+	startField, lengthField, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q, expected start:length", s)
+	}
+	if start, err = strconv.ParseInt(startField, 10, 64); err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range start %q", startField)
+	}
+	if length, err = strconv.ParseInt(lengthField, 10, 64); err != nil || length < 1 {
+		return 0, 0, fmt.Errorf("invalid range length %q", lengthField)
+	}
+	return start, length, nil
+}
+
+// rangeSource is the bytes [start, end) of a file, read as a whole input.
+type rangeSource struct {
+	file       *os.File
+	start, end int64
+}
+
+// newRangeSource returns the range of length bytes from start of file, its
+// bounds moved back to the line boundary at or before them. Ranges sharing a
+// bound snap it the same way, so every line belongs to exactly one of them.
+func newRangeSource(file *os.File, start, length int64) (*rangeSource, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := fileInfo.Size()
+
+	// comparing the remaining bytes rather than start+length can't overflow
+	end := fileSize
+	if start < fileSize && fileSize-start > length {
+		if end, err = findNextLineBoundary(file, start+length, fileSize); err != nil {
+			return nil, fmt.Errorf("finding the end of the range: %w", err)
+		}
+	}
+	start = min(start, fileSize)
+	if start > 0 {
+		if start, err = findNextLineBoundary(file, start, fileSize); err != nil {
+			return nil, fmt.Errorf("finding the start of the range: %w", err)
+		}
+	}
+	return &rangeSource{file: file, start: start, end: end}, nil
+}
+
+func (s *rangeSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.end-s.start {
+		return 0, io.EOF
+	}
+	if remaining := s.end - s.start - off; int64(len(p)) > remaining {
+		n, err := s.file.ReadAt(p[:remaining], s.start+off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return s.file.ReadAt(p, s.start+off)
+}
+
+func (s *rangeSource) Stat() (fs.FileInfo, error) {
+	fileInfo, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sectionFileInfo{FileInfo: fileInfo, size: s.end - s.start}, nil
+}
@@ -0,0 +1,90 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRunRanges(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 50_000, 1)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+
+	cfg := DefaultConfig()
+	_, expMap, _, err := aggregate(ctx, filePath, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// split points inside the first line, at the start and on the newline of
+	// the second, inside a later line and past the end, the second range
+	// running to the end of the file
+	secondLine := int64(bytes.IndexByte(data, '\n') + 1)
+	for _, split := range []int64{3, secondLine, secondLine - 1, size / 2, size + 10} {
+		ranges := [][2]int64{{0, split}, {split, size}}
+		merged := map[string]*Location{}
+		for _, r := range ranges {
+			cfg := DefaultConfig()
+			cfg.ChunkSize = 4096
+			cfg.Range = strconv.FormatInt(r[0], 10) + ":" + strconv.FormatInt(r[1], 10)
+			_, locationMap, _, err := aggregate(ctx, filePath, cfg)
+			if err != nil {
+				t.Fatalf("(range %s) %v", cfg.Range, err)
+			}
+			if err := mergeChunk(merged, locationPointers(locationMap)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(locationValues(merged), expMap) {
+			t.Errorf("(split=%d) expected the merged ranges to equal the whole file", split)
+		}
+	}
+}
+
+func TestRunRangeFixture(t *testing.T) {
+	// measurements10In is 135 bytes, byte 20 is within its second line
+	tests := []struct {
+		rangeFlag string
+		expOutput string
+	}{
+		{rangeFlag: "0:20", expOutput: "{Halifax=12.9/12.9/12.9}"},
+		{rangeFlag: "20:26", expOutput: "{Cabo San Lucas=14.9/14.9/14.9, Zagreb=12.2/12.2/12.2}"},
+		{rangeFlag: "200:10", expOutput: "{}"},
+	}
+	for _, tc := range tests {
+		cfg := DefaultConfig()
+		cfg.Range = tc.rangeFlag
+		output, err := runString(context.Background(), measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != tc.expOutput {
+			t.Errorf("(-range %s) expected %q but got %q", tc.rangeFlag, tc.expOutput, output)
+		}
+	}
+}
+
+func TestValidateConfigRange(t *testing.T) {
+	for _, rangeFlag := range []string{"10", "a:10", "-1:10", "0:0", "0:x"} {
+		cfg := DefaultConfig()
+		cfg.Range = rangeFlag
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("expected -range %s to be rejected", rangeFlag)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Range = "0:10"
+	cfg.Concurrency = false
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected -range in the sequential mode to be rejected")
+	}
+}
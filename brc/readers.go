@@ -0,0 +1,76 @@
+package brc
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// chunkSpan is a chunk of the input scheduled for the readers.
+type chunkSpan struct {
+	start, end int64
+}
+
+// readChunk is a chunk read by a reader for the parsers.
+type readChunk struct {
+	start int64
+	data  []byte
+}
+
+// startReaders starts the pipeline of -readers in g: readers goroutines read
+// the chunks passed to schedule in the order they are scheduled, so the reads
+// stay mostly sequential, and hand them to GOMAXPROCS parsers calling process
+// over a channel bounded to a chunk per parser. finish is called once every
+// chunk is scheduled. schedule blocks while the readers are busy and gives up
+// once ctx is cancelled, as g then fails anyway.
+func startReaders(ctx context.Context, g *errgroup.Group, readers int, read func(start, end int64) ([]byte, error), process func(start int64, chunk []byte) error) (schedule func(start, end int64), finish func()) {
+	parsers := runtime.GOMAXPROCS(0)
+	spans := make(chan chunkSpan, readers)
+	chunks := make(chan readChunk, parsers)
+
+	var reading sync.WaitGroup
+	reading.Add(readers)
+	for i := 0; i < readers; i++ {
+		g.Go(func() error {
+			defer reading.Done()
+			for span := range spans {
+				data, err := read(span.start, span.end)
+				if err != nil {
+					return err
+				}
+				select {
+				case chunks <- readChunk{start: span.start, data: data}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		reading.Wait()
+		close(chunks)
+		return nil
+	})
+
+	for i := 0; i < parsers; i++ {
+		g.Go(func() error {
+			for chunk := range chunks {
+				if err := process(chunk.start, chunk.data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	schedule = func(start, end int64) {
+		select {
+		case spans <- chunkSpan{start: start, end: end}:
+		case <-ctx.Done():
+		}
+	}
+	return schedule, func() { close(spans) }
+}
@@ -0,0 +1,114 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunReaders(t *testing.T) {
+	ctx := context.Background()
+	filePath := generateMeasurementsFile(t, 100_000, 1)
+
+	for _, in := range []string{measurements10In, measurements10BOMIn, measurements10CRLFIn, filePath} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = 4096
+		setConcurrency(&cfg, true)
+		expOutput, err := runString(ctx, in, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, readers := range []int{1, 2, 8} {
+			cfg.Readers = readers
+			output, err := runString(ctx, in, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != expOutput {
+				t.Errorf("(%s, readers=%d) expected %q but got %q", in, readers, expOutput, output)
+			}
+		}
+	}
+}
+
+// BenchmarkRunReaders runs the concurrent engine over a source modelling a
+// spinning disk, which the interleaved reads of the default engine make seek
+// far more than the in-order reads of -readers.
+func BenchmarkRunReaders(b *testing.B) {
+	data, err := os.ReadFile(benchmarkFile(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	for _, readers := range []int{0, 1, 2} {
+		b.Run(fmt.Sprintf("readers-%d", readers), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.ChunkSize = 1 << 20
+			cfg.Readers = readers
+			cfg.NoPrescan = true
+
+			var seeks int
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				file := &throttledSource{data: data}
+				if _, _, _, err := parseFileWithConcurrency(context.Background(), file, cfg, nil); err != nil {
+					b.Fatal(err)
+				}
+				seeks += file.seeks
+			}
+			b.ReportMetric(float64(seeks)/float64(b.N), "seeks/op")
+		})
+	}
+}
+
+// throttledSource is an in-memory source modelling a disk with a single
+// head and a one block cache: reads are served in aligned blocks at about
+// 128MB/s, and a block that is neither cached nor the one after it costs a
+// seek.
+type throttledSource struct {
+	data []byte
+
+	mu     sync.Mutex
+	cached int64
+	seeks  int
+}
+
+const (
+	throttledBlockSize = 64 * 1024
+	throttledBlockTime = 500 * time.Microsecond
+	throttledSeekTime  = time.Millisecond
+)
+
+func (s *throttledSource) ReadAt(p []byte, off int64) (int, error) {
+	for block := off / throttledBlockSize; block*throttledBlockSize < off+int64(len(p)); block++ {
+		s.readBlock(block)
+	}
+	return bytes.NewReader(s.data).ReadAt(p, off)
+}
+
+func (s *throttledSource) readBlock(block int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if block == s.cached {
+		return
+	}
+	if block != s.cached+1 {
+		s.seeks++
+		time.Sleep(throttledSeekTime)
+	}
+	time.Sleep(throttledBlockTime)
+	s.cached = block
+}
+
+func (s *throttledSource) Stat() (fs.FileInfo, error) {
+	return fakeFileInfo{size: int64(len(s.data))}, nil
+}
@@ -0,0 +1,75 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// repeatRuns runs the aggregation of filePath repeat times for stable timing
+// measurements, returning the result and stats of the final iteration and
+// the wall time of every iteration after the first warmup ones. Every
+// iteration must produce the same result.
+func repeatRuns(ctx context.Context, filePath string, cfg Config, repeat, warmup int) (string, RunStats, []time.Duration, error) {
+	if repeat < 1 || warmup < 0 || warmup >= repeat {
+		return "", RunStats{}, nil, fmt.Errorf("invalid repeat %d with warmup %d, expected at least one timed iteration", repeat, warmup)
+	}
+
+	var first, result string
+	var stats RunStats
+	durations := make([]time.Duration, 0, repeat-warmup)
+	for i := 0; i < repeat; i++ {
+		start := time.Now()
+		var err error
+		result, stats, err = runWithStats(ctx, filePath, cfg)
+		if err != nil {
+			return "", stats, nil, fmt.Errorf("iteration %d: %w", i+1, err)
+		}
+		elapsed := time.Since(start)
+
+		if i == 0 {
+			first = result
+		} else if result != first {
+			return "", stats, nil, fmt.Errorf("iteration %d produced a different result than iteration 1", i+1)
+		}
+		if i >= warmup {
+			durations = append(durations, elapsed)
+		}
+	}
+	return result, stats, durations, nil
+}
+
+// logDurations logs the min, median and max of the timed iterations and the
+// throughput at the median over the file at filePath.
+func logDurations(ctx context.Context, filePath string, durations []time.Duration, warmup int) error {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := medianDuration(sorted)
+
+	slog.InfoContext(ctx, "repeat",
+		slog.Int("iterations", len(sorted)),
+		slog.Int("warmup", warmup),
+		slog.Duration("min", sorted[0]),
+		slog.Duration("median", median),
+		slog.Duration("max", sorted[len(sorted)-1]),
+		slog.Float64("mbPerSecond", float64(fileInfo.Size())/1e6/median.Seconds()))
+	return nil
+}
+
+// medianDuration returns the median of the sorted durations, the mean of the
+// middle two for an even count.
+func medianDuration(sorted []time.Duration) time.Duration {
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
@@ -0,0 +1,99 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRepeatRuns(t *testing.T) {
+	ctx := context.Background()
+
+	result, _, durations, err := repeatRuns(ctx, measurements10In, DefaultConfig(), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != measurements10Out {
+		t.Errorf("expected %+v but got %+v", measurements10Out, result)
+	}
+	if len(durations) != 2 {
+		t.Errorf("expected 2 timed iterations after the warmup but got %d", len(durations))
+	}
+
+	for _, warmup := range []int{-1, 3} {
+		if _, _, _, err := repeatRuns(ctx, measurements10In, DefaultConfig(), 3, warmup); err == nil {
+			t.Errorf("expected warmup %d of 3 iterations to be rejected", warmup)
+		}
+	}
+}
+
+func TestRepeatRunsMismatch(t *testing.T) {
+	ctx := context.Background()
+	defer func() { mergeHook = nil }()
+	cfg := DefaultConfig()
+	setConcurrency(&cfg, true)
+
+	// count the merges of a single run to perturb the second one only
+	var merges atomic.Int64
+	mergeHook = func(string, *Location) { merges.Add(1) }
+	if _, err := runString(ctx, measurements10In, cfg); err != nil {
+		t.Fatal(err)
+	}
+	perRun := merges.Load()
+
+	merges.Store(0)
+	mergeHook = func(_ string, loc *Location) {
+		if merges.Add(1) > perRun {
+			loc.Max++
+		}
+	}
+	_, _, _, err := repeatRuns(ctx, measurements10In, cfg, 3, 0)
+	expErr := "iteration 2 produced a different result than iteration 1"
+	if err == nil || err.Error() != expErr {
+		t.Errorf("expected error %q but got %v", expErr, err)
+	}
+}
+
+func TestMedianDuration(t *testing.T) {
+	tests := []struct {
+		sorted    []time.Duration
+		expMedian time.Duration
+	}{
+		{sorted: []time.Duration{5}, expMedian: 5},
+		{sorted: []time.Duration{1, 2, 9}, expMedian: 2},
+		{sorted: []time.Duration{1, 2, 4, 9}, expMedian: 3},
+	}
+	for _, tc := range tests {
+		if median := medianDuration(tc.sorted); median != tc.expMedian {
+			t.Errorf("medianDuration(%v) expected %v but got %v", tc.sorted, tc.expMedian, median)
+		}
+	}
+}
+
+func TestRealMainRepeat(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	if err := realMain(context.Background(), []string{"1brc", "-repeat=3", "-warmup=1", filePath}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != measurements10Out+"\n" {
+		t.Errorf("expected only the final result on stdout but got %q", stdout.String())
+	}
+	for _, expLog := range []string{"msg=repeat iterations=2 warmup=1 min=", "median=", "max=", "mbPerSecond="} {
+		if !strings.Contains(stderr.String(), expLog) {
+			t.Errorf("expected %q on stderr but got %q", expLog, stderr.String())
+		}
+	}
+
+	err := realMain(context.Background(), []string{"1brc", "-repeat=2", "-warmup=2", filePath}, &bytes.Buffer{}, &bytes.Buffer{})
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("expected exit code %d but got %d for %v", exitUsage, code, err)
+	}
+}
@@ -0,0 +1,109 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// StationResult is the aggregate of the readings of a station, with the
+// temperatures in degrees of the configured unit.
+type StationResult struct {
+	Name  string
+	Min   float64
+	Mean  float64
+	Max   float64
+	Count int64
+}
+
+// Result is the typed result of a run, independent of the 1BRC output
+// format.
+type Result struct {
+	// Stations are sorted by name unless the run was unordered
+	Stations []StationResult
+	// Stats are the counts and timings of the run, set by Aggregate
+	Stats RunStats
+	// Partial is set when the input shrank during a lenient run, the
+	// Stations then only cover the part read
+	Partial bool
+	// precision is the number of decimals temperatures are marshalled with
+	precision int
+}
+
+// Aggregate aggregates the measurements of the file at filePath into a
+// Result. The output options Format and Top don't apply, every station kept
+// by the MinCount filter is returned. When the input shrinks during a
+// lenient run the Result of the part read is returned, marked Partial, along
+// with the error.
+func Aggregate(ctx context.Context, filePath string, cfg Config) (Result, error) {
+	locations, locationMap, stats, err := aggregate(ctx, filePath, cfg)
+	if err != nil && !stats.Partial {
+		return Result{}, err
+	}
+	if !cfg.Unordered {
+		sortStations(locations)
+	}
+	result := newResult(locations, locationMap, cfg)
+	result.Stats = stats
+	result.Partial = stats.Partial
+	return result, err
+}
+
+// newResult converts the locations to a Result in the unit, rounding and
+// precision of cfg.
+func newResult(locations []string, locationMap map[string]Location, cfg Config) Result {
+	scale := float64(unitScale(cfg.Precision))
+	stations := make([]StationResult, 0, len(locations))
+	for _, name := range locations {
+		loc := locationMap[name]
+		stations = append(stations, StationResult{
+			Name:  name,
+			Min:   float64(convertReading(loc.Min, cfg)) / scale,
+			Mean:  float64(convertMean(loc, cfg)) / scale,
+			Max:   float64(convertReading(loc.Max, cfg)) / scale,
+			Count: loc.Count,
+		})
+	}
+	return Result{Stations: stations, precision: cfg.Precision}
+}
+
+// MarshalJSON marshals r as {"stations":[{"name":...,"min":...,"mean":...,
+// "max":...,"count":...}]}, with "partial":true after the stations of a
+// partial Result, writing temperatures with the decimals of the run so 12.0
+// isn't shortened to 12.
+func (r Result) MarshalJSON() ([]byte, error) {
+	precision := r.precision
+	if precision == 0 {
+		precision = 1
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(`{"stations":[`)
+	for i, station := range r.Stations {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, err := json.Marshal(station.Name)
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(`{"name":`)
+		buffer.Write(name)
+		buffer.WriteString(`,"min":`)
+		buffer.WriteString(strconv.FormatFloat(station.Min, 'f', precision, 64))
+		buffer.WriteString(`,"mean":`)
+		buffer.WriteString(strconv.FormatFloat(station.Mean, 'f', precision, 64))
+		buffer.WriteString(`,"max":`)
+		buffer.WriteString(strconv.FormatFloat(station.Max, 'f', precision, 64))
+		buffer.WriteString(`,"count":`)
+		buffer.WriteString(strconv.FormatInt(station.Count, 10))
+		buffer.WriteByte('}')
+	}
+	buffer.WriteByte(']')
+	if r.Partial {
+		buffer.WriteString(`,"partial":true`)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
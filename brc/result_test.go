@@ -0,0 +1,79 @@
+package brc
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "measurements_result.txt")
+	if err := os.WriteFile(filePath, []byte("b;1.0\na;-2.5\na;3.0\nb;12.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Aggregate(context.Background(), filePath, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expStations := []StationResult{
+		{Name: "a", Min: -2.5, Mean: 0.3, Max: 3.0, Count: 2},
+		{Name: "b", Min: 1.0, Mean: 6.5, Max: 12.0, Count: 2},
+	}
+	if !reflect.DeepEqual(result.Stations, expStations) {
+		t.Errorf("expected %+v but got %+v", expStations, result.Stations)
+	}
+	if result.Stats.Lines != 4 || result.Stats.Stations != 2 || result.Stats.Bytes != 26 {
+		t.Errorf("expected 4 lines of 2 stations in 26 bytes but got %+v", result.Stats)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expJSON := `{"stations":[{"name":"a","min":-2.5,"mean":0.3,"max":3.0,"count":2},{"name":"b","min":1.0,"mean":6.5,"max":12.0,"count":2}]}`
+	if string(data) != expJSON {
+		t.Errorf("expected %s but got %s", expJSON, data)
+	}
+}
+
+func TestResultMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  Result
+		expJSON string
+	}{
+		{name: "empty", result: Result{}, expJSON: `{"stations":[]}`},
+		{
+			name:    "escaped name",
+			result:  Result{Stations: []StationResult{{Name: `say "hi"`, Min: -1, Mean: 0, Max: 1, Count: 3}}},
+			expJSON: `{"stations":[{"name":"say \"hi\"","min":-1.0,"mean":0.0,"max":1.0,"count":3}]}`,
+		},
+		{
+			name:    "hundredths",
+			result:  Result{Stations: []StationResult{{Name: "a", Min: 1.25, Mean: 1.5, Max: 2, Count: 2}}, precision: 2},
+			expJSON: `{"stations":[{"name":"a","min":1.25,"mean":1.50,"max":2.00,"count":2}]}`,
+		},
+		{
+			name:    "partial",
+			result:  Result{Stations: []StationResult{{Name: "a", Min: 1, Mean: 1, Max: 1, Count: 1}}, Partial: true},
+			expJSON: `{"stations":[{"name":"a","min":1.0,"mean":1.0,"max":1.0,"count":1}],"partial":true}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.expJSON {
+				t.Errorf("expected %s but got %s", tc.expJSON, data)
+			}
+		})
+	}
+}
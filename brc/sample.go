@@ -0,0 +1,25 @@
+package brc
+
+// sampled reports whether line is in the sample of -sample-rate. The choice
+// is a hash of the line content rather than its position, so every engine
+// samples the same lines whatever the chunk boundaries, and repeated runs
+// give the same estimate.
+func sampled(line string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	return float64(lineHash(line)) < rate*(1<<64)
+}
+
+// lineHash is the 64-bit FNV-1a hash of line with the murmur3 finalizer
+// applied, as FNV-1a alone barely changes the high bits for lines that only
+// differ in their last bytes, such as the decimals of a temperature.
+func lineHash(line string) uint64 {
+	h := fnv1a(line)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
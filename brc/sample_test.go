@@ -0,0 +1,76 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRunSampleRate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SampleRate = 1.0
+	output, err := runString(context.Background(), measurements10In, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != measurements10Out {
+		t.Errorf("expected a sample rate of 1 to give the full result %q but got %q", measurements10Out, output)
+	}
+
+	const rows = 100_000
+	f, err := os.Open(generateMeasurementsFile(t, rows, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, rate := range []float64{1.0, 0.5, 0.1, 0.01} {
+		cfg := DefaultConfig()
+		cfg.SampleRate = rate
+		cfg.ChunkSize = testChunkSize
+
+		_, sequential, _, err := parseFile(context.Background(), f, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, concurrent, _, err := parseFileWithConcurrency(context.Background(), f, cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the sample depends on the line content only, not the engine
+		if !reflect.DeepEqual(sequential, concurrent) {
+			t.Errorf("(rate=%v) expected the engines to sample the same lines", rate)
+		}
+
+		var count int64
+		for _, loc := range sequential {
+			count += loc.Count
+		}
+		expCount := rate * rows
+		if rate == 1.0 && count != rows {
+			t.Errorf("expected a sample rate of 1 to count all %d rows but got %d", rows, count)
+		}
+		if float64(count) < expCount*0.8 || float64(count) > expCount*1.2 {
+			t.Errorf("(rate=%v) expected a count near %v but got %d", rate, expCount, count)
+		}
+	}
+}
+
+func TestValidateConfigSampleRate(t *testing.T) {
+	for _, rate := range []float64{0, -0.5, 1.5} {
+		cfg := DefaultConfig()
+		cfg.SampleRate = rate
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("expected sample rate %v to be rejected", rate)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.SampleRate = 0.5
+	cfg.InputFormat = inputFormatBinary
+	cfg.Dictionary = measurements10DictionaryIn
+	if err := validateConfig(cfg); err == nil {
+		t.Error("expected sampling binary input to be rejected")
+	}
+}
@@ -0,0 +1,129 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// shardCount is the number of shards of a shardedMap, a power of two well
+// above the worker count so workers rarely wait on the same shard
+const shardCount = 256
+
+// shardedMap is a location map split into shards by a hash of the station
+// name, each guarded by its own mutex so workers can update it directly.
+type shardedMap struct {
+	shards [shardCount]locationShard
+}
+
+type locationShard struct {
+	mu          sync.Mutex
+	locationMap map[string]*Location
+}
+
+func newShardedMap() *shardedMap {
+	m := &shardedMap{}
+	for i := range m.shards {
+		m.shards[i].locationMap = map[string]*Location{}
+	}
+	return m
+}
+
+// shard returns the shard of name, picked by its FNV-1a hash.
+func (m *shardedMap) shard(name string) *locationShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return &m.shards[h&(shardCount-1)]
+}
+
+// add merges a reading of the station name into its shard. The name is
+// copied when the station is new so the map doesn't retain the chunk it was
+// sliced from.
+func (m *shardedMap) add(name string, location Location, trackHistogram bool) error {
+	shard := m.shard(name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	loc, ok := shard.locationMap[name]
+	if !ok {
+		loc = &Location{}
+		shard.locationMap[strings.Clone(name)] = loc
+	}
+	if err := mergeLocation(loc, location); err != nil {
+		return fmt.Errorf("location '%s': %w", name, err)
+	}
+	if trackHistogram {
+		if loc.Histogram == nil {
+			loc.Histogram = &histogram{}
+		}
+		if err := loc.Histogram.add(location.Total); err != nil {
+			return fmt.Errorf("location '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// locations collects the shards into a single map, only to be called once
+// the workers have stopped adding.
+func (m *shardedMap) locations() ([]string, map[string]Location) {
+	size := 0
+	for i := range m.shards {
+		size += len(m.shards[i].locationMap)
+	}
+	locations := make([]string, 0, size)
+	locationMap := make(map[string]Location, size)
+	for i := range m.shards {
+		for name, loc := range m.shards[i].locationMap {
+			locations = append(locations, name)
+			locationMap[name] = *loc
+		}
+	}
+	return locations, locationMap
+}
+
+// parseFileSharded is parseFileWithConcurrency with the workers adding every
+// line to a shardedMap rather than sending per-chunk maps to a merger. The
+// locations are returned in no particular order.
+func parseFileSharded(ctx context.Context, file source, cfg Config, hasher *inputHasher) ([]string, map[string]Location, scanStats, error) {
+	shards := newShardedMap()
+	trackHistogram := tracksHistogram(cfg)
+
+	var mu sync.Mutex
+	var scan scanStats
+	err := lineOrchestrator(ctx, file, cfg, hasher, func(ctx context.Context, _ int64, chunk []byte) (scanStats, error) {
+		var chunkScan scanStats
+		for _, line := range strings.Split(string(chunk), "\n") {
+			skipped := chunkScan.skipped
+			locationName, location := processLine(line, cfg, &chunkScan)
+			if location == nil {
+				if cfg.Strict && chunkScan.skipped > skipped {
+					return scanStats{}, malformedLineError(line, cfg)
+				}
+				continue
+			}
+			if err := shards.add(locationName, *location, trackHistogram); err != nil {
+				return scanStats{}, err
+			}
+		}
+
+		mu.Lock()
+		scan.add(chunkScan)
+		mu.Unlock()
+		return chunkScan, ctx.Err()
+	})
+	var partial *partialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, nil, scanStats{}, err
+	}
+	if ctx.Err() != nil {
+		return nil, nil, scanStats{}, fmt.Errorf("cancelled due to context: %w", ctx.Err())
+	}
+
+	locations, locationMap := shards.locations()
+	return locations, locationMap, scan, err
+}
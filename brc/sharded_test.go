@@ -0,0 +1,127 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunSharded(t *testing.T) {
+	ctx := context.Background()
+	generated := generateMeasurementsFile(t, 50_000, 1)
+
+	tests := []struct {
+		name     string
+		filePath string
+		modify   func(cfg *Config)
+	}{
+		{name: "ten", filePath: measurements10In},
+		{name: "rounding", filePath: measurementsRoundingIn, modify: func(cfg *Config) { cfg.ChunkSize = 4096 }},
+		{name: "generated", filePath: generated, modify: func(cfg *Config) { cfg.ChunkSize = 4096 }},
+		{name: "unordered", filePath: generated, modify: func(cfg *Config) { cfg.Unordered = true }},
+		{name: "percentiles", filePath: generated, modify: func(cfg *Config) {
+			cfg.ChunkSize = 4096
+			cfg.StdDev = true
+			cfg.Percentiles = []float64{50, 99}
+		}},
+	}
+	for _, tc := range tests {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, true)
+		if tc.modify != nil {
+			tc.modify(&cfg)
+		}
+		expOutput, expStats, err := runWithStats(ctx, tc.filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg.Sharded = true
+		output, stats, err := runWithStats(ctx, tc.filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Unordered {
+			output, expOutput = sortedEntries(output), sortedEntries(expOutput)
+		}
+		if output != expOutput || stats.SkippedLines != expStats.SkippedLines {
+			t.Errorf("(%s) expected %.100s with %d skipped lines but got %.100s with %d", tc.name, expOutput, expStats.SkippedLines, output, stats.SkippedLines)
+		}
+	}
+}
+
+func TestShardedMapConcurrentAdd(t *testing.T) {
+	shards := newShardedMap()
+
+	const workers, readings = 8, 1000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < readings; i++ {
+				name := fmt.Sprintf("station-%d", i%50)
+				if err := shards.add(name, newLocation(int64(w)), true); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	locations, locationMap := shards.locations()
+	if len(locations) != 50 || len(locationMap) != 50 {
+		t.Fatalf("expected 50 stations but got %d", len(locationMap))
+	}
+	for name, loc := range locationMap {
+		expCount := int64(workers * readings / 50)
+		if loc.Count != expCount || loc.Min != 0 || loc.Max != workers-1 || loc.Histogram == nil {
+			t.Errorf("station %s: expected %d readings from 0 to %d but got %+v", name, expCount, workers-1, loc)
+		}
+	}
+}
+
+func BenchmarkRunSharded(b *testing.B) {
+	ctx := context.Background()
+
+	filePath := benchmarkFile(b)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	slog.SetDefault(logger)
+
+	for _, sharded := range []bool{false, true} {
+		name := "fan-in"
+		if sharded {
+			name = "sharded"
+		}
+		cfg := DefaultConfig()
+		cfg.Sharded = sharded
+		setConcurrency(&cfg, true)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(fileInfo.Size())
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := runString(ctx, filePath, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// sortedEntries sorts the entries of a text output in unordered mode.
+func sortedEntries(output string) string {
+	entries := strings.Split(strings.TrimSuffix(strings.TrimPrefix(output, "{"), "}"), ", ")
+	sort.Strings(entries)
+	return "{" + strings.Join(entries, ", ") + "}"
+}
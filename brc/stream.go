@@ -0,0 +1,111 @@
+package brc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// streamBufferSize is the size of the buffered reader of a stream
+const streamBufferSize = 1 << 20
+
+// StreamAggregator aggregates an unbounded stream of measurements, such as
+// one read from a socket, and can be queried for a snapshot of the
+// aggregates at any time while it consumes.
+type StreamAggregator struct {
+	cfg Config
+
+	mu          sync.Mutex
+	locationMap map[string]Location
+	scan        scanStats
+}
+
+// NewStreamAggregator returns an aggregator of text measurements in the
+// format of cfg.
+func NewStreamAggregator(cfg Config) (*StreamAggregator, error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.InputFormat != inputFormatText {
+		return nil, fmt.Errorf("streaming only supports %s input", inputFormatText)
+	}
+	return &StreamAggregator{cfg: cfg, locationMap: map[string]Location{}}, nil
+}
+
+// Consume aggregates the lines of r until it returns io.EOF, a read fails or
+// ctx is cancelled. A final line without a trailing newline is aggregated.
+func (a *StreamAggregator) Consume(ctx context.Context, r io.Reader) error {
+	reader := bufio.NewReaderSize(r, streamBufferSize)
+	for lineNumber := 0; ; lineNumber++ {
+		if lineNumber%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return fmt.Errorf("cancelled due to context: %w", ctx.Err())
+		}
+
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			if addErr := a.add(line); addErr != nil {
+				return addErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// add aggregates a line under the lock so snapshots see whole readings.
+func (a *StreamAggregator) add(line string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	skipped := a.scan.skipped
+	locationName, location := processLine(line, a.cfg, &a.scan)
+	if location == nil {
+		if a.cfg.Strict && a.scan.skipped > skipped {
+			return malformedLineError(line, a.cfg)
+		}
+		return nil
+	}
+	loc := a.locationMap[locationName]
+	if err := mergeLocation(&loc, *location); err != nil {
+		return fmt.Errorf("location '%s': %w", locationName, err)
+	}
+	if tracksHistogram(a.cfg) {
+		if loc.Histogram == nil {
+			loc.Histogram = &histogram{}
+		}
+		if err := loc.Histogram.add(location.Total); err != nil {
+			return fmt.Errorf("location '%s': %w", locationName, err)
+		}
+	}
+	a.locationMap[locationName] = loc
+	return nil
+}
+
+// Snapshot returns the aggregates of the readings consumed so far, sorted by
+// station name.
+func (a *StreamAggregator) Snapshot() Result {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	locations := mapLocations(a.locationMap)
+	sortStations(locations)
+	return newResult(locations, a.locationMap, a.cfg)
+}
+
+// SkippedLines returns the number of invalid lines consumed so far.
+func (a *StreamAggregator) SkippedLines() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.scan.skipped
+}
@@ -0,0 +1,109 @@
+package brc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamAggregator(t *testing.T) {
+	aggregator, err := NewStreamAggregator(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w := io.Pipe()
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- aggregator.Consume(context.Background(), r)
+	}()
+
+	// waitStations polls the snapshot until it holds n stations
+	waitStations := func(n int) Result {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			snapshot := aggregator.Snapshot()
+			if len(snapshot.Stations) == n {
+				return snapshot
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d stations but got %+v", n, snapshot.Stations)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if _, err := io.WriteString(w, "b;2.0\na;1.0\n"); err != nil {
+		t.Fatal(err)
+	}
+	expStations := []StationResult{
+		{Name: "a", Min: 1.0, Mean: 1.0, Max: 1.0, Count: 1},
+		{Name: "b", Min: 2.0, Mean: 2.0, Max: 2.0, Count: 1},
+	}
+	if snapshot := waitStations(2); !reflect.DeepEqual(snapshot.Stations, expStations) {
+		t.Errorf("expected the intermediate snapshot %+v but got %+v", expStations, snapshot.Stations)
+	}
+
+	// the final line has no trailing newline
+	if _, err := io.WriteString(w, "a;3.0\ninvalid\nc;-1.5"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := <-consumed; err != nil {
+		t.Fatal(err)
+	}
+
+	expStations = []StationResult{
+		{Name: "a", Min: 1.0, Mean: 2.0, Max: 3.0, Count: 2},
+		{Name: "b", Min: 2.0, Mean: 2.0, Max: 2.0, Count: 1},
+		{Name: "c", Min: -1.5, Mean: -1.5, Max: -1.5, Count: 1},
+	}
+	if snapshot := aggregator.Snapshot(); !reflect.DeepEqual(snapshot.Stations, expStations) {
+		t.Errorf("expected the final snapshot %+v but got %+v", expStations, snapshot.Stations)
+	}
+	if skipped := aggregator.SkippedLines(); skipped != 1 {
+		t.Errorf("expected 1 skipped line but got %d", skipped)
+	}
+}
+
+func TestStreamAggregatorErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.InputFormat = inputFormatBinary
+	cfg.Dictionary = measurements10DictionaryIn
+	if _, err := NewStreamAggregator(cfg); err == nil {
+		t.Error("expected binary input to be rejected")
+	}
+
+	aggregator, err := NewStreamAggregator(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errRead := errors.New("connection reset")
+	err = aggregator.Consume(context.Background(), io.MultiReader(strings.NewReader("a;1.0\n"), &errorReader{err: errRead}))
+	if !errors.Is(err, errRead) {
+		t.Errorf("expected the read error but got %v", err)
+	}
+	if snapshot := aggregator.Snapshot(); len(snapshot.Stations) != 1 {
+		t.Errorf("expected the station read before the error but got %+v", snapshot.Stations)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := aggregator.Consume(ctx, strings.NewReader("a;1.0\n")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error but got %v", err)
+	}
+}
+
+// errorReader fails every read with err.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
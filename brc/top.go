@@ -0,0 +1,72 @@
+package brc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+)
+
+// topStations returns the n locations with the highest mean, hottest first,
+// and the n with the lowest mean, coldest first. Means are compared as
+// output in cfg.Unit with cfg.Round, ties break alphabetically.
+func topStations(locations []string, locationMap map[string]Location, n int, cfg Config) (hottest, coldest []string) {
+	means := make(map[string]int64, len(locations))
+	for _, location := range locations {
+		means[location] = convertMean(locationMap[location], cfg)
+	}
+
+	sorted := append([]string(nil), locations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if means[sorted[i]] != means[sorted[j]] {
+			return means[sorted[i]] > means[sorted[j]]
+		}
+		return compareStations(sorted[i], sorted[j]) < 0
+	})
+	// copied as sorting for the coldest reorders sorted
+	hottest = append([]string(nil), sorted[:min(n, len(sorted))]...)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if means[sorted[i]] != means[sorted[j]] {
+			return means[sorted[i]] < means[sorted[j]]
+		}
+		return compareStations(sorted[i], sorted[j]) < 0
+	})
+	coldest = sorted[:min(n, len(sorted))]
+
+	return hottest, coldest
+}
+
+// createTopResult formats the cfg.Top hottest and coldest locations. The
+// text format writes a hottest={...} and a coldest={...} line, CSV prefixes
+// the usual columns with a list column holding hottest or coldest.
+func createTopResult(locations []string, locationMap map[string]Location, cfg Config) (string, error) {
+	hottest, coldest := topStations(locations, locationMap, cfg.Top, cfg)
+
+	buffer := bytes.Buffer{}
+	if cfg.Format == formatCSV {
+		w := csv.NewWriter(&buffer)
+		w.Write(append([]string{"list"}, csvHeader(cfg)...))
+		memo := newTemperatureMemo(cfg.Precision)
+		for _, list := range []struct {
+			name      string
+			locations []string
+		}{{"hottest", hottest}, {"coldest", coldest}} {
+			for _, location := range list.locations {
+				w.Write(append([]string{list.name}, csvRecord(location, locationMap[location], cfg, memo)...))
+			}
+		}
+		w.Flush()
+		return buffer.String(), w.Error()
+	}
+
+	buffer.WriteString("hottest={")
+	if err := writeLocations(&buffer, hottest, locationMap, cfg, false); err != nil {
+		return "", err
+	}
+	buffer.WriteString("}\ncoldest={")
+	if err := writeLocations(&buffer, coldest, locationMap, cfg, false); err != nil {
+		return "", err
+	}
+	buffer.WriteRune('}')
+	return buffer.String(), nil
+}
@@ -0,0 +1,65 @@
+package brc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTop(t *testing.T) {
+	ctx := context.Background()
+
+	// b and c tie on the highest mean, d and e on the lowest
+	lines := []string{
+		"a;10.0", "b;20.0", "c;15.0", "c;25.0", "d;-5.0", "e;-5.0", "f;0.0", "g;5.0",
+	}
+	filePath := filepath.Join(t.TempDir(), "measurements_top.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Top = 2
+
+		output, err := runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "hottest={b=20.0/20.0/20.0, c=15.0/20.0/25.0}\ncoldest={d=-5.0/-5.0/-5.0, e=-5.0/-5.0/-5.0}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		cfg.Format = formatCSV
+		output, err = runString(ctx, filePath, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "list,station,min,mean,max,count\n" +
+			"hottest,b,20.0,20.0,20.0,1\nhottest,c,15.0,20.0,25.0,2\n" +
+			"coldest,d,-5.0,-5.0,-5.0,1\ncoldest,e,-5.0,-5.0,-5.0,1\n"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestRunTopAfterMinCount(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Top = 5
+	cfg.MinCount = 10
+
+	// ham only has 4 readings so jel is both the hottest and the coldest
+	output, err := runString(context.Background(), measurementsRoundingIn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expOutput := "hottest={jel=-9.0/18.0/46.5}\ncoldest={jel=-9.0/18.0/46.5}"
+	if output != expOutput {
+		t.Errorf("expected %+v but got %+v", expOutput, output)
+	}
+}
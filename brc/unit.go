@@ -0,0 +1,49 @@
+package brc
+
+// output temperature units
+const (
+	unitCelsius    = "c"
+	unitFahrenheit = "f"
+)
+
+// unitScale returns the number of stored units per degree at precision.
+func unitScale(precision int) int64 {
+	if precision == 2 {
+		return 100
+	}
+	return 10
+}
+
+// convertReading converts a reading stored in Celsius to cfg.Unit. A
+// conversion to Fahrenheit is rounded once with cfg.Round.
+func convertReading(val int64, cfg Config) int64 {
+	if cfg.Unit != unitFahrenheit {
+		return val
+	}
+	// val*9/5 + 32 degrees
+	return divRound(9*val+160*unitScale(cfg.Precision), 5, cfg.Round)
+}
+
+// convertMean returns the mean of loc in cfg.Unit. The Fahrenheit mean is
+// converted from the exact Celsius mean and rounded once, rounding the
+// Celsius mean first would be off by a tenth for means like 36.85°C.
+func convertMean(loc Location, cfg Config) int64 {
+	if cfg.Unit != unitFahrenheit {
+		return mean(loc, cfg.Round)
+	}
+
+	// with the mean q + r/Count and 9q = 5a + b the Fahrenheit mean is
+	// a + (b*Count + 9r)/(5*Count) + 32 degrees, which stays within int64
+	q, r := floorDivMod(loc.Total, loc.Count)
+	a, b := floorDivMod(9*q, 5)
+	return 32*unitScale(cfg.Precision) + a + divRound(b*loc.Count+9*r, 5*loc.Count, cfg.Round)
+}
+
+// convertStdDev returns the standard deviation of loc in cfg.Unit, the
+// offset of Fahrenheit doesn't affect it.
+func convertStdDev(loc Location, cfg Config) int64 {
+	if cfg.Unit != unitFahrenheit {
+		return stdDev(loc, 1)
+	}
+	return stdDev(loc, 9.0/5)
+}
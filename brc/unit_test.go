@@ -0,0 +1,87 @@
+package brc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunFahrenheit(t *testing.T) {
+	ctx := context.Background()
+
+	for _, concurrency := range []bool{true, false} {
+		cfg := DefaultConfig()
+		setConcurrency(&cfg, concurrency)
+		cfg.Unit = unitFahrenheit
+
+		output, err := runString(ctx, measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput := "{Adelaide=59.0/59.0/59.0, Cabo San Lucas=58.8/58.8/58.8, Dodoma=72.0/72.0/72.0, Halifax=55.2/55.2/55.2, Karachi=59.7/59.7/59.7, Pittsburgh=49.5/49.5/49.5, Ségou=78.3/78.3/78.3, Tauranga=100.8/100.8/100.8, Xi'an=75.6/75.6/75.6, Zagreb=54.0/54.0/54.0}"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+
+		cfg.Format = formatCSV
+		output, err = runString(ctx, measurements10In, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expOutput = "station,min,mean,max,count\n" +
+			"Adelaide,59.0,59.0,59.0,1\nCabo San Lucas,58.8,58.8,58.8,1\nDodoma,72.0,72.0,72.0,1\n" +
+			"Halifax,55.2,55.2,55.2,1\nKarachi,59.7,59.7,59.7,1\nPittsburgh,49.5,49.5,49.5,1\n" +
+			"Ségou,78.3,78.3,78.3,1\nTauranga,100.8,100.8,100.8,1\nXi'an,75.6,75.6,75.6,1\nZagreb,54.0,54.0,54.0,1\n"
+		if output != expOutput {
+			t.Errorf("(concurrency=%v) expected %+v but got %+v", concurrency, expOutput, output)
+		}
+	}
+}
+
+func TestConvertMean(t *testing.T) {
+	tests := []struct {
+		name      string
+		readings  []int64
+		precision int
+		expMean   int64
+	}{
+		// 36.85°C is 98.33°F, rounding to 36.9°C first would give 98.4°F
+		{name: "single rounding", readings: []int64{368, 369}, precision: 1, expMean: 983},
+		{name: "negative", readings: []int64{-401, -400}, precision: 1, expMean: -401},
+		{name: "freezing", readings: []int64{0}, precision: 1, expMean: 320},
+		// -17.75°C is 0.05°F, a tie rounded up
+		{name: "tie", readings: []int64{-177, -178}, precision: 1, expMean: 1},
+		{name: "hundredths", readings: []int64{3685}, precision: 2, expMean: 9833},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := Location{}
+			for _, reading := range tc.readings {
+				if err := mergeLocation(&loc, newLocation(reading)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := DefaultConfig()
+			cfg.Unit = unitFahrenheit
+			cfg.Precision = tc.precision
+
+			if got := convertMean(loc, cfg); got != tc.expMean {
+				t.Errorf("expected %d but got %d", tc.expMean, got)
+			}
+		})
+	}
+}
+
+func TestConvertReading(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := convertReading(-400, cfg); got != -400 {
+		t.Errorf("expected Celsius readings unchanged but got %d", got)
+	}
+
+	cfg.Unit = unitFahrenheit
+	for reading, expected := range map[int64]int64{-400: -400, 0: 320, 1000: 2120, 1: 322, -1: 318} {
+		if got := convertReading(reading, cfg); got != expected {
+			t.Errorf("convertReading(%d) expected %d but got %d", reading, expected, got)
+		}
+	}
+}
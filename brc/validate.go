@@ -0,0 +1,246 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// validateMaxTemperature bounds the temperatures -validate accepts, in
+// tenths: readings are expected in [-99.9, 99.9]
+const validateMaxTemperature = 999
+
+// lineDefect is why -validate rejects a line.
+type lineDefect int
+
+const (
+	defectNone lineDefect = iota
+	defectMissingDelimiter
+	defectEmptyName
+	defectNameTooLong
+	defectInvalidTemperature
+	defectTemperatureOutOfRange
+	// lineDefects is the number of lineDefect values
+	lineDefects
+)
+
+var lineDefectNames = [lineDefects]string{
+	defectNone:                  "none",
+	defectMissingDelimiter:      "missing delimiter",
+	defectEmptyName:             "empty station name",
+	defectNameTooLong:           "station name too long",
+	defectInvalidTemperature:    "invalid temperature",
+	defectTemperatureOutOfRange: "temperature out of range",
+}
+
+func (d lineDefect) String() string {
+	return lineDefectNames[d]
+}
+
+// defectStats counts the lines with a defect.
+type defectStats struct {
+	Count int64
+	// FirstOffset is the byte offset in the file of the first line with the
+	// defect, only set when Count is not 0
+	FirstOffset int64
+}
+
+// validationReport is the outcome of -validate.
+type validationReport struct {
+	Lines int64
+	// Blank lines are counted in Lines but are not malformed
+	Blank     int64
+	Malformed int64
+	// Defects are the malformed lines by lineDefect
+	Defects [lineDefects]defectStats
+	// FirstMalformed holds the 1-based numbers of the first malformed lines,
+	// see firstMalformedLines
+	FirstMalformed [dryRunMaxReported]int64
+}
+
+// firstMalformedLines returns the numbers of the first malformed lines, at
+// most dryRunMaxReported of them.
+func (r validationReport) firstMalformedLines() []int64 {
+	return r.FirstMalformed[:min(r.Malformed, dryRunMaxReported)]
+}
+
+// add combines the report of the chunk following r into it.
+func (r *validationReport) add(other validationReport) {
+	for i, line := range other.firstMalformedLines() {
+		if n := r.Malformed + int64(i); n < dryRunMaxReported {
+			r.FirstMalformed[n] = r.Lines + line
+		}
+	}
+	r.Lines += other.Lines
+	r.Blank += other.Blank
+	r.Malformed += other.Malformed
+	for d, stats := range other.Defects {
+		if stats.Count == 0 {
+			continue
+		}
+		if r.Defects[d].Count == 0 {
+			r.Defects[d].FirstOffset = stats.FirstOffset
+		}
+		r.Defects[d].Count += stats.Count
+	}
+}
+
+// validate checks every line of file has the shape name;temperature with a
+// station name of at most cfg.MaxNameLength bytes and a temperature within
+// validateMaxTemperature. Chunks are checked concurrently like
+// parseFileWithConcurrency aggregates them, without building a location map. Each worker reuses a chunk buffer and
+// lines are checked in place, so nothing is allocated per chunk or line.
+func validate(ctx context.Context, file source, cfg Config) (validationReport, error) {
+	starts, ends, err := dryRunChunkBounds(file, cfg)
+	if err != nil {
+		return validationReport{}, err
+	}
+	reports := make([]validationReport, len(starts))
+	errs := make([]error, len(starts))
+	buffers := make([][]byte, dryRunWorkers())
+	err = forEachDryRunChunk(ctx, len(starts), func(worker, i int) {
+		buffers[worker], reports[i], errs[i] = validateChunkAt(file, buffers[worker], starts[i], ends[i], i > 0, i == len(starts)-1, cfg)
+	})
+	if err != nil {
+		return validationReport{}, err
+	}
+
+	var report validationReport
+	for i := range reports {
+		if errs[i] != nil {
+			return validationReport{}, errs[i]
+		}
+		report.add(reports[i])
+	}
+	return report, nil
+}
+
+// validateChunkAt checks the lines of the chunk from start to end. A chunk
+// after the first starts with the newline ending the previous chunk and the
+// last chunk may end with a trailing newline, neither begins a line. The
+// chunk is read into buf, grown when it is too small, which is returned for
+// the next chunk.
+func validateChunkAt(file io.ReaderAt, buf []byte, start, end int64, continued, last bool, cfg Config) ([]byte, validationReport, error) {
+	length, err := chunkLength(start, end)
+	if err != nil {
+		return buf, validationReport{}, err
+	}
+	if cap(buf) < length {
+		buf = make([]byte, length)
+	}
+	chunk := buf[:length]
+	if _, err := readFullAt(file, chunk, start); err != nil {
+		return buf, validationReport{}, fmt.Errorf("reading chunk at offset %d: %w", start, err)
+	}
+
+	var report validationReport
+	pos := 0
+	if continued {
+		pos = 1
+	}
+	for {
+		line := chunk[pos:]
+		i := bytes.IndexByte(line, '\n')
+		if i != -1 {
+			line = line[:i]
+		} else if len(line) == 0 && last {
+			// the trailing newline of the file
+			break
+		}
+
+		report.Lines++
+		if len(bytes.TrimSpace(line)) == 0 {
+			report.Blank++
+		} else if defect := lineDefectOf(bytesView(line), cfg); defect != defectNone {
+			if report.Malformed < dryRunMaxReported {
+				report.FirstMalformed[report.Malformed] = report.Lines
+			}
+			report.Malformed++
+			if report.Defects[defect].Count == 0 {
+				report.Defects[defect].FirstOffset = start + int64(pos)
+			}
+			report.Defects[defect].Count++
+		}
+		if i == -1 {
+			break
+		}
+		pos += i + 1
+	}
+	return buf, report, nil
+}
+
+// bytesView returns b as a string without copying it. The string is only
+// valid until b is overwritten, it must not be retained.
+func bytesView(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// lineDefectOf returns the first defect of line, which isn't blank.
+func lineDefectOf(line string, cfg Config) lineDefect {
+	line = strings.TrimSuffix(line, "\r")
+	name, temperature, ok := splitLine(line, cfg.Delimiter, cfg.Quoted)
+	switch {
+	case !ok:
+		return defectMissingDelimiter
+	case name == "":
+		return defectEmptyName
+	case len(name) > cfg.MaxNameLength:
+		return defectNameTooLong
+	}
+
+	val, _, ok := parseTemp(temperature, cfg.Precision, cfg.AllowIntegerTemps, cfg.decimalSeparator())
+	if !ok {
+		return defectInvalidTemperature
+	}
+	limit := validateMaxTemperature * unitScale(cfg.Precision) / 10
+	if val < -limit || val > limit {
+		return defectTemperatureOutOfRange
+	}
+	return defectNone
+}
+
+// writeValidationReport writes report as the output of -validate, a line
+// per defect found.
+func writeValidationReport(w io.Writer, report validationReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lines: %d\nblank: %d\nmalformed: %d\n", report.Lines, report.Blank, report.Malformed)
+	for d, stats := range report.Defects {
+		if stats.Count > 0 {
+			fmt.Fprintf(&b, "%s: %d (first at byte %d)\n", lineDefect(d), stats.Count, stats.FirstOffset)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runValidate checks the file at filePath for -validate, writing the report
+// to stdout. Malformed lines fail the run with the parse error exit code.
+func runValidate(ctx context.Context, filePath string, cfg Config, stdout io.Writer) error {
+	if cfg.InputFormat != inputFormatText {
+		return withExitCode(exitUsage, fmt.Errorf("-validate only supports %s input", inputFormatText))
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return withExitCode(exitInput, err)
+	}
+	defer f.Close()
+
+	report, err := validate(ctx, f, cfg)
+	if err != nil {
+		return inputOrParseError(err)
+	}
+	if err := writeValidationReport(stdout, report); err != nil {
+		return withExitCode(exitOutput, fmt.Errorf("writing validation report: %w", err))
+	}
+	if report.Malformed > 0 {
+		return withExitCode(exitParse, fmt.Errorf("%d malformed lines", report.Malformed))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// measurementsDefectsIn has a line or two of each lineDefect among valid and
+// blank lines
+const measurementsDefectsIn string = "measurements_defects.txt"
+
+func TestValidate(t *testing.T) {
+	data, err := os.ReadFile(measurementsDefectsIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expReport := validationReport{Lines: 12, Blank: 1, Malformed: 8}
+	expReport.Defects[defectMissingDelimiter] = defectStats{Count: 2, FirstOffset: 13}
+	expReport.Defects[defectEmptyName] = defectStats{Count: 1, FirstOffset: 25}
+	expReport.Defects[defectNameTooLong] = defectStats{Count: 1, FirstOffset: 45}
+	expReport.Defects[defectInvalidTemperature] = defectStats{Count: 2, FirstOffset: 151}
+	expReport.Defects[defectTemperatureOutOfRange] = defectStats{Count: 2, FirstOffset: 167}
+	expReport.FirstMalformed = [dryRunMaxReported]int64{2, 3, 5, 6, 7, 9, 11, 12}
+	for _, size := range []int64{16, 64, testChunkSize, 0} {
+		cfg := DefaultConfig()
+		cfg.ChunkSize = size
+
+		report, err := validate(context.Background(), &dribblingSource{data: data, dribble: len(data)}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report != expReport {
+			t.Errorf("(chunkSize=%d) expected %+v but got %+v", size, expReport, report)
+		}
+
+		// -dry-run reports the same lines
+		dryRunReport, err := dryRun(context.Background(), &dribblingSource{data: data, dribble: len(data)}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dryRunReport.Invalid != 8 || !reflect.DeepEqual(dryRunReport.FirstInvalid, []int64{2, 3, 5, 6, 7, 9, 11, 12}) {
+			t.Errorf("(chunkSize=%d) expected the malformed lines in the dry run but got %+v", size, dryRunReport)
+		}
+	}
+
+	// the fixture with its defects fixed is clean
+	clean := "Hamburg;12.0\nBulawayo;8.9\nPalembang;99.9\nCracow;-99.9\r\n\nRoseau;34.4"
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 16
+	report, err := validate(context.Background(), &dribblingSource{data: []byte(clean), dribble: len(clean)}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (validationReport{Lines: 6, Blank: 1}); report != exp {
+		t.Errorf("expected %+v but got %+v", exp, report)
+	}
+}
+
+func TestValidateChunkAtAllocs(t *testing.T) {
+	data, err := os.ReadFile(measurementsDefectsIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := bytes.NewReader(data)
+	cfg := DefaultConfig()
+
+	buf, _, err := validateChunkAt(file, nil, 0, int64(len(data)), false, true, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a reused buffer large enough for the chunk isn't replaced
+	allocs := testing.AllocsPerRun(10, func() {
+		buf, _, err = validateChunkAt(file, buf, 0, int64(len(data)), false, true, cfg)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs != 0 {
+		t.Errorf("expected no allocations checking a chunk but got %v", allocs)
+	}
+}
+
+func TestRealMainValidate(t *testing.T) {
+	filePath := fixturePath(t, measurementsDefectsIn)
+	cleanPath := fixturePath(t, measurements10In)
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	stdout := bytes.Buffer{}
+	err := realMain(context.Background(), []string{"1brc", "-validate", filePath}, &stdout, &bytes.Buffer{})
+	if code := exitCode(err); code != exitParse {
+		t.Errorf("expected exit code %d but got %d for %v", exitParse, code, err)
+	}
+	expOutput := "lines: 12\nblank: 1\nmalformed: 8\n" +
+		"missing delimiter: 2 (first at byte 13)\n" +
+		"empty station name: 1 (first at byte 25)\n" +
+		"station name too long: 1 (first at byte 45)\n" +
+		"invalid temperature: 2 (first at byte 151)\n" +
+		"temperature out of range: 2 (first at byte 167)\n"
+	if stdout.String() != expOutput {
+		t.Errorf("expected %q but got %q", expOutput, stdout.String())
+	}
+
+	stdout.Reset()
+	if err := realMain(context.Background(), []string{"1brc", "-validate", cleanPath}, &stdout, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "lines: 10\nblank: 0\nmalformed: 0\n"; stdout.String() != exp {
+		t.Errorf("expected %q but got %q", exp, stdout.String())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no CPU profile in the working directory but got %d files", len(entries))
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	filePath := generateMeasurementsFile(b, 200_000, 1)
+	f, err := os.Open(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	cfg := DefaultConfig()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := validate(context.Background(), f, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
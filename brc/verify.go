@@ -0,0 +1,136 @@
+package brc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+// stationDiff is a station whose aggregates differ between parseFile and
+// parseFileWithConcurrency, a side is nil when it lacks the station.
+type stationDiff struct {
+	Name       string
+	Sequential *Location
+	Concurrent *Location
+}
+
+func (d stationDiff) String() string {
+	return fmt.Sprintf("station %q: sequential %s, concurrent %s", d.Name, describeLocation(d.Sequential), describeLocation(d.Concurrent))
+}
+
+// describeLocation formats the exact aggregates compared by -verify.
+func describeLocation(loc *Location) string {
+	if loc == nil {
+		return "missing"
+	}
+	return fmt.Sprintf("min=%d max=%d total=%d count=%d", loc.Min, loc.Max, loc.Total, loc.Count)
+}
+
+// verifyEngines aggregates file with both parseFile and
+// parseFileWithConcurrency and returns the stations whose min, max, total or
+// count differ, sorted by name, along with the sequential aggregates.
+func verifyEngines(ctx context.Context, file *os.File, cfg Config) ([]stationDiff, map[string]Location, error) {
+	_, sequential, _, err := parseFile(ctx, file, cfg, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sequential: %w", err)
+	}
+	_, concurrent, _, err := parseFileWithConcurrency(ctx, file, cfg, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("concurrent: %w", err)
+	}
+	return diffLocations(sequential, concurrent), sequential, nil
+}
+
+// diffLocations compares the aggregates of the sequential and concurrent
+// location maps station by station.
+func diffLocations(sequential, concurrent map[string]Location) []stationDiff {
+	names := mapLocations(sequential)
+	for name := range concurrent {
+		if _, ok := sequential[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []stationDiff{}
+	for _, name := range names {
+		s, inSequential := sequential[name]
+		c, inConcurrent := concurrent[name]
+		if inSequential && inConcurrent &&
+			s.Min == c.Min && s.Max == c.Max && s.Total == c.Total && s.Count == c.Count {
+			continue
+		}
+		diff := stationDiff{Name: name}
+		if inSequential {
+			diff.Sequential = &s
+		}
+		if inConcurrent {
+			diff.Concurrent = &c
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// runVerify compares the engines over the file at filePath for -verify,
+// writing the differing stations to stdout. A mismatch fails the run.
+// With fallback the result is written instead, the sequential one being
+// authoritative: a mismatch then warns with the differing stations and
+// fails with exitMismatch once the result is written.
+func runVerify(ctx context.Context, filePath string, cfg Config, stdout io.Writer, fallback bool) error {
+	if cfg.InputFormat != inputFormatText {
+		return withExitCode(exitUsage, fmt.Errorf("-verify only supports %s input", inputFormatText))
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return withExitCode(exitInput, err)
+	}
+	defer f.Close()
+
+	diffs, sequential, err := verifyEngines(ctx, f, cfg)
+	if err != nil {
+		return inputOrParseError(err)
+	}
+	if fallback {
+		return writeFallback(stdout, diffs, sequential, cfg)
+	}
+	for _, diff := range diffs {
+		if _, err := fmt.Fprintln(stdout, diff); err != nil {
+			return withExitCode(exitOutput, fmt.Errorf("writing verify report: %w", err))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d stations differ between the sequential and concurrent results", len(diffs))
+	}
+	_, err = fmt.Fprintf(stdout, "sequential and concurrent results match for %d stations\n", len(sequential))
+	return withExitCode(exitOutput, err)
+}
+
+// writeFallback writes the sequential result of a -fallback-on-mismatch run
+// to stdout, warning about each station of diffs first.
+func writeFallback(stdout io.Writer, diffs []stationDiff, sequential map[string]Location, cfg Config) error {
+	for _, diff := range diffs {
+		slog.Warn("concurrent result differs", slog.String("diff", diff.String()))
+	}
+	if len(diffs) > 0 {
+		slog.Warn("falling back to the sequential result", slog.Int("stations", len(diffs)))
+	}
+
+	// the stations of the sequential result in no particular order,
+	// writeFormatted sorts them unless the run is unordered
+	err := writeFormatted(stdout, mapLocations(sequential), sequential, cfg)
+	// csv output already ends in a newline
+	if err == nil && cfg.Format == formatText {
+		_, err = io.WriteString(stdout, "\n")
+	}
+	if err != nil {
+		return withExitCode(exitOutput, fmt.Errorf("writing result: %w", err))
+	}
+	if len(diffs) > 0 {
+		return withExitCode(exitMismatch, fmt.Errorf("%d stations differ between the sequential and concurrent results, printed the sequential result", len(diffs)))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyEngines(t *testing.T) {
+	f, err := os.Open(generateMeasurementsFile(t, 50_000, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cfg := DefaultConfig()
+	cfg.ChunkSize = 4096
+	diffs, sequential, err := verifyEngines(context.Background(), f, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 || len(sequential) == 0 {
+		t.Errorf("expected no differences over %d stations but got %v", len(sequential), diffs)
+	}
+}
+
+func TestRealMainVerifyMismatch(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+
+	// corrupt the concurrent result only, the sequential engine doesn't merge
+	mergeHook = func(name string, loc *Location) {
+		if name == "Halifax" {
+			loc.Max += 10
+		}
+	}
+	defer func() { mergeHook = nil }()
+
+	stdout := bytes.Buffer{}
+	err := realMain(context.Background(), []string{"1brc", "-verify", filePath}, &stdout, &bytes.Buffer{})
+	if err == nil || exitCode(err) == exitOK {
+		t.Errorf("expected a mismatch to fail the run but got %v", err)
+	}
+	expOutput := "station \"Halifax\": sequential min=129 max=129 total=129 count=1, concurrent min=129 max=139 total=129 count=1\n"
+	if stdout.String() != expOutput {
+		t.Errorf("expected %q but got %q", expOutput, stdout.String())
+	}
+}
+
+func TestRealMainVerifyFallback(t *testing.T) {
+	filePath := fixturePath(t, measurements10In)
+	chdir(t, t.TempDir())
+	defer slog.SetDefault(slog.Default())
+	defer func() { mergeHook = nil }()
+
+	for _, corrupt := range []bool{false, true} {
+		// corrupt the concurrent result only, the sequential engine doesn't merge
+		mergeHook = func(name string, loc *Location) {
+			if corrupt && name == "Halifax" {
+				loc.Max += 10
+			}
+		}
+
+		stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+		err := realMain(context.Background(), []string{"1brc", "-verify", "-fallback-on-mismatch", filePath}, &stdout, &stderr)
+		expCode := exitOK
+		if corrupt {
+			expCode = exitMismatch
+		}
+		if code := exitCode(err); code != expCode {
+			t.Errorf("(corrupt=%t) expected exit code %d but got %d for error %v", corrupt, expCode, code, err)
+		}
+		// the sequential result is printed either way
+		if stdout.String() != measurements10Out+"\n" {
+			t.Errorf("(corrupt=%t) expected %q but got %q", corrupt, measurements10Out+"\n", stdout.String())
+		}
+		if hasWarning := strings.Contains(stderr.String(), `station \"Halifax\"`); hasWarning != corrupt {
+			t.Errorf("(corrupt=%t) unexpected warnings %q", corrupt, stderr.String())
+		}
+	}
+
+	err := realMain(context.Background(), []string{"1brc", "-fallback-on-mismatch", filePath}, &bytes.Buffer{}, &bytes.Buffer{})
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("expected -fallback-on-mismatch without -verify to be a usage error but got %v", err)
+	}
+}
+
+func TestDiffLocations(t *testing.T) {
+	sequential := map[string]Location{
+		"a": {Min: 1, Max: 2, Total: 3, Count: 2},
+		"b": {Min: 1, Max: 1, Total: 1, Count: 1},
+	}
+	concurrent := map[string]Location{
+		"a": {Min: 1, Max: 2, Total: 3, Count: 2},
+		"c": {Min: 5, Max: 5, Total: 5, Count: 1},
+	}
+
+	b, c := sequential["b"], concurrent["c"]
+	expDiffs := []stationDiff{{Name: "b", Sequential: &b}, {Name: "c", Concurrent: &c}}
+	if diffs := diffLocations(sequential, concurrent); !reflect.DeepEqual(diffs, expDiffs) {
+		t.Errorf("expected %v but got %v", expDiffs, diffs)
+	}
+	if got := expDiffs[0].String(); got != `station "b": sequential min=1 max=1 total=1 count=1, concurrent missing` {
+		t.Errorf("unexpected diff description %q", got)
+	}
+}
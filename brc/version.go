@@ -0,0 +1,69 @@
+package brc
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+)
+
+// buildVersion describes the build of the running binary.
+type buildVersion struct {
+	Module   string
+	Version  string
+	Revision string
+	Dirty    bool
+	Go       string
+	Platform string
+}
+
+// readBuildVersion reads the build information embedded by the go command.
+// The VCS fields are only set when building the package from a checkout, not
+// when building or running individual files.
+func readBuildVersion() buildVersion {
+	v := buildVersion{
+		Module:   "unknown",
+		Version:  "unknown",
+		Revision: "unknown",
+		Go:       runtime.Version(),
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	if info.Main.Path != "" {
+		v.Module = info.Main.Path
+	}
+	if info.Main.Version != "" {
+		v.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			v.Revision = setting.Value
+		case "vcs.modified":
+			v.Dirty = setting.Value == "true"
+		}
+	}
+	return v
+}
+
+func (v buildVersion) String() string {
+	revision := v.Revision
+	if v.Dirty {
+		revision += " (dirty)"
+	}
+	return fmt.Sprintf("%s %s\nrevision: %s\ngo: %s %s", v.Module, v.Version, revision, v.Go, v.Platform)
+}
+
+// attr returns the build as a log attribute group.
+func (v buildVersion) attr() slog.Attr {
+	return slog.Group("build",
+		slog.String("version", v.Version),
+		slog.String("revision", v.Revision),
+		slog.Bool("dirty", v.Dirty),
+		slog.String("go", v.Go),
+		slog.String("platform", v.Platform))
+}
@@ -0,0 +1,49 @@
+package brc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRealMainVersion(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	// no input file is needed
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	if err := realMain(context.Background(), []string{"1brc", "-version"}, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	expLine := "go: " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH
+	if !strings.Contains(stdout.String(), expLine) || !strings.Contains(stdout.String(), "revision: ") {
+		t.Errorf("expected the build version on stdout but got %q", stdout.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("expected nothing on stderr but got %q", stderr.String())
+	}
+
+	// exiting before the run means no CPU profile is written
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no files to be written but got %v", entries)
+	}
+}
+
+func TestBuildVersionString(t *testing.T) {
+	v := buildVersion{
+		Module: "github.com/web-slinger/1brc-go", Version: "v1.2.3", Revision: "abc123", Dirty: true,
+		Go: "go1.22.0", Platform: "linux/amd64",
+	}
+	expOutput := "github.com/web-slinger/1brc-go v1.2.3\nrevision: abc123 (dirty)\ngo: go1.22.0 linux/amd64"
+	if v.String() != expOutput {
+		t.Errorf("expected %q but got %q", expOutput, v.String())
+	}
+}
@@ -1,3 +1,12 @@
 module github.com/web-slinger/1brc-go
 
 go 1.21
+
+require (
+	github.com/zeebo/xxh3 v1.0.2
+	golang.org/x/sync v0.7.0
+	golang.org/x/sys v0.20.0
+	golang.org/x/text v0.14.0
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect